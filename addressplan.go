@@ -0,0 +1,335 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// AddressIssueKind is the kind of an AddressIssue.
+type AddressIssueKind string
+
+const (
+	// IssueSubnetOverlap is a route target of one network overlapping one of
+	// another. Hosts on both networks get conflicting routes.
+	IssueSubnetOverlap AddressIssueKind = "subnetOverlap"
+	// IssueDuplicateIP is an IP assigned to more than one member of a network.
+	IssueDuplicateIP AddressIssueKind = "duplicateIp"
+	// IssueUncoveredPool is an assignment pool outside every route target.
+	IssueUncoveredPool AddressIssueKind = "uncoveredPool"
+	// IssueIPOutsideRoutes is a member IP outside every route target.
+	IssueIPOutsideRoutes AddressIssueKind = "ipOutsideRoutes"
+)
+
+// AddressIssue is a single problem found by AnalyzeAddressPlan.
+type AddressIssue struct {
+	Kind      AddressIssueKind `json:"kind"`
+	Severity  Severity         `json:"severity"`
+	NetworkID string           `json:"networkId"`
+	// OtherNetworkID is the other network of an IssueSubnetOverlap.
+	OtherNetworkID string `json:"otherNetworkId,omitempty"`
+	// Subnet is the route target or pool, and OtherSubnet the one it overlaps.
+	Subnet      string   `json:"subnet,omitempty"`
+	OtherSubnet string   `json:"otherSubnet,omitempty"`
+	IP          string   `json:"ip,omitempty"`
+	MemberIDs   []string `json:"memberIds,omitempty"`
+	Message     string   `json:"message"`
+}
+
+func (i AddressIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.NetworkID, i.Message)
+}
+
+// PoolUtilization is how much of an assignment pool is in use.
+type PoolUtilization struct {
+	NetworkID string `json:"networkId"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	// Size is the number of addresses in the pool, saturated at
+	// math.MaxUint64 for very large IPv6 pools.
+	Size    uint64  `json:"size"`
+	Used    int     `json:"used"`
+	Percent float64 `json:"percent"`
+}
+
+// AddressPlanReport is the outcome of AnalyzeAddressPlan.
+type AddressPlanReport struct {
+	Issues []AddressIssue    `json:"issues"`
+	Pools  []PoolUtilization `json:"pools"`
+}
+
+// HasIssues reports whether any issue is at least as severe as s. CI jobs can
+// fail on HasIssues(SeverityError), or on warnings too.
+func (r *AddressPlanReport) HasIssues(s Severity) bool {
+	for _, i := range r.Issues {
+		if i.Severity >= s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteTo writes the report as human readable text.
+func (r *AddressPlanReport) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "%d issues\n", len(r.Issues))
+	for _, i := range r.Issues {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", i.Severity, i.Kind, i.NetworkID, i.Message)
+	}
+
+	fmt.Fprintf(tw, "\npool utilization\n")
+	for _, p := range r.Pools {
+		fmt.Fprintf(tw, "%s\t%s-%s\t%d/%d\t%.1f%%\n", p.NetworkID, p.Start, p.End, p.Used, p.Size, p.Percent)
+	}
+
+	return cw.result(tw.Flush())
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *AddressPlanReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// AnalyzeAddressPlan fetches every network and its members and analyzes them
+// with AnalyzeAddressPlan.
+func (c *Client) AnalyzeAddressPlan(ctx context.Context) (*AddressPlanReport, error) {
+	networks, err := c.GetNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[string][]*spec.Member{}
+	for _, n := range networks {
+		if members[*n.Id], err = c.GetMembers(ctx, *n.Id); err != nil {
+			return nil, fmt.Errorf("while reading members of %s: %w", *n.Id, err)
+		}
+	}
+
+	return AnalyzeAddressPlan(networks, members), nil
+}
+
+// AnalyzeAddressPlan checks the routes, pools and member IPs of the networks,
+// with members keyed by network ID, for:
+//
+//   - route targets overlapping between networks (error); default routes are
+//     ignored, as they overlap everything by design
+//   - IPs assigned to more than one member of a network (error)
+//   - pools outside every route target (warning)
+//   - member IPs outside every route target (warning)
+//
+// It also reports the utilization of every pool.
+func AnalyzeAddressPlan(networks []*spec.Network, members map[string][]*spec.Member) *AddressPlanReport {
+	r := &AddressPlanReport{Issues: []AddressIssue{}, Pools: []PoolUtilization{}}
+
+	type target struct {
+		networkID string
+		subnet    *net.IPNet
+	}
+
+	var targets []target
+
+	sorted := append([]*spec.Network{}, networks...)
+	sort.Slice(sorted, func(i, j int) bool { return stringv(sorted[i].Id) < stringv(sorted[j].Id) })
+
+	for _, n := range sorted {
+		networkID := stringv(n.Id)
+		routes := networkRoutes(n)
+
+		for _, subnet := range routes {
+			if isDefaultRoute(subnet) {
+				continue
+			}
+
+			for _, other := range targets {
+				if other.networkID != networkID && subnetsOverlap(subnet, other.subnet) {
+					r.Issues = append(r.Issues, AddressIssue{
+						Kind:           IssueSubnetOverlap,
+						Severity:       SeverityError,
+						NetworkID:      networkID,
+						OtherNetworkID: other.networkID,
+						Subnet:         subnet.String(),
+						OtherSubnet:    other.subnet.String(),
+						Message:        fmt.Sprintf("route %s overlaps %s of network %s", subnet, other.subnet, other.networkID),
+					})
+				}
+			}
+
+			targets = append(targets, target{networkID: networkID, subnet: subnet})
+		}
+
+		r.analyzeMembers(networkID, routes, members[networkID])
+		r.analyzePools(n, routes, members[networkID])
+	}
+
+	return r
+}
+
+func (r *AddressPlanReport) analyzeMembers(networkID string, routes []*net.IPNet, members []*spec.Member) {
+	owners := map[string][]string{}
+	var ips []string
+
+	for _, m := range members {
+		for _, ip := range memberIPs(m) {
+			key := ip.String()
+			if _, ok := owners[key]; !ok {
+				ips = append(ips, key)
+			}
+
+			owners[key] = append(owners[key], stringv(m.NodeId))
+
+			if !ipRouted(ip, routes) {
+				r.Issues = append(r.Issues, AddressIssue{
+					Kind:      IssueIPOutsideRoutes,
+					Severity:  SeverityWarning,
+					NetworkID: networkID,
+					IP:        key,
+					MemberIDs: []string{stringv(m.NodeId)},
+					Message:   fmt.Sprintf("member %s has %s, which is outside every route", stringv(m.NodeId), key),
+				})
+			}
+		}
+	}
+
+	for _, ip := range ips {
+		if len(owners[ip]) > 1 {
+			sort.Strings(owners[ip])
+			r.Issues = append(r.Issues, AddressIssue{
+				Kind:      IssueDuplicateIP,
+				Severity:  SeverityError,
+				NetworkID: networkID,
+				IP:        ip,
+				MemberIDs: owners[ip],
+				Message:   fmt.Sprintf("%s is assigned to %d members: %v", ip, len(owners[ip]), owners[ip]),
+			})
+		}
+	}
+}
+
+func (r *AddressPlanReport) analyzePools(n *spec.Network, routes []*net.IPNet, members []*spec.Member) {
+	if n.Config == nil || n.Config.IpAssignmentPools == nil {
+		return
+	}
+
+	networkID := stringv(n.Id)
+
+	for _, pool := range *n.Config.IpAssignmentPools {
+		start, end := net.ParseIP(stringv(pool.IpRangeStart)), net.ParseIP(stringv(pool.IpRangeEnd))
+		if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) || bytes.Compare(start.To16(), end.To16()) > 0 {
+			// malformed pools are ValidateNetwork's business.
+			continue
+		}
+
+		if !rangeRouted(start, end, routes) {
+			r.Issues = append(r.Issues, AddressIssue{
+				Kind:      IssueUncoveredPool,
+				Severity:  SeverityWarning,
+				NetworkID: networkID,
+				Subnet:    fmt.Sprintf("%s-%s", start, end),
+				Message:   fmt.Sprintf("pool %s-%s is not inside any route; no addresses will be assigned from it", start, end),
+			})
+		}
+
+		used := map[string]bool{}
+		for _, m := range members {
+			for _, ip := range memberIPs(m) {
+				if ipInRange(ip, start, end) {
+					used[ip.String()] = true
+				}
+			}
+		}
+
+		p := PoolUtilization{NetworkID: networkID, Start: start.String(), End: end.String(), Used: len(used)}
+
+		size := new(big.Int).Sub(new(big.Int).SetBytes(end.To16()), new(big.Int).SetBytes(start.To16()))
+		size.Add(size, big.NewInt(1))
+
+		if size.IsUint64() {
+			p.Size = size.Uint64()
+		} else {
+			p.Size = math.MaxUint64
+		}
+
+		p.Percent, _ = new(big.Float).Quo(new(big.Float).SetInt64(int64(p.Used*100)), new(big.Float).SetInt(size)).Float64()
+
+		r.Pools = append(r.Pools, p)
+	}
+}
+
+func networkRoutes(n *spec.Network) []*net.IPNet {
+	if n.Config == nil || n.Config.Routes == nil {
+		return nil
+	}
+
+	var res []*net.IPNet
+	for _, route := range *n.Config.Routes {
+		if _, subnet, err := net.ParseCIDR(stringv(route.Target)); err == nil {
+			res = append(res, subnet)
+		}
+	}
+
+	return res
+}
+
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func ipRouted(ip net.IP, routes []*net.IPNet) bool {
+	for _, route := range routes {
+		if route.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ipInRange(ip, start, end net.IP) bool {
+	if (ip.To4() == nil) != (start.To4() == nil) {
+		return false
+	}
+
+	return bytes.Compare(ip.To16(), start.To16()) >= 0 && bytes.Compare(ip.To16(), end.To16()) <= 0
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func planNetwork(id string, routes []string, pools [][2]string) *spec.Network {
+	n := &spec.Network{Id: stringp(id), Config: &spec.NetworkConfig{Routes: &[]spec.Route{}, IpAssignmentPools: &[]spec.IPRange{}}}
+
+	for _, target := range routes {
+		*n.Config.Routes = append(*n.Config.Routes, spec.Route{Target: stringp(target)})
+	}
+
+	for _, pool := range pools {
+		*n.Config.IpAssignmentPools = append(*n.Config.IpAssignmentPools, spec.IPRange{IpRangeStart: stringp(pool[0]), IpRangeEnd: stringp(pool[1])})
+	}
+
+	return n
+}
+
+func planMember(id string, ips ...string) *spec.Member {
+	return &spec.Member{NodeId: stringp(id), Config: &spec.MemberConfig{IpAssignments: &ips}}
+}
+
+func TestAnalyzeAddressPlan(t *testing.T) {
+	networks := []*spec.Network{
+		planNetwork("8056c2e21c000001", []string{"10.1.0.0/16"}, [][2]string{{"10.1.0.1", "10.1.0.4"}, {"10.9.0.1", "10.9.0.9"}}),
+		planNetwork("8056c2e21c000002", []string{"10.1.2.0/24", "0.0.0.0/0"}, nil),
+		planNetwork("8056c2e21c000003", []string{"10.3.0.0/16"}, [][2]string{{"fd00::1", "fd00::ffff:ffff:ffff:ffff"}}),
+	}
+
+	members := map[string][]*spec.Member{
+		"8056c2e21c000001": {
+			planMember("0000000001", "10.1.0.1"),
+			planMember("0000000002", "10.1.0.1", "10.1.0.2"),
+			planMember("0000000003", "192.168.1.1"),
+		},
+	}
+
+	r := AnalyzeAddressPlan(networks, members)
+
+	kinds := map[AddressIssueKind]int{}
+	for _, i := range r.Issues {
+		kinds[i.Kind]++
+	}
+
+	want := map[AddressIssueKind]int{
+		IssueSubnetOverlap:   1,
+		IssueDuplicateIP:     1,
+		IssueUncoveredPool:   2,
+		IssueIPOutsideRoutes: 1,
+	}
+
+	for kind, count := range want {
+		if kinds[kind] != count {
+			t.Fatalf("expected %d %s issues, got %v", count, kind, r.Issues)
+		}
+	}
+
+	for _, i := range r.Issues {
+		if i.Kind == IssueDuplicateIP && (i.IP != "10.1.0.1" || len(i.MemberIDs) != 2) {
+			t.Fatalf("unexpected duplicate: %+v", i)
+		}
+
+		if i.Kind == IssueSubnetOverlap && (i.NetworkID != "8056c2e21c000002" || i.OtherSubnet != "10.1.0.0/16") {
+			t.Fatalf("unexpected overlap: %+v", i)
+		}
+	}
+
+	if !r.HasIssues(SeverityError) {
+		t.Fatal("conflicts were not reported")
+	}
+
+	if len(r.Pools) != 3 || r.Pools[0].Size != 4 || r.Pools[0].Used != 2 || r.Pools[0].Percent != 50 {
+		t.Fatalf("unexpected pools: %+v", r.Pools)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := r.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "5 issues") || !strings.Contains(buf.String(), "50.0%") {
+		t.Fatalf("unexpected text report:\n%s", buf)
+	}
+
+	buf.Reset()
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := map[string][]map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded["issues"][1]["severity"] != "error" {
+		t.Fatalf("unexpected JSON report:\n%s", buf)
+	}
+
+	// the report reads back as it was written.
+	var read AddressPlanReport
+	if err := json.Unmarshal(buf.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&read, r) {
+		t.Fatalf("report did not round-trip:\n%+v\n%+v", read, r)
+	}
+
+	clean := AnalyzeAddressPlan(networks[:1], map[string][]*spec.Member{"8056c2e21c000001": {planMember("0000000001", "10.1.0.1")}})
+	if clean.HasIssues(SeverityError) || !clean.HasIssues(SeverityWarning) {
+		t.Fatalf("unexpected issues: %v", clean.Issues)
+	}
+}
+
+func TestClientAnalyzeAddressPlan(t *testing.T) {
+	c, fc := newFakeClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	a := fc.AddNetwork(planNetwork("8056c2e21c000001", []string{"10.1.0.0/16"}, nil))
+	fc.AddMember(*a.Id, planMember("0000000001", "10.1.0.1"))
+	fc.AddMember(*a.Id, planMember("0000000002", "10.1.0.1"))
+
+	r, err := c.AnalyzeAddressPlan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Issues) != 1 || r.Issues[0].Kind != IssueDuplicateIP {
+		t.Fatalf("unexpected issues: %v", r.Issues)
+	}
+}
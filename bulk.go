@@ -0,0 +1,187 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultBulkWorkers is the number of concurrent requests BulkUpdateMembers
+// makes when BulkOptions.Workers is not set.
+const DefaultBulkWorkers = 4
+
+// ErrBulkFailed is returned by BulkUpdateMembers when at least one update
+// failed. The per-member results describe what happened.
+var ErrBulkFailed = errors.New("bulk member update failed")
+
+// BulkMemberOp is a single update in a bulk operation. Member is the partial
+// member record sent to UpdateMember.
+type BulkMemberOp struct {
+	MemberID string
+	Member   *spec.Member
+}
+
+// AuthorizeOp returns an operation authorizing the member.
+func AuthorizeOp(memberID string) BulkMemberOp {
+	return BulkMemberOp{MemberID: memberID, Member: &spec.Member{Config: &spec.MemberConfig{Authorized: boolp(true)}}}
+}
+
+// DeauthorizeOp returns an operation deauthorizing the member.
+func DeauthorizeOp(memberID string) BulkMemberOp {
+	return BulkMemberOp{MemberID: memberID, Member: &spec.Member{Config: &spec.MemberConfig{Authorized: boolp(false)}}}
+}
+
+// BulkOptions control BulkUpdateMembers.
+type BulkOptions struct {
+	// Workers is the number of concurrent requests. It is additionally capped
+	// to the rate limit remaining at the start of the operation.
+	Workers int
+	// StopOnError stops starting new updates after the first failure.
+	StopOnError bool
+}
+
+// BulkResult is the outcome of a single BulkMemberOp.
+type BulkResult struct {
+	MemberID string
+	// Attempted is false if the update was never sent, because the operation
+	// was canceled or stopped on an earlier error.
+	Attempted bool
+	// Member is the member record returned by Central after the update.
+	Member *spec.Member
+	Err    error
+}
+
+// Success reports whether the update was sent and succeeded.
+func (r BulkResult) Success() bool {
+	return r.Attempted && r.Err == nil
+}
+
+// BulkUpdateMembers applies the operations to members of a network with
+// bounded concurrency. The results are in the same order as ops, and are
+// always returned, even on error, so callers can tell what was applied.
+//
+// When the context is canceled no new updates are started; the context's
+// error is returned. Otherwise, if any update failed, an error wrapping
+// ErrBulkFailed is returned.
+func (c *Client) BulkUpdateMembers(ctx context.Context, networkID string, ops []BulkMemberOp, opts BulkOptions) ([]BulkResult, error) {
+	results := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		results[i].MemberID = op.MemberID
+		if op.Member == nil {
+			return results, fmt.Errorf("operation for member %q has no update", op.MemberID)
+		}
+	}
+
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return results, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBulkWorkers
+	}
+
+	if limits := c.RateLimits(); limits.Limit != 0 && limits.Remaining > 0 && limits.Remaining < workers {
+		workers = limits.Remaining
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		stopped bool
+		failed  int
+		jobs    = make(chan int)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				mutex.Lock()
+				skip := stopped
+				mutex.Unlock()
+
+				// the job may have been handed over just before the stop or
+				// cancellation; don't start it.
+				if skip || ctx.Err() != nil {
+					continue
+				}
+
+				member, err := c.UpdateMember(ctx, networkID, ops[i].MemberID, ops[i].Member)
+
+				mutex.Lock()
+				results[i].Attempted = true
+				results[i].Member = member
+				results[i].Err = err
+				if err != nil {
+					failed++
+					stopped = stopped || opts.StopOnError
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range ops {
+		mutex.Lock()
+		stop := stopped
+		mutex.Unlock()
+
+		if stop {
+			break
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%w: %d of %d updates failed", ErrBulkFailed, failed, len(ops))
+	}
+
+	return results, nil
+}
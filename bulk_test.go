@@ -0,0 +1,164 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func addFakeMembers(t *testing.T, c *Client, networkID string, count int) []string {
+	var ids []string
+
+	for i := 1; i <= count; i++ {
+		id := fmt.Sprintf("%010x", i)
+		if _, err := c.UpdateMember(context.Background(), networkID, id, &spec.Member{Name: stringp(id)}); err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestBulkUpdateMembers(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+
+	var ops []BulkMemberOp
+	for _, id := range addFakeMembers(t, c, *n.Id, 50) {
+		ops = append(ops, AuthorizeOp(id))
+	}
+
+	results, err := c.BulkUpdateMembers(context.Background(), *n.Id, ops, BulkOptions{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, res := range results {
+		if !res.Success() || res.MemberID != ops[i].MemberID {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+
+		if !*res.Member.Config.Authorized || !*fc.Member(*n.Id, res.MemberID).Config.Authorized {
+			t.Fatalf("member %q was not authorized", res.MemberID)
+		}
+	}
+}
+
+func TestBulkUpdateMembersErrors(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	ids := addFakeMembers(t, c, *n.Id, 20)
+
+	fc.Fail = func(r *http.Request) int {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ids[4]) {
+			return http.StatusInternalServerError
+		}
+
+		return 0
+	}
+
+	var ops []BulkMemberOp
+	for _, id := range ids {
+		ops = append(ops, DeauthorizeOp(id))
+	}
+
+	results, err := c.BulkUpdateMembers(context.Background(), *n.Id, ops, BulkOptions{})
+	if !errors.Is(err, ErrBulkFailed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, res := range results {
+		if !res.Attempted || res.Success() == (i == 4) {
+			t.Fatalf("unexpected result for %d: %+v", i, res)
+		}
+	}
+
+	results, err = c.BulkUpdateMembers(context.Background(), *n.Id, ops, BulkOptions{Workers: 1, StopOnError: true})
+	if !errors.Is(err, ErrBulkFailed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, res := range results {
+		if res.Attempted != (i <= 4) {
+			t.Fatalf("unexpected result for %d: %+v", i, res)
+		}
+	}
+}
+
+func TestBulkUpdateMembersCancel(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	ids := addFakeMembers(t, c, *n.Id, 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int
+	fc.Fail = func(r *http.Request) int {
+		if requests++; requests == 3 {
+			cancel()
+			// give the canceled context a chance to be noticed before the
+			// response arrives.
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return 0
+	}
+
+	var ops []BulkMemberOp
+	for _, id := range ids {
+		ops = append(ops, AuthorizeOp(id))
+	}
+
+	results, err := c.BulkUpdateMembers(ctx, *n.Id, ops, BulkOptions{Workers: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var attempted int
+	for _, res := range results {
+		if res.Attempted {
+			attempted++
+		}
+	}
+
+	if attempted == 0 || attempted == len(ops) {
+		t.Fatalf("expected some but not all updates to be attempted, got %d", attempted)
+	}
+}
@@ -35,7 +35,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zerotier/go-ztcentral/pkg/spec"
@@ -53,9 +57,23 @@ type Client struct {
 	specClient *spec.Client
 	httpClient *http.Client
 
-	apiKey    string
-	userAgent string
-	limits    RateLimitHeaders
+	apiKey           string
+	userAgent        string
+	validateNetworks bool
+
+	waitInterval    time.Duration
+	waitMaxInterval time.Duration
+
+	limitsMutex sync.Mutex
+	limits      RateLimitHeaders
+
+	basePath  string
+	transport http.RoundTripper
+	observers []Observer
+	logger    Logger
+	logLevel  LogLevel
+
+	dryRun *DryRunLog
 }
 
 type RateLimitHeaders struct {
@@ -95,26 +113,74 @@ func newRateLimitHeaders(h http.Header) RateLimitHeaders {
 // ErrStatus is returned when the response code is not 200.
 var ErrStatus = errors.New("status code was not 200")
 
+// StatusError is returned when the response code is not 200. It wraps
+// ErrStatus, and carries the status code for callers that need to tell, for
+// instance, a missing record from a server error.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Status code %v: %v", e.StatusCode, ErrStatus)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrStatus
+}
+
+// IsNotFound reports whether err is a 404 from Central.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
 // NewClient creates a client.
 // key is an API key for your ZeroTier Central that you can generate after login.
 // It returns a fully initialized client.
 func NewClient(key string) (*Client, error) {
 	c := &Client{
-		apiKey:    key,
-		userAgent: userAgent,
+		apiKey:          key,
+		userAgent:       userAgent,
+		waitInterval:    DefaultWaitInterval,
+		waitMaxInterval: DefaultWaitMaxInterval,
 	}
 
 	c.httpClient = &http.Client{Transport: c}
 
-	var err error
-	c.specClient, err = spec.NewClient(BaseURLV1, spec.WithHTTPClient(c.httpClient))
-	if err != nil {
+	if err := c.SetBaseURL(BaseURLV1); err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
 
+// SetBaseURL points the client at a different Central API, such as a test
+// server. The default is BaseURLV1.
+func (c *Client) SetBaseURL(baseURL string) error {
+	sc, err := spec.NewClient(baseURL, spec.WithHTTPClient(c.httpClient))
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+
+	c.specClient = sc
+	c.basePath = strings.TrimSuffix(u.Path, "/")
+
+	return nil
+}
+
+// RateLimits returns the rate limit headers from the most recent response.
+func (c *Client) RateLimits() RateLimitHeaders {
+	c.limitsMutex.Lock()
+	defer c.limitsMutex.Unlock()
+
+	return c.limits
+}
+
 // SetUserAgent appends a custom user agent to the existing one, allowing
 // customization of it. It will be present where browsers typically put
 // extension data, such as Mozilla/5.0 (Firefox 80). The "Firefox 80" section
@@ -127,6 +193,21 @@ func (c *Client) SetUserAgent(ua string) {
 	c.userAgent = fmt.Sprintf("%s (%s)", c.userAgent, ua)
 }
 
+// SetNetworkValidation enables or disables running ValidateNetwork before
+// NewNetwork and UpdateNetwork send anything to Central. When enabled, networks
+// with error-level problems are rejected with an error wrapping
+// ErrInvalidNetwork; warnings are not fatal. It is disabled by default.
+func (c *Client) SetNetworkValidation(enabled bool) {
+	c.validateNetworks = enabled
+}
+
+// SetTransport sends the client's requests through rt instead of
+// http.DefaultTransport, such as testutil.Recorder to record or replay them.
+// The client still sets the headers and handles rate limits.
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.transport = rt
+}
+
 // RoundTrip conforms the client to http.RoundTrip
 func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("User-Agent", c.userAgent)
@@ -134,25 +215,104 @@ func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Accept", "application/json; charset=utf-8")
 	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", c.apiKey))
 
-	if c.limits.Limit != 0 && c.limits.Remaining < c.limits.Limit {
-		diff := time.Now().Add(time.Duration(c.limits.Limit-c.limits.Remaining) * 10 * time.Millisecond).Sub(time.Now())
-		time.Sleep(diff)
+	// the dry-run methods never get here with a change; anything else that
+	// would change something is not sent either.
+	if c.dryRun != nil && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		c.dryRunRequest(req)
+		return nil, ErrDryRun
 	}
 
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	if len(c.observers) == 0 && c.logLevel == LogOff {
+		return c.roundTrip(req, RequestInfo{})
+	}
+
+	info := c.requestInfo(req)
+	call := &call{info: info}
+
+	ctx := context.WithValue(req.Context(), callKey{}, call)
+	for _, o := range c.observers {
+		ctx = o.OnRequest(ctx, info)
+	}
+
+	req = req.WithContext(ctx)
+	if err := c.logRequest(ctx, req, info); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.roundTrip(req, info)
+	duration := time.Since(start)
+
+	c.logResponse(ctx, req, info, resp, err, duration)
+
+	ri := ResponseInfo{Err: err, Duration: duration, Retries: int(atomic.LoadInt32(&call.retries)), RateLimit: c.RateLimits()}
+	if resp != nil {
+		ri.StatusCode = resp.StatusCode
+	}
+
+	for _, o := range c.observers {
+		o.OnResponse(ctx, info, ri)
+	}
+
+	return resp, err
+}
+
+// roundTrip sends the request, waiting for the rate limit first.
+func (c *Client) roundTrip(req *http.Request, info RequestInfo) (*http.Response, error) {
+	ctx := req.Context()
+
+	if limits := c.RateLimits(); limits.Limit != 0 && limits.Remaining < limits.Limit {
+		delay := time.Duration(limits.Limit-limits.Remaining) * 10 * time.Millisecond
+		for _, o := range c.observers {
+			o.OnRateLimitWait(ctx, info, delay)
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := c.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
 
 	a := newRateLimitHeaders(resp.Header)
 
+	c.limitsMutex.Lock()
 	c.limits = a
+	c.limitsMutex.Unlock()
 
-	return resp, err
+	return resp, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *Client) decode(resp *http.Response, i interface{}) error {
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("Status code %v: %w", resp.StatusCode, ErrStatus)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
-	defer resp.Body.Close()
 
 	return json.NewDecoder(resp.Body).Decode(i)
 }
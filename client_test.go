@@ -45,3 +45,38 @@ func TestUser(t *testing.T) {
 		t.Fatal("UserID was nil or empty")
 	}
 }
+
+// newFakeClient returns a client talking to a FakeCentral that is shut down
+// when the test finishes.
+func newFakeClient(t *testing.T) (*Client, *testutil.FakeCentral) {
+	fc := testutil.NewFakeCentral()
+	t.Cleanup(fc.Close)
+
+	c, err := NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	return c, fc
+}
+
+// newLiveClient returns a client for a test written against the live Central,
+// recording or replaying it as testutil.UseCassette decides.
+func newLiveClient(t *testing.T) *Client {
+	token, rec := testutil.UseCassette(t)
+
+	c, err := NewClient(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec != nil {
+		c.SetTransport(rec)
+	}
+
+	return c
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command ztcentral-exporter serves ZeroTier Central network and member
+// metrics to Prometheus.
+//
+// The API key is read from the ZEROTIER_CENTRAL_API_KEY environment variable,
+// or from the profile named by -profile or ZTCENTRAL_PROFILE in the ztcentral
+// config file. Central is read once per -cache-ttl in the background, and
+// scrapes are served from that cache.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/exporter"
+)
+
+// APIKeyEnv is the environment variable holding the API key.
+const APIKeyEnv = "ZEROTIER_CENTRAL_API_KEY"
+
+func main() {
+	listen := flag.String("listen", ":9810", "address to serve /metrics on")
+	profile := flag.String("profile", "", "config profile to use instead of "+APIKeyEnv)
+	networks := flag.String("networks", "", "comma separated network IDs to export (default all)")
+	cacheTTL := flag.Duration("cache-ttl", exporter.DefaultCacheTTL, "how often to read Central")
+	threshold := flag.Duration("online-threshold", ztcentral.DefaultOnlineThreshold, "how recently a member must have been online to count as online")
+	flag.Parse()
+
+	c, err := newClient(*profile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c.SetUserAgent("ztcentral-exporter")
+
+	opts := exporter.Options{CacheTTL: *cacheTTL, OnlineThreshold: *threshold}
+	if *networks != "" {
+		opts.NetworkIDs = strings.Split(*networks, ",")
+	}
+
+	col := exporter.NewCollector(c, opts)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(col, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	go col.Run(context.Background())
+
+	http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{Addr: *listen, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("serving metrics on %s/metrics", *listen)
+	log.Fatal(srv.ListenAndServe())
+}
+
+func newClient(profile string) (*ztcentral.Client, error) {
+	if key := os.Getenv(APIKeyEnv); key != "" && profile == "" && os.Getenv(ztcentral.ProfileEnv) == "" {
+		return ztcentral.NewClient(key)
+	}
+
+	return ztcentral.NewClientFromProfile(profile)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+)
+
+// loadProfile reads the profile named by -profile or ZTCENTRAL_PROFILE, or
+// the config file's default, from the same file NewClientFromProfile reads.
+// A missing default config file means no credentials were configured at all.
+func (a *app) loadProfile() (*ztcentral.Profile, error) {
+	path := a.configFile
+	if path == "" {
+		path = a.defaultConfigPath()
+	}
+
+	cfg, err := ztcentral.LoadConfig(path)
+	if os.IsNotExist(err) && a.configFile == "" && a.profileName() == "" {
+		return nil, fmt.Errorf("no API key: set %s, pass -api-key-file, or configure a profile in %s", APIKeyEnv, path)
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", path, err)
+	}
+
+	p, err := cfg.SelectProfile(a.profile, a.getenv)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// profileName is the profile named by -profile or ZTCENTRAL_PROFILE, if any.
+func (a *app) profileName() string {
+	if a.profile != "" {
+		return a.profile
+	}
+
+	return a.getenv(ztcentral.ProfileEnv)
+}
+
+func (a *app) defaultConfigPath() string {
+	return ztcentral.ConfigPath(a.getenv)
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Command ztcentral manages ZeroTier Central networks, members, tokens and
+// organizations from the command line.
+//
+// The API key is read from the file named by -api-key-file, then from the
+// profile named by -profile or ZTCENTRAL_PROFILE, then from the
+// ZEROTIER_CENTRAL_API_KEY environment variable, and finally from the default
+// profile of the config file. The config file is the one read by
+// ztcentral.NewClientFromProfile; a profile's defaults.output replaces the
+// table format when -o is not given.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+)
+
+// APIKeyEnv is the environment variable holding the API key.
+const APIKeyEnv = "ZEROTIER_CENTRAL_API_KEY"
+
+// errUsage is returned by commands called with the wrong arguments.
+var errUsage = errors.New("invalid usage")
+
+type app struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+
+	format     string
+	formatSet  bool
+	profile    string
+	apiKeyFile string
+	configFile string
+	baseURL    string
+
+	client *ztcentral.Client
+}
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(a *app, args []string) error
+	sub   []*command
+}
+
+var commands = []*command{
+	{name: "status", help: "show the account status", run: runStatus},
+	networkCommand,
+	memberCommand,
+	tokenCommand,
+	orgCommand,
+	inviteCommand,
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	a := &app{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr, getenv: getenv}
+
+	fs := flag.NewFlagSet("ztcentral", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&a.format, "o", "table", "output format: table, json or yaml")
+	fs.StringVar(&a.profile, "profile", "", "config profile to use")
+	fs.StringVar(&a.apiKeyFile, "api-key-file", "", "file containing the API key")
+	fs.StringVar(&a.configFile, "config", "", "config file (default "+a.defaultConfigPath()+")")
+	fs.StringVar(&a.baseURL, "url", "", "Central API URL (default "+ztcentral.BaseURLV1+")")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ztcentral [flags] <command> ...\n\ncommands:\n")
+		printCommands(stderr, "", commands)
+		fmt.Fprintf(stderr, "\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if !validFormat(a.format) {
+		fmt.Fprintf(stderr, "unknown output format %q\n", a.format)
+		return 2
+	}
+
+	fs.Visit(func(f *flag.Flag) { a.formatSet = a.formatSet || f.Name == "o" })
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := dispatch(a, commands, nil, fs.Args()); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return 1
+		}
+
+		return 2
+	}
+
+	return 0
+}
+
+func dispatch(a *app, cmds []*command, path []string, args []string) error {
+	prefix := strings.Join(path, " ")
+
+	if len(args) == 0 {
+		fmt.Fprintf(a.stderr, "usage: ztcentral %s <command> ...\n\ncommands:\n", prefix)
+		printCommands(a.stderr, prefix, cmds)
+		return errUsage
+	}
+
+	for _, cmd := range cmds {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		path = append(path, cmd.name)
+
+		if cmd.sub != nil {
+			return dispatch(a, cmd.sub, path, args[1:])
+		}
+
+		err := cmd.run(a, args[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(a.stderr, "usage: ztcentral %s %s\n", strings.Join(path, " "), cmd.usage)
+		}
+
+		return err
+	}
+
+	fmt.Fprintf(a.stderr, "unknown command %q\n", strings.TrimSpace(prefix+" "+args[0]))
+	return errUsage
+}
+
+func printCommands(w io.Writer, prefix string, cmds []*command) {
+	for _, cmd := range cmds {
+		name := strings.TrimSpace(prefix + " " + cmd.name)
+
+		if cmd.sub != nil {
+			printCommands(w, name, cmd.sub)
+			continue
+		}
+
+		fmt.Fprintf(w, "  %-40s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+}
+
+// flags returns a flag set for a command, parsed by parse.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+// parse parses the command's flags and checks it got between min and max
+// positional arguments; max < 0 means no limit.
+func (a *app) parse(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		return nil, errUsage
+	}
+
+	return fs.Args(), nil
+}
+
+// central returns the client, creating it on first use.
+func (a *app) central() (*ztcentral.Client, error) {
+	if a.client != nil {
+		return a.client, nil
+	}
+
+	key, baseURL, err := a.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ztcentral.NewClient(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetUserAgent("ztcentral-cli")
+
+	if baseURL != "" {
+		if err := c.SetBaseURL(baseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	a.client = c
+	return c, nil
+}
+
+func (a *app) credentials() (string, string, error) {
+	baseURL := a.baseURL
+
+	if a.apiKeyFile != "" {
+		key, err := readKeyFile(a.apiKeyFile)
+		return key, baseURL, err
+	}
+
+	if key := a.getenv(APIKeyEnv); key != "" && a.profileName() == "" {
+		return key, baseURL, nil
+	}
+
+	p, err := a.loadProfile()
+	if err != nil {
+		return "", "", err
+	}
+
+	if baseURL == "" {
+		baseURL = p.URL
+	}
+
+	if !a.formatSet && p.Defaults.Output != "" {
+		if !validFormat(p.Defaults.Output) {
+			return "", "", fmt.Errorf("profile has unknown output format %q", p.Defaults.Output)
+		}
+
+		a.format = p.Defaults.Output
+	}
+
+	key, err := p.Token.Resolve(a.ctx, a.getenv)
+	if err != nil {
+		return "", "", fmt.Errorf("profile token: %w", err)
+	}
+
+	return key, baseURL, nil
+}
+
+func validFormat(format string) bool {
+	switch format {
+	case "table", "json", "yaml":
+		return true
+	}
+
+	return false
+}
+
+func readKeyFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+
+	return key, nil
+}
+
+// readInput reads a file, or stdin if path is "-".
+func (a *app) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(a.stdin)
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+func runStatus(a *app, args []string) error {
+	if _, err := a.parse(a.flags("status"), args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	status, err := c.Status(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{
+		{"version", str(status.Version)},
+		{"api version", str(status.ApiVersion)},
+		{"read only", boolStr(status.ReadOnlyMode)},
+	}
+
+	if status.User != nil {
+		rows = append(rows,
+			[]string{"user id", str(status.User.Id)},
+			[]string{"user email", str(status.User.Email)},
+			[]string{"user name", str(status.User.DisplayName)},
+		)
+	}
+
+	return a.print(status, []string{"field", "value"}, rows)
+}
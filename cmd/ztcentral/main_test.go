@@ -0,0 +1,266 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+type cli struct {
+	t   *testing.T
+	fc  *testutil.FakeCentral
+	env map[string]string
+}
+
+func newCLI(t *testing.T) *cli {
+	fc := testutil.NewFakeCentral()
+	t.Cleanup(fc.Close)
+
+	return &cli{t: t, fc: fc, env: map[string]string{APIKeyEnv: "fake-token", "HOME": "/nonexistent"}}
+}
+
+// run runs the command and returns its exit code and output.
+func (c *cli) run(stdin string, args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	args = append([]string{"-url", c.fc.BaseURL()}, args...)
+
+	code := run(context.Background(), args, strings.NewReader(stdin), stdout, stderr, func(k string) string { return c.env[k] })
+	return code, stdout.String(), stderr.String()
+}
+
+// ok runs the command and fails the test unless it succeeds.
+func (c *cli) ok(args ...string) string {
+	code, stdout, stderr := c.run("", args...)
+	if code != 0 {
+		c.t.Fatalf("%v exited %d: %s", args, code, stderr)
+	}
+
+	return stdout
+}
+
+func TestNetworkCommands(t *testing.T) {
+	c := newCLI(t)
+
+	out := c.ok("-o", "json", "network", "create", "-private=false", "lab")
+
+	n := &spec.Network{}
+	if err := json.Unmarshal([]byte(out), n); err != nil {
+		t.Fatal(err)
+	}
+
+	if *n.Config.Name != "lab" || *n.Config.Private {
+		t.Fatalf("unexpected network: %s", out)
+	}
+
+	if out := c.ok("network", "list"); !strings.Contains(out, *n.Id) || !strings.Contains(out, "lab") {
+		t.Fatalf("network missing from list:\n%s", out)
+	}
+
+	c.ok("network", "update", "-name", "lab-2", "-private", *n.Id)
+	if stored := c.fc.Network(*n.Id); *stored.Config.Name != "lab-2" || !*stored.Config.Private {
+		t.Fatalf("network was not updated: %+v", stored.Config)
+	}
+
+	if code, _, _ := c.run("accept;\n", "network", "rules", "set", *n.Id, "-"); code != 0 {
+		t.Fatal("could not set rules")
+	}
+
+	if out := c.ok("network", "rules", "get", *n.Id); out != "accept;\n" {
+		t.Fatalf("unexpected rules: %q", out)
+	}
+
+	if out := c.ok("-o", "yaml", "network", "get", *n.Id); !strings.Contains(out, "rulesSource: |") && !strings.Contains(out, "rulesSource: \"accept;\\n\"") {
+		t.Fatalf("unexpected yaml:\n%s", out)
+	}
+
+	c.ok("network", "delete", *n.Id)
+	if c.fc.Network(*n.Id) != nil {
+		t.Fatal("network was not deleted")
+	}
+}
+
+func TestMemberCommands(t *testing.T) {
+	c := newCLI(t)
+
+	n := c.fc.AddNetwork(&spec.Network{TagsByName: &map[string]interface{}{
+		"role": map[string]interface{}{"id": 10, "enums": map[string]interface{}{"web": 1, "db": 2}},
+	}})
+
+	c.fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001"), Config: &spec.MemberConfig{Tags: &[][]interface{}{{5, 5}}}})
+	c.fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002")})
+
+	c.ok("member", "authorize", *n.Id, "0000000001", "0000000002")
+	c.ok("member", "deauthorize", *n.Id, "0000000002")
+	c.ok("member", "rename", *n.Id, "0000000001", "web-1")
+	c.ok("member", "set-ip", *n.Id, "0000000001", "10.0.0.1", "10.0.0.2")
+	c.ok("member", "tag", *n.Id, "0000000001", "role", "db")
+
+	m := c.fc.Member(*n.Id, "0000000001")
+	if !*m.Config.Authorized || *m.Name != "web-1" || len(*m.Config.IpAssignments) != 2 {
+		t.Fatalf("member was not updated: %+v", m)
+	}
+
+	if len(*m.Config.Tags) != 2 {
+		t.Fatalf("unexpected tags: %v", *m.Config.Tags)
+	}
+
+	out := c.ok("member", "list", "-query", "tag.role=db", *n.Id)
+	if !strings.Contains(out, "web-1") || strings.Contains(out, "0000000002") {
+		t.Fatalf("unexpected list:\n%s", out)
+	}
+
+	out = c.ok("-o", "json", "member", "list", "-query", "authorized=false fields=nodeId", *n.Id)
+	if strings.TrimSpace(out) != "[\n  {\n    \"nodeId\": \"0000000002\"\n  }\n]" {
+		t.Fatalf("unexpected projection:\n%s", out)
+	}
+
+	c.ok("member", "delete", *n.Id, "0000000002")
+	if c.fc.Member(*n.Id, "0000000002") != nil {
+		t.Fatal("member was not deleted")
+	}
+}
+
+func TestTokenAndInviteCommands(t *testing.T) {
+	c := newCLI(t)
+
+	c.ok("token", "create", "-token", strings.Repeat("a", 32), "ci")
+	c.ok("token", "rotate", "-new-name", "ci-2", "ci")
+
+	tokens := c.fc.Tokens()
+	if _, ok := tokens["ci"]; ok || len(tokens["ci-2"]) < 32 {
+		t.Fatalf("token was not rotated: %v", tokens)
+	}
+
+	out := c.ok("-o", "json", "invite", "create", "new@example.com")
+
+	inv := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(out), &inv); err != nil {
+		t.Fatal(err)
+	}
+
+	if inv["status"] != "pending" {
+		t.Fatalf("unexpected invitation: %s", out)
+	}
+
+	c.ok("invite", "accept", inv["id"].(string))
+
+	if out := c.ok("invite", "list"); !strings.Contains(out, "accepted") {
+		t.Fatalf("unexpected invitations:\n%s", out)
+	}
+
+	if out := c.ok("org", "get"); !strings.Contains(out, testutil.FakeOrgID) {
+		t.Fatalf("unexpected org:\n%s", out)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	c := newCLI(t)
+	c.fc.Token = "profile-token"
+
+	dir, err := ioutil.TempDir("", "ztcentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("profile-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := filepath.Join(dir, "config.yaml")
+	content := "default: env\nprofiles:\n  env:\n    token: wrong\n  work:\n    token:\n      file: " + keyFile + "\n    defaults:\n      output: json\n  lab:\n    token:\n      env: LAB_TOKEN\n"
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment key is wrong.
+	if code, _, _ := c.run("", "status"); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+
+	c.ok("-api-key-file", keyFile, "status")
+	if out := c.ok("-config", config, "-profile", "work", "status"); !strings.HasPrefix(out, "{") {
+		t.Fatalf("expected the profile's JSON output, got:\n%s", out)
+	}
+
+	// env token sources read the command's environment.
+	c.env["LAB_TOKEN"] = "profile-token"
+	c.ok("-config", config, "-profile", "lab", "status")
+	delete(c.env, "LAB_TOKEN")
+
+	c.env[ztcentral.ProfileEnv] = "work"
+	c.ok("-config", config, "-o", "table", "status")
+	delete(c.env, ztcentral.ProfileEnv)
+
+	delete(c.env, APIKeyEnv)
+	if code, _, _ := c.run("", "-config", config, "status"); code != 1 {
+		t.Fatalf("expected the default profile's wrong key to fail, got %d", code)
+	}
+
+	if code, _, stderr := c.run("", "status"); code != 1 || !strings.Contains(stderr, "no API key") {
+		t.Fatalf("expected the no API key hint, got %d: %s", code, stderr)
+	}
+
+	missing := filepath.Join(dir, "missing.yaml")
+	if code, _, stderr := c.run("", "-config", missing, "status"); code != 1 || !strings.Contains(stderr, "while reading "+missing) {
+		t.Fatalf("expected the missing config to be reported, got %d: %s", code, stderr)
+	}
+
+	if err := ioutil.WriteFile(config, []byte("defualt: work\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, stderr := c.run("", "-config", config, "status"); code != 1 || !strings.Contains(stderr, "defualt") {
+		t.Fatalf("expected the config error, got %d: %s", code, stderr)
+	}
+
+	if code, _, stderr := c.run("", "network", "get"); code != 2 || !strings.Contains(stderr, "usage: ztcentral network get <network>") {
+		t.Fatalf("expected usage, got %d: %s", code, stderr)
+	}
+
+	if code, _, _ := c.run("", "bogus"); code != 2 {
+		t.Fatalf("expected usage, got %d", code)
+	}
+}
+
+func stringp(s string) *string {
+	return &s
+}
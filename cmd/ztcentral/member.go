@@ -0,0 +1,268 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+var memberCommand = &command{
+	name: "member",
+	sub: []*command{
+		{name: "list", usage: "[-query q] <network>", help: "list members, optionally filtered by a member query", run: runMemberList},
+		{name: "get", usage: "<network> <member>", help: "show a member", run: runMemberGet},
+		{name: "authorize", usage: "<network> <member>...", help: "authorize members", run: runMemberAuthorize},
+		{name: "deauthorize", usage: "<network> <member>...", help: "deauthorize members", run: runMemberDeauthorize},
+		{name: "rename", usage: "<network> <member> <name>", help: "rename a member", run: runMemberRename},
+		{name: "delete", usage: "<network> <member>", help: "delete a member", run: runMemberDelete},
+		{name: "set-ip", usage: "<network> <member> [ip]...", help: "replace the member's IPs; none clears them", run: runMemberSetIP},
+		{name: "tag", usage: "<network> <member> <tag> <value>", help: "set a tag, by name or ID", run: runMemberTag},
+	},
+}
+
+var memberHeader = []string{"network", "node id", "name", "authorized", "ips", "last online", "version"}
+
+func memberRow(m *spec.Member) []string {
+	row := []string{str(m.NetworkId), str(m.NodeId), str(m.Name), "-", "-", msStr(m.LastOnline), str(m.ClientVersion)}
+
+	if m.Config != nil {
+		row[3] = boolStr(m.Config.Authorized)
+		row[4] = listStr(m.Config.IpAssignments)
+	}
+
+	return row
+}
+
+func (a *app) printMembers(members []*spec.Member) error {
+	var rows [][]string
+	for _, m := range members {
+		rows = append(rows, memberRow(m))
+	}
+
+	return a.print(members, memberHeader, rows)
+}
+
+func (a *app) printMember(m *spec.Member) error {
+	return a.print(m, memberHeader, [][]string{memberRow(m)})
+}
+
+func runMemberList(a *app, args []string) error {
+	fs := a.flags("member list")
+	query := fs.String("query", "", "member query, e.g. \"authorized=false sort=-lastOnline\"")
+
+	pos, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	members, err := c.GetMembers(a.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	if *query != "" {
+		var n *spec.Network
+		if n, err = c.GetNetwork(a.ctx, pos[0]); err != nil {
+			return err
+		}
+
+		q, err := ztcentral.ParseMemberQuery(*query, n)
+		if err != nil {
+			return err
+		}
+
+		members = q.Apply(members)
+
+		if len(q.Fields) > 0 && a.format != "table" {
+			return a.print(q.Project(members), nil, nil)
+		}
+	}
+
+	return a.printMembers(members)
+}
+
+func runMemberGet(a *app, args []string) error {
+	pos, err := a.parse(a.flags("member get"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	m, err := c.GetMember(a.ctx, pos[0], pos[1])
+	if err != nil {
+		return err
+	}
+
+	return a.printMember(m)
+}
+
+func runMemberAuthorize(a *app, args []string) error {
+	return a.bulkMembers("member authorize", args, ztcentral.AuthorizeOp)
+}
+
+func runMemberDeauthorize(a *app, args []string) error {
+	return a.bulkMembers("member deauthorize", args, ztcentral.DeauthorizeOp)
+}
+
+func (a *app) bulkMembers(name string, args []string, op func(string) ztcentral.BulkMemberOp) error {
+	pos, err := a.parse(a.flags(name), args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	var ops []ztcentral.BulkMemberOp
+	for _, id := range pos[1:] {
+		ops = append(ops, op(id))
+	}
+
+	results, err := c.BulkUpdateMembers(a.ctx, pos[0], ops, ztcentral.BulkOptions{})
+
+	var members []*spec.Member
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(a.stderr, "%s: %v\n", r.MemberID, r.Err)
+		} else if r.Member != nil {
+			members = append(members, r.Member)
+		}
+	}
+
+	if perr := a.printMembers(members); perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+func runMemberRename(a *app, args []string) error {
+	pos, err := a.parse(a.flags("member rename"), args, 3, 3)
+	if err != nil {
+		return err
+	}
+
+	return a.updateMember(pos[0], pos[1], &spec.Member{Name: &pos[2]})
+}
+
+func runMemberDelete(a *app, args []string) error {
+	pos, err := a.parse(a.flags("member delete"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteMember(a.ctx, pos[0], pos[1])
+}
+
+func runMemberSetIP(a *app, args []string) error {
+	pos, err := a.parse(a.flags("member set-ip"), args, 2, -1)
+	if err != nil {
+		return err
+	}
+
+	ips := append([]string{}, pos[2:]...)
+	return a.updateMember(pos[0], pos[1], &spec.Member{Config: &spec.MemberConfig{IpAssignments: &ips}})
+}
+
+func runMemberTag(a *app, args []string) error {
+	pos, err := a.parse(a.flags("member tag"), args, 4, 4)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	n, err := c.GetNetwork(a.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	id, value, err := ztcentral.ResolveTag(n, pos[2], pos[3])
+	if err != nil {
+		return err
+	}
+
+	m, err := c.GetMember(a.ctx, pos[0], pos[1])
+	if err != nil {
+		return err
+	}
+
+	// Central replaces the whole tag list, so carry the other tags over.
+	tags := [][]interface{}{}
+	if m.Config != nil && m.Config.Tags != nil {
+		for _, tag := range *m.Config.Tags {
+			if len(tag) == 2 && fmt.Sprint(tag[0]) == strconv.Itoa(id) {
+				continue
+			}
+
+			tags = append(tags, tag)
+		}
+	}
+
+	tags = append(tags, []interface{}{id, value})
+
+	return a.updateMember(pos[0], pos[1], &spec.Member{Config: &spec.MemberConfig{Tags: &tags}})
+}
+
+func (a *app) updateMember(networkID, memberID string, m *spec.Member) error {
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	res, err := c.UpdateMember(a.ctx, networkID, memberID, m)
+	if err != nil {
+		return err
+	}
+
+	return a.printMember(res)
+}
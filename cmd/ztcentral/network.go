@@ -0,0 +1,273 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+var networkCommand = &command{
+	name: "network",
+	sub: []*command{
+		{name: "list", help: "list networks", run: runNetworkList},
+		{name: "get", usage: "<network>", help: "show a network", run: runNetworkGet},
+		{name: "create", usage: "[-private=false] [-description d] <name>", help: "create a network", run: runNetworkCreate},
+		{name: "update", usage: "[-name n] [-description d] [-private bool] [-file network.json] <network>", help: "update a network", run: runNetworkUpdate},
+		{name: "delete", usage: "<network>", help: "delete a network", run: runNetworkDelete},
+		{name: "rules", sub: []*command{
+			{name: "get", usage: "<network>", help: "print the rules source", run: runNetworkRulesGet},
+			{name: "set", usage: "<network> <file|->", help: "set the rules source from a file", run: runNetworkRulesSet},
+		}},
+	},
+}
+
+var networkHeader = []string{"id", "name", "private", "authorized", "members", "created"}
+
+func networkRow(n *spec.Network) []string {
+	row := []string{str(n.Id), "-", "-", intStr(n.AuthorizedMemberCount), intStr(n.TotalMemberCount), "-"}
+
+	if n.Config != nil {
+		row[1] = str(n.Config.Name)
+		row[2] = boolStr(n.Config.Private)
+		row[5] = msStr(n.Config.CreationTime)
+	}
+
+	return row
+}
+
+func runNetworkList(a *app, args []string) error {
+	if _, err := a.parse(a.flags("network list"), args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	networks, err := c.GetNetworks(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, n := range networks {
+		rows = append(rows, networkRow(n))
+	}
+
+	return a.print(networks, networkHeader, rows)
+}
+
+func runNetworkGet(a *app, args []string) error {
+	pos, err := a.parse(a.flags("network get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	n, err := c.GetNetwork(a.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	return a.printNetwork(n)
+}
+
+func (a *app) printNetwork(n *spec.Network) error {
+	rows := [][]string{networkRow(n)}
+	return a.print(n, networkHeader, rows)
+}
+
+func runNetworkCreate(a *app, args []string) error {
+	fs := a.flags("network create")
+	private := fs.Bool("private", true, "make the network private")
+	description := fs.String("description", "", "network description")
+
+	pos, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	n := &spec.Network{Config: &spec.NetworkConfig{Private: private}}
+	if *description != "" {
+		n.Description = description
+	}
+
+	res, err := c.NewNetwork(a.ctx, pos[0], n)
+	if err != nil {
+		return err
+	}
+
+	return a.printNetwork(res)
+}
+
+func runNetworkUpdate(a *app, args []string) error {
+	fs := a.flags("network update")
+
+	var (
+		name, description optionalString
+		private           optionalBool
+	)
+
+	fs.Var(&name, "name", "network name")
+	fs.Var(&description, "description", "network description")
+	fs.Var(&private, "private", "make the network private")
+	file := fs.String("file", "", "JSON network update to apply first, or - for stdin")
+
+	pos, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	n := &spec.Network{}
+
+	if *file != "" {
+		content, err := a.readInput(*file)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(content, n); err != nil {
+			return fmt.Errorf("while reading %s: %w", *file, err)
+		}
+	}
+
+	if n.Config == nil {
+		n.Config = &spec.NetworkConfig{}
+	}
+
+	if name.set {
+		n.Config.Name = &name.value
+	}
+
+	if description.set {
+		n.Description = &description.value
+	}
+
+	if private.set {
+		n.Config.Private = &private.value
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	res, err := c.UpdateNetwork(a.ctx, pos[0], n)
+	if err != nil {
+		return err
+	}
+
+	return a.printNetwork(res)
+}
+
+func runNetworkDelete(a *app, args []string) error {
+	pos, err := a.parse(a.flags("network delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteNetwork(a.ctx, pos[0])
+}
+
+func runNetworkRulesGet(a *app, args []string) error {
+	pos, err := a.parse(a.flags("network rules get"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	n, err := c.GetNetwork(a.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	if a.format != "table" {
+		return a.print(map[string]interface{}{"rulesSource": n.RulesSource}, nil, nil)
+	}
+
+	source := ""
+	if n.RulesSource != nil {
+		source = *n.RulesSource
+	}
+
+	if !strings.HasSuffix(source, "\n") {
+		source += "\n"
+	}
+
+	_, err = fmt.Fprint(a.stdout, source)
+	return err
+}
+
+func runNetworkRulesSet(a *app, args []string) error {
+	pos, err := a.parse(a.flags("network rules set"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	content, err := a.readInput(pos[1])
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	source := string(content)
+	res, err := c.UpdateNetwork(a.ctx, pos[0], &spec.Network{RulesSource: &source})
+	if err != nil {
+		return err
+	}
+
+	return a.printNetwork(res)
+}
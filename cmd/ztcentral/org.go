@@ -0,0 +1,208 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+var orgCommand = &command{
+	name: "org",
+	sub: []*command{
+		{name: "get", help: "show your organization", run: runOrgGet},
+		{name: "members", help: "list the members of your organization", run: runOrgMembers},
+	},
+}
+
+var inviteCommand = &command{
+	name: "invite",
+	sub: []*command{
+		{name: "list", help: "list organization invitations", run: runInviteList},
+		{name: "get", usage: "<invitation>", help: "show an invitation", run: runInviteGet},
+		{name: "create", usage: "<email>", help: "invite a user to your organization", run: runInviteCreate},
+		{name: "accept", usage: "<invitation>", help: "accept an invitation", run: runInviteAccept},
+		{name: "decline", usage: "<invitation>", help: "decline an invitation", run: runInviteDecline},
+	},
+}
+
+var orgMemberHeader = []string{"user id", "name", "email"}
+
+func orgMemberRow(m *spec.OrganizationMember) []string {
+	return []string{str(m.UserId), str(m.Name), str(m.Email)}
+}
+
+func runOrgGet(a *app, args []string) error {
+	if _, err := a.parse(a.flags("org get"), args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	org, err := c.GetOrganization(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{
+		{"id", str(org.Id)},
+		{"owner id", str(org.OwnerId)},
+		{"owner email", str(org.OwnerEmail)},
+	}
+
+	return a.print(org, []string{"field", "value"}, rows)
+}
+
+func runOrgMembers(a *app, args []string) error {
+	if _, err := a.parse(a.flags("org members"), args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	org, err := c.GetOrganization(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	members, err := c.GetOrganizationMembers(a.ctx, *org.Id)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, m := range members {
+		rows = append(rows, orgMemberRow(m))
+	}
+
+	return a.print(members, orgMemberHeader, rows)
+}
+
+var invitationHeader = []string{"id", "email", "status", "created"}
+
+// invitationView flattens the invitation status, which the generated type
+// nests in an object.
+type invitationView struct {
+	ID           string            `json:"id"`
+	OrgID        string            `json:"orgId"`
+	Email        string            `json:"email"`
+	Status       spec.InviteStatus `json:"status"`
+	CreationTime *int64            `json:"creation_time,omitempty"`
+	UpdateTime   *int64            `json:"update_time,omitempty"`
+}
+
+func newInvitationView(inv *spec.OrganizationInvitation) *invitationView {
+	return &invitationView{
+		ID:           str(inv.Id),
+		OrgID:        str(inv.OrgId),
+		Email:        str(inv.Email),
+		Status:       ztcentral.InvitationStatus(inv),
+		CreationTime: inv.CreationTime,
+		UpdateTime:   inv.UpdateTime,
+	}
+}
+
+func (a *app) printInvitations(invitations []*spec.OrganizationInvitation) error {
+	views := []*invitationView{}
+	var rows [][]string
+
+	for _, inv := range invitations {
+		v := newInvitationView(inv)
+		views = append(views, v)
+		rows = append(rows, []string{v.ID, v.Email, string(v.Status), msStr(v.CreationTime)})
+	}
+
+	return a.print(views, invitationHeader, rows)
+}
+
+func (a *app) printInvitation(inv *spec.OrganizationInvitation) error {
+	v := newInvitationView(inv)
+	return a.print(v, invitationHeader, [][]string{{v.ID, v.Email, string(v.Status), msStr(v.CreationTime)}})
+}
+
+func runInviteList(a *app, args []string) error {
+	if _, err := a.parse(a.flags("invite list"), args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	invitations, err := c.GetInvitations(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.printInvitations(invitations)
+}
+
+func runInviteGet(a *app, args []string) error {
+	return a.invitationCall("invite get", args, (*ztcentral.Client).GetInvitation)
+}
+
+func runInviteCreate(a *app, args []string) error {
+	return a.invitationCall("invite create", args, (*ztcentral.Client).InviteUser)
+}
+
+func runInviteAccept(a *app, args []string) error {
+	return a.invitationCall("invite accept", args, (*ztcentral.Client).AcceptInvitation)
+}
+
+func runInviteDecline(a *app, args []string) error {
+	return a.invitationCall("invite decline", args, (*ztcentral.Client).DeclineInvitation)
+}
+
+func (a *app) invitationCall(name string, args []string, call func(*ztcentral.Client, context.Context, string) (*spec.OrganizationInvitation, error)) error {
+	pos, err := a.parse(a.flags(name), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	inv, err := call(c, a.ctx, pos[0])
+	if err != nil {
+		return err
+	}
+
+	return a.printInvitation(inv)
+}
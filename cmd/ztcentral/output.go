@@ -0,0 +1,169 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// print writes v as JSON or YAML, or the rows as a table.
+func (a *app) print(v interface{}, header []string, rows [][]string) error {
+	switch a.format {
+	case "json":
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		// round trip through JSON, so the YAML has the API's field names.
+		content, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		var generic interface{}
+		if err := json.Unmarshal(content, &generic); err != nil {
+			return err
+		}
+
+		content, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+
+		_, err = a.stdout.Write(content)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 8, 2, ' ', 0)
+
+	if header != nil {
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	}
+
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func str(s *string) string {
+	if s == nil || *s == "" {
+		return "-"
+	}
+
+	return *s
+}
+
+func boolStr(b *bool) string {
+	if b == nil {
+		return "-"
+	}
+
+	return strconv.FormatBool(*b)
+}
+
+func intStr(i *int) string {
+	if i == nil {
+		return "-"
+	}
+
+	return strconv.Itoa(*i)
+}
+
+func msStr(ms *int64) string {
+	if ms == nil || *ms == 0 {
+		return "-"
+	}
+
+	return time.Unix(0, *ms*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+func listStr(l *[]string) string {
+	if l == nil || len(*l) == 0 {
+		return "-"
+	}
+
+	return strings.Join(*l, ",")
+}
+
+// optionalBool is a bool flag that remembers whether it was set.
+type optionalBool struct {
+	set   bool
+	value bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+
+	return strconv.FormatBool(b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	b.set, b.value = true, v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool {
+	return true
+}
+
+// optionalString is a string flag that remembers whether it was set, so it
+// can be set to "".
+type optionalString struct {
+	set   bool
+	value string
+}
+
+func (s *optionalString) String() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.value
+}
+
+func (s *optionalString) Set(v string) error {
+	s.set, s.value = true, v
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var tokenCommand = &command{
+	name: "token",
+	sub: []*command{
+		{name: "create", usage: "[-token t] <name>", help: "create an API token; a random one is generated and printed if not given", run: runTokenCreate},
+		{name: "delete", usage: "<name>", help: "delete an API token", run: runTokenDelete},
+		{name: "rotate", usage: "[-new-name n] <name>", help: "create a new token, then delete the old one", run: runTokenRotate},
+	},
+}
+
+func runTokenCreate(a *app, args []string) error {
+	fs := a.flags("token create")
+	token := fs.String("token", "", "token to create, at least 32 characters")
+
+	pos, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.createToken(pos[0], *token)
+}
+
+func (a *app) createToken(name, token string) error {
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	user, err := c.User(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		if token, err = c.RandomToken(a.ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := c.CreateAPIToken(a.ctx, *user.Id, name, token); err != nil {
+		return err
+	}
+
+	return a.print(map[string]string{"tokenName": name, "token": token}, []string{"name", "token"}, [][]string{{name, token}})
+}
+
+func runTokenDelete(a *app, args []string) error {
+	pos, err := a.parse(a.flags("token delete"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	user, err := c.User(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteAPIToken(a.ctx, *user.Id, pos[0])
+}
+
+func runTokenRotate(a *app, args []string) error {
+	fs := a.flags("token rotate")
+	newName := fs.String("new-name", "", "name of the new token (default <name>-<timestamp>)")
+
+	pos, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if *newName == "" {
+		*newName = fmt.Sprintf("%s-%s", pos[0], time.Now().UTC().Format("20060102150405"))
+	}
+
+	// the new token exists before the old one goes away, so a failure here
+	// never leaves the account without a working token.
+	if err := a.createToken(*newName, ""); err != nil {
+		return err
+	}
+
+	c, err := a.central()
+	if err != nil {
+		return err
+	}
+
+	user, err := c.User(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteAPIToken(a.ctx, *user.Id, pos[0]); err != nil {
+		return fmt.Errorf("created %s, but could not delete %s: %w", *newName, pos[0], err)
+	}
+
+	return nil
+}
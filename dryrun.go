@@ -0,0 +1,573 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DryRunNetworkIDPrefix starts the placeholder IDs of networks created in
+// dry-run mode, in place of a controller ID.
+const DryRunNetworkIDPrefix = "ffffffffff"
+
+// ErrDryRun is returned for a request that would change something in Central
+// but that the client has no plan for, when it is in dry-run mode. The
+// request is recorded and not sent.
+var ErrDryRun = errors.New("request not sent in dry-run mode")
+
+// DryRunOperation is a change a client in dry-run mode did not send.
+type DryRunOperation struct {
+	// Operation is the API operation, such as "UpdateNetworkMember".
+	Operation string
+	Method    string
+	// Path is relative to the base URL, e.g. "/network/8056c2e21c000001".
+	Path      string
+	NetworkID string
+	MemberID  string
+	// Body is the request body that would have been sent, with secrets
+	// redacted.
+	Body string
+	// Summary describes the operation, e.g. "delete member 0123456789 of
+	// network 8056c2e21c000001".
+	Summary string
+	// Changes lists the fields that would change, as "config.private: true
+	// -> false", sorted by field.
+	Changes []string
+}
+
+// DryRunLog records the operations of a client in dry-run mode, and the state
+// they would leave behind, so that later calls build on earlier ones: a member
+// authorized and then renamed is returned both authorized and renamed, and a
+// network created in the plan can be updated in it.
+type DryRunLog struct {
+	mutex    sync.Mutex
+	ops      []DryRunOperation
+	created  int
+	networks map[string]*spec.Network
+	members  map[string]*spec.Member
+}
+
+// SetDryRun puts the client in dry-run mode: NewNetwork, UpdateNetwork,
+// UpdateNetworkRules, DeleteNetwork, UpdateMember, DeleteMember,
+// CreateAPIToken, DeleteAPIToken, InviteUser, AcceptInvitation and
+// DeclineInvitation (and the helpers built on them) send nothing to Central,
+// and instead record the request in log and return the current state merged
+// with the change. Any other request that is not a GET is recorded too, and
+// fails with ErrDryRun. Reads are still sent. A nil log turns dry-run mode
+// off.
+func (c *Client) SetDryRun(log *DryRunLog) {
+	c.dryRun = log
+}
+
+// Operations returns the operations recorded so far, in order.
+func (l *DryRunLog) Operations() []DryRunOperation {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]DryRunOperation(nil), l.ops...)
+}
+
+// Reset forgets the recorded operations and planned state.
+func (l *DryRunLog) Reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ops = nil
+	l.created = 0
+	l.networks = nil
+	l.members = nil
+}
+
+// WriteTo writes a human readable summary of the recorded operations.
+func (l *DryRunLog) WriteTo(w io.Writer) (int64, error) {
+	ops := l.Operations()
+	cw := &countWriter{w: w}
+
+	fmt.Fprintf(cw, "dry run: %d operations not sent\n", len(ops))
+
+	for i, op := range ops {
+		fmt.Fprintf(cw, "%d. %s (%s %s)\n", i+1, op.Summary, op.Method, op.Path)
+
+		for _, change := range op.Changes {
+			fmt.Fprintf(cw, "     %s\n", change)
+		}
+	}
+
+	return cw.result(nil)
+}
+
+func (l *DryRunLog) record(op DryRunOperation, body interface{}) {
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err == nil {
+			op.Body = redactBody(RequestInfo{Operation: op.Operation}, content)
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ops = append(l.ops, op)
+}
+
+// plannedNetwork returns the planned state of the network, and whether the
+// plan has touched it at all.
+func (l *DryRunLog) plannedNetwork(id string) (*spec.Network, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	n, ok := l.networks[id]
+	return n, ok
+}
+
+func (l *DryRunLog) plannedMember(networkID, memberID string) (*spec.Member, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if n, ok := l.networks[networkID]; ok && n == nil {
+		return nil, true
+	}
+
+	m, ok := l.members[networkID+"/"+memberID]
+	return m, ok
+}
+
+func (l *DryRunLog) setNetwork(id string, n *spec.Network) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.networks == nil {
+		l.networks = map[string]*spec.Network{}
+	}
+
+	l.networks[id] = n
+}
+
+func (l *DryRunLog) setMember(networkID, memberID string, m *spec.Member) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.members == nil {
+		l.members = map[string]*spec.Member{}
+	}
+
+	l.members[networkID+"/"+memberID] = m
+}
+
+func (l *DryRunLog) nextNetworkID() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.created++
+	return fmt.Sprintf("%s%06x", DryRunNetworkIDPrefix, l.created)
+}
+
+// currentNetwork returns the network as the plan has left it, or as Central
+// has it.
+func (c *Client) currentNetwork(ctx context.Context, id string) (*spec.Network, error) {
+	if n, ok := c.dryRun.plannedNetwork(id); ok {
+		if n == nil {
+			return nil, &StatusError{StatusCode: http.StatusNotFound}
+		}
+
+		return n, nil
+	}
+
+	if strings.HasPrefix(id, DryRunNetworkIDPrefix) {
+		return nil, &StatusError{StatusCode: http.StatusNotFound}
+	}
+
+	return c.GetNetwork(ctx, id)
+}
+
+// currentMember is currentNetwork for members.
+func (c *Client) currentMember(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	if m, ok := c.dryRun.plannedMember(networkID, memberID); ok {
+		if m == nil {
+			return nil, &StatusError{StatusCode: http.StatusNotFound}
+		}
+
+		return m, nil
+	}
+
+	if strings.HasPrefix(networkID, DryRunNetworkIDPrefix) {
+		return nil, &StatusError{StatusCode: http.StatusNotFound}
+	}
+
+	return c.GetMember(ctx, networkID, memberID)
+}
+
+func (c *Client) dryRunNewNetwork(n *spec.Network) (*spec.Network, error) {
+	id := c.dryRun.nextNetworkID()
+
+	before := &spec.Network{Id: &id, Config: &spec.NetworkConfig{Id: &id}}
+
+	res, err := copyNetwork(before)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mergeJSON(res, n); err != nil {
+		return nil, err
+	}
+
+	c.dryRun.setNetwork(id, res)
+	c.dryRun.record(DryRunOperation{
+		Operation: "NewNetwork",
+		Method:    http.MethodPost,
+		Path:      "/network",
+		NetworkID: id,
+		Summary:   fmt.Sprintf("create network %q as %s", stringv(n.Config.Name), id),
+		Changes:   diffJSON(before, res),
+	}, n)
+
+	return copyNetwork(res)
+}
+
+func (c *Client) dryRunUpdateNetwork(ctx context.Context, id string, n *spec.Network, summary string) (*spec.Network, error) {
+	cur, err := c.currentNetwork(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := copyNetwork(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mergeJSON(res, n); err != nil {
+		return nil, err
+	}
+
+	c.dryRun.setNetwork(id, res)
+	c.dryRun.record(DryRunOperation{
+		Operation: "UpdateNetwork",
+		Method:    http.MethodPost,
+		Path:      "/network/" + id,
+		NetworkID: id,
+		Summary:   summary,
+		Changes:   diffJSON(cur, res),
+	}, n)
+
+	return copyNetwork(res)
+}
+
+func (c *Client) dryRunDeleteNetwork(ctx context.Context, id string) error {
+	if _, err := c.currentNetwork(ctx, id); err != nil {
+		return err
+	}
+
+	c.dryRun.setNetwork(id, nil)
+	c.dryRun.record(DryRunOperation{
+		Operation: "DeleteNetwork",
+		Method:    http.MethodDelete,
+		Path:      "/network/" + id,
+		NetworkID: id,
+		Summary:   "delete network " + id,
+	}, nil)
+
+	return nil
+}
+
+func (c *Client) dryRunUpdateMember(ctx context.Context, networkID, memberID string, m *spec.Member) (*spec.Member, error) {
+	summary := fmt.Sprintf("update member %s of network %s", memberID, networkID)
+
+	// Central creates members that have not joined yet when they are
+	// updated, so a missing member starts out empty.
+	cur, err := c.currentMember(ctx, networkID, memberID)
+	if IsNotFound(err) {
+		if _, err := c.currentNetwork(ctx, networkID); err != nil {
+			return nil, err
+		}
+
+		id := networkID + "-" + memberID
+		cur = &spec.Member{Id: &id, NetworkId: &networkID, NodeId: &memberID}
+		summary = fmt.Sprintf("create member %s of network %s", memberID, networkID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := &spec.Member{}
+	if err := mergeJSON(res, cur); err != nil {
+		return nil, err
+	}
+
+	if err := mergeJSON(res, m); err != nil {
+		return nil, err
+	}
+
+	c.dryRun.setMember(networkID, memberID, res)
+	c.dryRun.record(DryRunOperation{
+		Operation: "UpdateNetworkMember",
+		Method:    http.MethodPost,
+		Path:      "/network/" + networkID + "/member/" + memberID,
+		NetworkID: networkID,
+		MemberID:  memberID,
+		Summary:   summary,
+		Changes:   diffJSON(cur, res),
+	}, m)
+
+	out := &spec.Member{}
+	return out, mergeJSON(out, res)
+}
+
+func (c *Client) dryRunDeleteMember(ctx context.Context, networkID, memberID string) error {
+	if _, err := c.currentMember(ctx, networkID, memberID); err != nil {
+		return err
+	}
+
+	c.dryRun.setMember(networkID, memberID, nil)
+	c.dryRun.record(DryRunOperation{
+		Operation: "DeleteNetworkMember",
+		Method:    http.MethodDelete,
+		Path:      "/network/" + networkID + "/member/" + memberID,
+		NetworkID: networkID,
+		MemberID:  memberID,
+		Summary:   fmt.Sprintf("delete member %s of network %s", memberID, networkID),
+	}, nil)
+
+	return nil
+}
+
+func (c *Client) dryRunCreateAPIToken(userID, name, token string) {
+	c.dryRun.record(DryRunOperation{
+		Operation: "AddAPIToken",
+		Method:    http.MethodPost,
+		Path:      "/user/" + userID + "/token",
+		Summary:   fmt.Sprintf("create API token %q for user %s", name, userID),
+	}, spec.AddAPITokenJSONRequestBody{Token: &token, TokenName: &name})
+}
+
+func (c *Client) dryRunDeleteAPIToken(userID, name string) {
+	c.dryRun.record(DryRunOperation{
+		Operation: "DeleteAPIToken",
+		Method:    http.MethodDelete,
+		Path:      "/user/" + userID + "/token/" + name,
+		Summary:   fmt.Sprintf("delete API token %q of user %s", name, userID),
+	}, nil)
+}
+
+func (c *Client) dryRunInviteUser(email string) *spec.OrganizationInvitation {
+	c.dryRun.record(DryRunOperation{
+		Operation: "InviteUserByEmail",
+		Method:    http.MethodPost,
+		Path:      "/org-invitation",
+		Summary:   "invite " + email + " to the organization",
+	}, spec.InviteUserByEmailJSONRequestBody{Email: &email})
+
+	return withInviteStatus(&spec.OrganizationInvitation{Email: &email}, spec.InviteStatusPending)
+}
+
+func (c *Client) dryRunAnswerInvitation(ctx context.Context, inviteID string, status spec.InviteStatus) (*spec.OrganizationInvitation, error) {
+	cur, err := c.GetInvitation(ctx, inviteID)
+	if err != nil {
+		return nil, err
+	}
+
+	op := DryRunOperation{
+		Operation: "AcceptInvitation",
+		Method:    http.MethodPost,
+		Path:      "/org-invitation/" + inviteID,
+		Summary:   "accept invitation " + inviteID,
+		Changes:   []string{formatChange("status", fmt.Sprintf("%q", InvitationStatus(cur)), fmt.Sprintf("%q", status))},
+	}
+
+	if status != spec.InviteStatusAccepted {
+		op.Operation = "DeclineInvitation"
+		op.Method = http.MethodDelete
+		op.Summary = "decline invitation " + inviteID
+	}
+
+	c.dryRun.record(op, nil)
+
+	res := *cur
+	return withInviteStatus(&res, status), nil
+}
+
+// dryRunRequest records a request that no dry-run method planned for.
+func (c *Client) dryRunRequest(req *http.Request) {
+	info := c.requestInfo(req)
+
+	op := DryRunOperation{
+		Operation: info.Operation,
+		Method:    info.Method,
+		Path:      info.Path,
+		NetworkID: info.NetworkID,
+		MemberID:  info.MemberID,
+		Summary:   "unplanned request",
+	}
+
+	if info.Operation != "" {
+		op.Summary = "unplanned " + info.Operation + " request"
+	}
+
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err == nil && len(body) > 0 {
+			op.Body = redactBody(info, body)
+		}
+	}
+
+	c.dryRun.record(op, nil)
+}
+
+func copyNetwork(n *spec.Network) (*spec.Network, error) {
+	res := &spec.Network{}
+	return res, mergeJSON(res, n)
+}
+
+// mergeJSON merges the JSON encoding of update into dst the way Central
+// applies an update: objects are merged, everything else is replaced, and
+// null values, which the generated types send for every unset field, are
+// ignored.
+func mergeJSON(dst, update interface{}) error {
+	cur, err := toJSONMap(dst)
+	if err != nil {
+		return err
+	}
+
+	changes, err := toJSONMap(update)
+	if err != nil {
+		return err
+	}
+
+	mergeMaps(cur, changes)
+
+	content, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, dst)
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			continue
+		}
+
+		sub, ok := v.(map[string]interface{})
+		if cur, isMap := dst[k].(map[string]interface{}); ok && isMap {
+			mergeMaps(cur, sub)
+			continue
+		}
+
+		dst[k] = v
+	}
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	return m, json.Unmarshal(content, &m)
+}
+
+// diffJSON lists the fields that differ between before and after, with
+// secrets redacted. Objects are compared field by field; anything else,
+// including lists, as a whole.
+func diffJSON(before, after interface{}) []string {
+	b, err := toJSONMap(before)
+	if err != nil {
+		return nil
+	}
+
+	a, err := toJSONMap(after)
+	if err != nil {
+		return nil
+	}
+
+	old, updated := map[string]string{}, map[string]string{}
+	flattenJSON("", b, old)
+	flattenJSON("", a, updated)
+
+	var changes []string
+
+	for k, v := range updated {
+		if old[k] != v {
+			changes = append(changes, formatChange(k, old[k], v))
+		}
+	}
+
+	for k, v := range old {
+		if _, ok := updated[k]; !ok {
+			changes = append(changes, formatChange(k, v, ""))
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+func flattenJSON(prefix string, m map[string]interface{}, res map[string]string) {
+	for k, v := range m {
+		key := prefix + k
+
+		switch v := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			flattenJSON(key+".", v, res)
+		default:
+			content, _ := json.Marshal(v)
+			res[key] = string(content)
+		}
+	}
+}
+
+func formatChange(key, old, updated string) string {
+	if old == "" {
+		old = "null"
+	}
+
+	if updated == "" {
+		updated = "null"
+	}
+
+	if secretFields[key[strings.LastIndex(key, ".")+1:]] {
+		old, updated = Redacted, Redacted
+	}
+
+	return fmt.Sprintf("%s: %s -> %s", key, old, updated)
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestDryRun(t *testing.T) {
+	c, fc := newFakeClient(t)
+	ctx := context.Background()
+
+	n := fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{Name: stringp("prod"), Private: boolp(true)}})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001"), Name: stringp("web")})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002")})
+
+	inv, err := c.InviteUser(ctx, "ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := len(fc.Requests())
+
+	log := &DryRunLog{}
+	c.SetDryRun(log)
+
+	net, err := c.UpdateNetwork(ctx, *n.Id, &spec.Network{Config: &spec.NetworkConfig{Private: boolp(false)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *net.Config.Private || *net.Config.Name != "prod" {
+		t.Fatalf("unexpected network: %+v", net.Config)
+	}
+
+	if _, err := c.UpdateNetworkRules(ctx, *n.Id, "accept;"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AuthorizeMember(ctx, *n.Id, "0000000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second update builds on the first.
+	m, err := c.UpdateMember(ctx, *n.Id, "0000000001", &spec.Member{Name: stringp("web-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !*m.Config.Authorized || *m.Name != "web-1" || *m.NodeId != "0000000001" {
+		t.Fatalf("unexpected member: %+v", m)
+	}
+
+	if err := c.DeleteMember(ctx, *n.Id, "0000000002"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetMember(ctx, *n.Id, "0000000002"); err != nil {
+		t.Fatal("member was deleted from central")
+	}
+
+	if err := c.DeleteMember(ctx, *n.Id, "0000000002"); !IsNotFound(err) {
+		t.Fatalf("expected the planned deletion to be seen, got %v", err)
+	}
+
+	created, err := c.NewNetwork(ctx, "staging", &spec.Network{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(*created.Id, DryRunNetworkIDPrefix) || *created.Config.Name != "staging" {
+		t.Fatalf("unexpected network: %+v", created)
+	}
+
+	if _, err := c.CreateAuthorizedMember(ctx, *created.Id, "0000000003", "db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteNetwork(ctx, *created.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CreateAPIToken(ctx, "user", "ci", strings.Repeat("s", 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.DeleteAPIToken(ctx, "user", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	planned, err := c.InviteUser(ctx, "dev@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *planned.Email != "dev@example.com" || InvitationStatus(planned) != spec.InviteStatusPending {
+		t.Fatalf("unexpected invitation: %+v", planned)
+	}
+
+	accepted, err := c.AcceptInvitation(ctx, *inv.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if InvitationStatus(accepted) != spec.InviteStatusAccepted {
+		t.Fatalf("unexpected invitation: %+v", accepted)
+	}
+
+	if _, err := c.DeclineInvitation(ctx, *inv.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AcceptInvitation(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("expected a missing invitation to be seen, got %v", err)
+	}
+
+	// requests without a dry-run method are not sent either.
+	if _, err := c.specClient.DeleteUserByID(ctx, "user"); !errors.Is(err, ErrDryRun) {
+		t.Fatalf("expected ErrDryRun, got %v", err)
+	}
+
+	if stored := fc.Invitation(*inv.Id); stored.Status != "pending" {
+		t.Fatalf("invitation was changed in central: %+v", stored)
+	}
+
+	for _, req := range fc.Requests()[sent:] {
+		if !strings.HasPrefix(req, "GET ") {
+			t.Fatalf("dry run sent %s", req)
+		}
+	}
+
+	if stored := fc.Member(*n.Id, "0000000001"); stored.Name == nil || *stored.Name != "web" {
+		t.Fatalf("member was changed in central: %+v", stored)
+	}
+
+	ops := log.Operations()
+	if len(ops) != 14 {
+		t.Fatalf("expected 14 operations, got %d", len(ops))
+	}
+
+	if ops[0].Operation != "UpdateNetwork" || len(ops[0].Changes) != 1 || ops[0].Changes[0] != "config.private: true -> false" {
+		t.Fatalf("unexpected operation: %+v", ops[0])
+	}
+
+	if ops[8].Operation != "AddAPIToken" || strings.Contains(ops[8].Body, "sss") || !strings.Contains(ops[8].Body, Redacted) {
+		t.Fatalf("token was not redacted: %+v", ops[8])
+	}
+
+	if ops[13].Operation != "DeleteUserByID" || ops[13].Method != "DELETE" || ops[13].Path != "/user/user" {
+		t.Fatalf("unexpected operation: %+v", ops[13])
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := log.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := log.WriteTo(&failingWriter{limit: 10}); !errors.Is(err, errWriteFailed) || n != 10 {
+		t.Fatalf("expected the write error after 10 bytes, got %d, %v", n, err)
+	}
+
+	for _, s := range []string{
+		"dry run: 14 operations not sent",
+		"2. update rules of network " + *n.Id,
+		"4. update member 0000000001 of network " + *n.Id + " (POST /network/" + *n.Id + "/member/0000000001)\n     name: \"web\" -> \"web-1\"",
+		"5. delete member 0000000002",
+		"create member 0000000003 of network " + *created.Id,
+		"create API token \"ci\" for user user",
+		"11. invite dev@example.com to the organization (POST /org-invitation)",
+		"12. accept invitation " + *inv.Id + " (POST /org-invitation/" + *inv.Id + ")\n     status: \"pending\" -> \"accepted\"",
+		"13. decline invitation " + *inv.Id + " (DELETE /org-invitation/" + *inv.Id + ")",
+		"14. unplanned DeleteUserByID request (DELETE /user/user)",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("summary is missing %q:\n%s", s, buf.String())
+		}
+	}
+
+	c.SetDryRun(nil)
+
+	if _, err := c.AuthorizeMember(ctx, *n.Id, "0000000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := fc.Member(*n.Id, "0000000001"); !*stored.Config.Authorized {
+		t.Fatal("member was not authorized after leaving dry-run mode")
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// expiryAnnotation is appended to the member description to record when an
+// authorization expires. Keeping it in Central means nothing is lost when the
+// process sweeping expirations restarts.
+var expiryAnnotation = regexp.MustCompile(`\s*\[ztcentral:expires=([^\]]*)\]`)
+
+// ParseExpiry returns the expiry recorded in a member description.
+func ParseExpiry(description string) (time.Time, bool) {
+	match := expiryAnnotation.FindStringSubmatch(description)
+	if match == nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, match[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// SetExpiry returns the description with its expiry annotation set to t,
+// replacing any existing one.
+func SetExpiry(description string, t time.Time) string {
+	annotation := fmt.Sprintf("[ztcentral:expires=%s]", t.UTC().Format(time.RFC3339))
+
+	description = ClearExpiry(description)
+	if description == "" {
+		return annotation
+	}
+
+	return description + " " + annotation
+}
+
+// ClearExpiry returns the description without its expiry annotation.
+func ClearExpiry(description string) string {
+	return strings.TrimSpace(expiryAnnotation.ReplaceAllString(description, ""))
+}
+
+// MemberExpiry returns the member's authorization expiry, if it has one.
+func MemberExpiry(m *spec.Member) (time.Time, bool) {
+	return ParseExpiry(stringv(m.Description))
+}
+
+// AuthorizeMemberFor authorizes a member until d from now, recording the
+// expiry in the member description. Use an ExpirySweeper (or SweepExpired) to
+// deauthorize it once the time has passed.
+func (c *Client) AuthorizeMemberFor(ctx context.Context, networkID, memberID string, d time.Duration) (*spec.Member, error) {
+	return c.setExpiry(ctx, networkID, memberID, func(time.Time, bool) time.Time { return time.Now().Add(d) })
+}
+
+// ExtendAuthorization pushes a member's expiry back by d. Members without an
+// expiry, or whose expiry has passed, are extended from now.
+func (c *Client) ExtendAuthorization(ctx context.Context, networkID, memberID string, d time.Duration) (*spec.Member, error) {
+	return c.setExpiry(ctx, networkID, memberID, func(cur time.Time, ok bool) time.Time {
+		if !ok || cur.Before(time.Now()) {
+			cur = time.Now()
+		}
+
+		return cur.Add(d)
+	})
+}
+
+func (c *Client) setExpiry(ctx context.Context, networkID, memberID string, expiry func(time.Time, bool) time.Time) (*spec.Member, error) {
+	// members that have never joined may not exist yet; that is fine, as
+	// updating them creates them.
+	description := ""
+	if m, err := c.GetMember(ctx, networkID, memberID); err == nil {
+		description = stringv(m.Description)
+	} else if !IsNotFound(err) {
+		return nil, err
+	}
+
+	return c.UpdateMember(ctx, networkID, memberID, &spec.Member{
+		Description: stringp(SetExpiry(description, expiry(ParseExpiry(description)))),
+		Config:      &spec.MemberConfig{Authorized: boolp(true)},
+	})
+}
+
+// RevokeAuthorization deauthorizes a member immediately and removes its
+// expiry.
+func (c *Client) RevokeAuthorization(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	return c.clearExpiry(ctx, networkID, memberID, &spec.MemberConfig{Authorized: boolp(false)})
+}
+
+// MakeAuthorizationPermanent removes a member's expiry, leaving its
+// authorization as it is.
+func (c *Client) MakeAuthorizationPermanent(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	return c.clearExpiry(ctx, networkID, memberID, nil)
+}
+
+func (c *Client) clearExpiry(ctx context.Context, networkID, memberID string, config *spec.MemberConfig) (*spec.Member, error) {
+	m, err := c.GetMember(ctx, networkID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.UpdateMember(ctx, networkID, memberID, &spec.Member{
+		Description: stringp(ClearExpiry(stringv(m.Description))),
+		Config:      config,
+	})
+}
+
+// Expiration is a member with an authorization expiry.
+type Expiration struct {
+	NetworkID string
+	MemberID  string
+	Name      string
+	Expires   time.Time
+	// Err is set by SweepExpired if deauthorizing the member failed.
+	Err error
+}
+
+// Expirations returns the authorized members with an expiry, soonest first.
+func Expirations(networkID string, members []*spec.Member) []Expiration {
+	var res []Expiration
+
+	for _, m := range members {
+		t, ok := MemberExpiry(m)
+		if !ok || m.Config == nil || !boolv(m.Config.Authorized) {
+			continue
+		}
+
+		res = append(res, Expiration{NetworkID: networkID, MemberID: stringv(m.NodeId), Name: stringv(m.Name), Expires: t})
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Expires.Before(res[j].Expires) })
+	return res
+}
+
+// ListExpirations returns the network's members with an expiring
+// authorization, soonest first.
+func (c *Client) ListExpirations(ctx context.Context, networkID string) ([]Expiration, error) {
+	members, err := c.GetMembers(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	return Expirations(networkID, members), nil
+}
+
+// UpcomingExpirations returns the expirations before the given time.
+func UpcomingExpirations(expirations []Expiration, before time.Time) []Expiration {
+	var res []Expiration
+	for _, e := range expirations {
+		if e.Expires.Before(before) {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+// SweepExpired deauthorizes the network's members whose authorization has
+// expired, and removes their expiry. Members that fail to deauthorize keep
+// their expiry, so the next sweep tries again. The expired members are
+// returned, with Err set on failures.
+func (c *Client) SweepExpired(ctx context.Context, networkID string) ([]Expiration, error) {
+	members, err := c.GetMembers(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*spec.Member{}
+	for _, m := range members {
+		byID[stringv(m.NodeId)] = m
+	}
+
+	expired := UpcomingExpirations(Expirations(networkID, members), time.Now())
+
+	for i := range expired {
+		e := &expired[i]
+		if err := ctx.Err(); err != nil {
+			return expired[:i], err
+		}
+
+		_, e.Err = c.UpdateMember(ctx, networkID, e.MemberID, &spec.Member{
+			Description: stringp(ClearExpiry(stringv(byID[e.MemberID].Description))),
+			Config:      &spec.MemberConfig{Authorized: boolp(false)},
+		})
+	}
+
+	return expired, nil
+}
+
+// ExpirySweeper periodically runs SweepExpired.
+type ExpirySweeper struct {
+	Client *Client
+	// NetworkIDs to sweep; empty sweeps every network.
+	NetworkIDs []string
+	// Interval between sweeps; it defaults to a minute.
+	Interval time.Duration
+	// OnExpire, if set, is called for every expired member.
+	OnExpire func(e Expiration)
+	// OnError, if set, is called when a sweep of a network fails.
+	OnError func(networkID string, err error)
+}
+
+// Run sweeps immediately and then every interval, until the context is
+// canceled.
+func (s *ExpirySweeper) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *ExpirySweeper) sweep(ctx context.Context) {
+	ids := s.NetworkIDs
+	if len(ids) == 0 {
+		networks, err := s.Client.GetNetworks(ctx)
+		if err != nil {
+			s.error("", err)
+			return
+		}
+
+		for _, n := range networks {
+			ids = append(ids, stringv(n.Id))
+		}
+	}
+
+	for _, id := range ids {
+		expired, err := s.Client.SweepExpired(ctx, id)
+		if err != nil {
+			s.error(id, err)
+		}
+
+		if s.OnExpire != nil {
+			for _, e := range expired {
+				s.OnExpire(e)
+			}
+		}
+	}
+}
+
+func (s *ExpirySweeper) error(networkID string, err error) {
+	if s.OnError != nil {
+		s.OnError(networkID, err)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestExpiryAnnotation(t *testing.T) {
+	when := time.Date(2024, 8, 7, 13, 0, 0, 0, time.UTC)
+
+	desc := SetExpiry("contractor laptop", when)
+	if desc != "contractor laptop [ztcentral:expires=2024-08-07T13:00:00Z]" {
+		t.Fatalf("unexpected description: %q", desc)
+	}
+
+	if got, ok := ParseExpiry(desc); !ok || !got.Equal(when) {
+		t.Fatalf("unexpected expiry: %v %v", got, ok)
+	}
+
+	desc = SetExpiry(desc, when.Add(time.Hour))
+	if got, _ := ParseExpiry(desc); !got.Equal(when.Add(time.Hour)) {
+		t.Fatalf("expiry was not replaced: %q", desc)
+	}
+
+	if ClearExpiry(desc) != "contractor laptop" {
+		t.Fatalf("unexpected cleared description: %q", ClearExpiry(desc))
+	}
+
+	if _, ok := ParseExpiry("[ztcentral:expires=soon]"); ok {
+		t.Fatal("parsed an invalid expiry")
+	}
+}
+
+func TestAuthorizeMemberFor(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	ctx := context.Background()
+
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001"), Description: stringp("contractor")})
+
+	m, err := c.AuthorizeMemberFor(ctx, *n.Id, "0000000001", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires, ok := MemberExpiry(m)
+	if !ok || !*m.Config.Authorized || ClearExpiry(*m.Description) != "contractor" {
+		t.Fatalf("member was not authorized with an expiry: %+v", m)
+	}
+
+	// members that have not joined yet are created.
+	if _, err := c.AuthorizeMemberFor(ctx, *n.Id, "0000000002", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AuthorizeMemberFor(ctx, *n.Id, "0000000003", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = c.ExtendAuthorization(ctx, *n.Id, "0000000001", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if extended, _ := MemberExpiry(m); !extended.Equal(expires.Add(time.Hour)) {
+		t.Fatalf("expiry was not extended: %v", extended)
+	}
+
+	expirations, err := c.ListExpirations(ctx, *n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(expirations) != 3 || expirations[0].MemberID != "0000000003" || expirations[2].MemberID != "0000000001" {
+		t.Fatalf("unexpected expirations: %+v", expirations)
+	}
+
+	if upcoming := UpcomingExpirations(expirations, time.Now().Add(time.Hour)); len(upcoming) != 2 {
+		t.Fatalf("unexpected upcoming expirations: %+v", upcoming)
+	}
+
+	var expired []Expiration
+	sweeper := &ExpirySweeper{
+		Client:   c,
+		OnExpire: func(e Expiration) { expired = append(expired, e) },
+		OnError:  func(id string, err error) { t.Errorf("%s: %v", id, err) },
+	}
+
+	sweeper.sweep(ctx)
+
+	if len(expired) != 1 || expired[0].MemberID != "0000000003" || expired[0].Err != nil {
+		t.Fatalf("unexpected sweep: %+v", expired)
+	}
+
+	if m := fc.Member(*n.Id, "0000000003"); *m.Config.Authorized || *m.Description != "" {
+		t.Fatalf("expired member was not deauthorized: %+v", m)
+	}
+
+	if _, err := c.RevokeAuthorization(ctx, *n.Id, "0000000002"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.MakeAuthorizationPermanent(ctx, *n.Id, "0000000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expirations, _ := c.ListExpirations(ctx, *n.Id); len(expirations) != 0 {
+		t.Fatalf("unexpected expirations: %+v", expirations)
+	}
+
+	if m := fc.Member(*n.Id, "0000000001"); !*m.Config.Authorized || *m.Description != "contractor" {
+		t.Fatalf("permanent member was changed: %+v", m)
+	}
+}
@@ -5,5 +5,12 @@ go 1.15
 require (
 	github.com/deepmap/oapi-codegen v1.8.1
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.12.2
 	github.com/zerotier/go-ztidentity v1.0.0
+	go.etcd.io/bbolt v1.3.6
+	go.opentelemetry.io/otel v1.2.0
+	go.opentelemetry.io/otel/sdk v1.2.0
+	go.opentelemetry.io/otel/trace v1.2.0
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,147 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidID is returned when a network or node ID cannot be parsed.
+var ErrInvalidID = errors.New("invalid ZeroTier ID")
+
+// NetworkID is a 64-bit ZeroTier network ID. The upper 40 bits are the node ID
+// of the network's controller, and the lower 24 bits are the network number on
+// that controller. It marshals to and from the usual 16 digit hexadecimal form.
+type NetworkID uint64
+
+// NodeID is a 40-bit ZeroTier node address, also known as a member ID. It
+// marshals to and from the usual 10 digit hexadecimal form.
+type NodeID uint64
+
+// NewNetworkID assembles a network ID from a controller and a network number.
+// Only the lower 24 bits of number are used.
+func NewNetworkID(controller NodeID, number uint32) NetworkID {
+	return NetworkID(uint64(controller)<<24 | uint64(number&0xffffff))
+}
+
+// ParseNetworkID parses a 16 digit hexadecimal network ID.
+func ParseNetworkID(s string) (NetworkID, error) {
+	id, err := parseHexID(s, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a 16 digit hexadecimal network ID: %w", s, ErrInvalidID)
+	}
+
+	return NetworkID(id), nil
+}
+
+// Controller returns the node ID of the controller hosting the network.
+func (n NetworkID) Controller() NodeID {
+	return NodeID(uint64(n) >> 24)
+}
+
+// Number returns the network number on the controller.
+func (n NetworkID) Number() uint32 {
+	return uint32(n & 0xffffff)
+}
+
+func (n NetworkID) String() string {
+	return fmt.Sprintf("%016x", uint64(n))
+}
+
+// MarshalText implements encoding.TextMarshaler, and by extension JSON.
+func (n NetworkID) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, and by extension JSON.
+func (n *NetworkID) UnmarshalText(text []byte) error {
+	id, err := ParseNetworkID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*n = id
+	return nil
+}
+
+// ParseNodeID parses a 10 digit hexadecimal node ID. Reserved addresses (zero,
+// and anything starting with ff) are rejected, as no node can have them.
+func ParseNodeID(s string) (NodeID, error) {
+	id, err := parseHexID(s, 10)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a 10 digit hexadecimal node ID: %w", s, ErrInvalidID)
+	}
+
+	if id == 0 || id>>32 == 0xff {
+		return 0, fmt.Errorf("%q is a reserved node ID: %w", s, ErrInvalidID)
+	}
+
+	return NodeID(id), nil
+}
+
+func (n NodeID) String() string {
+	return fmt.Sprintf("%010x", uint64(n))
+}
+
+// MarshalText implements encoding.TextMarshaler, and by extension JSON.
+func (n NodeID) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, and by extension JSON.
+func (n *NodeID) UnmarshalText(text []byte) error {
+	id, err := ParseNodeID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*n = id
+	return nil
+}
+
+func parseHexID(s string, length int) (uint64, error) {
+	if len(s) != length {
+		return 0, ErrInvalidID
+	}
+
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// validateIDs checks the IDs used to build a member request path, so that
+// typos fail before anything is sent.
+func validateIDs(networkID, memberID string) error {
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return err
+	}
+
+	_, err := ParseNodeID(memberID)
+	return err
+}
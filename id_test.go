@@ -0,0 +1,130 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseNetworkID(t *testing.T) {
+	id, err := ParseNetworkID("8056C2E21C000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.String() != "8056c2e21c000001" {
+		t.Fatalf("unexpected string form: %s", id)
+	}
+
+	if id.Controller().String() != "8056c2e21c" {
+		t.Fatalf("unexpected controller: %s", id.Controller())
+	}
+
+	if id.Number() != 1 {
+		t.Fatalf("unexpected network number: %d", id.Number())
+	}
+
+	if NewNetworkID(id.Controller(), id.Number()) != id {
+		t.Fatal("NewNetworkID did not reassemble the network ID")
+	}
+
+	for _, bad := range []string{"", "1", "8056c2e21c00001", "8056c2e21c0000011", "8056c2e21c00000g", "+056c2e21c000001"} {
+		if _, err := ParseNetworkID(bad); !errors.Is(err, ErrInvalidID) {
+			t.Fatalf("%q parsed as a network ID", bad)
+		}
+	}
+}
+
+func TestParseNodeID(t *testing.T) {
+	id, err := ParseNodeID("00000000ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.String() != "00000000ab" {
+		t.Fatalf("unexpected string form: %s", id)
+	}
+
+	for _, bad := range []string{"", "123456789", "0000000000", "ff00000001", "abcdefabcdef", "zzzzzzzzzz"} {
+		if _, err := ParseNodeID(bad); !errors.Is(err, ErrInvalidID) {
+			t.Fatalf("%q parsed as a node ID", bad)
+		}
+	}
+}
+
+func TestIDJSON(t *testing.T) {
+	type ids struct {
+		Network NetworkID `json:"network"`
+		Node    NodeID    `json:"node"`
+	}
+
+	const doc = `{"network":"8056c2e21c000001","node":"0123456789"}`
+
+	var res ids
+	if err := json.Unmarshal([]byte(doc), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != doc {
+		t.Fatalf("round trip was not equal: %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"network":"nope"}`), &res); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("unmarshaled an invalid network ID: %v", err)
+	}
+}
+
+func TestIDsValidatedBeforeRequest(t *testing.T) {
+	c, err := NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if _, err := c.GetNetwork(ctx, "8056c2e21c00001"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("GetNetwork: %v", err)
+	}
+
+	if _, err := c.GetMember(ctx, "8056c2e21c000001", "123456789"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("GetMember: %v", err)
+	}
+
+	if err := c.DeleteMember(ctx, "1", "0123456789"); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("DeleteMember: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+var (
+	// ErrIdentityMissing is returned when a member has no identity recorded.
+	ErrIdentityMissing = errors.New("member has no identity")
+	// ErrIdentityMalformed is returned when an identity cannot be parsed, or
+	// does not pass ZeroTier's proof of work check.
+	ErrIdentityMalformed = errors.New("identity is malformed")
+	// ErrIdentityMismatch is returned when an identity does not belong to the
+	// node ID it was presented with.
+	ErrIdentityMismatch = errors.New("identity does not match node ID")
+)
+
+// these mirror the constants used by ZeroTier (and go-ztidentity) when
+// generating identities.
+const (
+	identityGenMemory            = 2097152
+	identityHashCashFirstByteMax = 17
+)
+
+// Identity is the public half of a ZeroTier identity, as found in
+// MemberConfig.Identity.
+type Identity struct {
+	Address NodeID
+	// PublicKey is the curve25519 public key followed by the ed25519 public key.
+	PublicKey [64]byte
+}
+
+// ParseIdentity parses a type 0 ZeroTier identity in the
+// "address:0:publickey" form. If a secret key is appended it is ignored. The
+// identity is not validated; see Validate.
+func ParseIdentity(s string) (*Identity, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, fmt.Errorf("%w: expected address:type:publickey", ErrIdentityMalformed)
+	}
+
+	addr, err := ParseNodeID(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIdentityMalformed, err)
+	}
+
+	if parts[1] != "0" {
+		return nil, fmt.Errorf("%w: unsupported identity type %q", ErrIdentityMalformed, parts[1])
+	}
+
+	key, err := hex.DecodeString(parts[2])
+	if err != nil || len(key) != 64 {
+		return nil, fmt.Errorf("%w: public key must be 64 hex encoded bytes", ErrIdentityMalformed)
+	}
+
+	id := &Identity{Address: addr}
+	copy(id.PublicKey[:], key)
+
+	return id, nil
+}
+
+// Validate recomputes the node address from the public key, and checks that it
+// is equal to the identity's address and satisfies the proof of work that all
+// identities are generated with.
+func (id *Identity) Validate() error {
+	dig := identityHash(id.PublicKey[:])
+
+	if dig[0] >= identityHashCashFirstByteMax {
+		return fmt.Errorf("%w: public key does not satisfy proof of work", ErrIdentityMalformed)
+	}
+
+	addr := NodeID(uint64(dig[59])<<32 | uint64(binary.BigEndian.Uint32(dig[60:64])))
+	if addr != id.Address {
+		return fmt.Errorf("%w: public key hashes to %s, not %s", ErrIdentityMismatch, addr, id.Address)
+	}
+
+	return nil
+}
+
+func (id *Identity) String() string {
+	return fmt.Sprintf("%s:0:%x", id.Address, id.PublicKey)
+}
+
+// VerifyMemberIdentity checks that the member's public identity is present and
+// valid, and that it belongs to the node ID in both Member.NodeId and
+// MemberConfig.Id. The returned error wraps one of ErrIdentityMissing,
+// ErrIdentityMalformed or ErrIdentityMismatch.
+func VerifyMemberIdentity(m *spec.Member) error {
+	if m.Config == nil || m.Config.Identity == nil || *m.Config.Identity == "" {
+		return ErrIdentityMissing
+	}
+
+	id, err := ParseIdentity(*m.Config.Identity)
+	if err != nil {
+		return err
+	}
+
+	if err := id.Validate(); err != nil {
+		return err
+	}
+
+	checked := false
+
+	for _, nodeID := range []*string{m.NodeId, m.Config.Id} {
+		if nodeID == nil || *nodeID == "" {
+			continue
+		}
+
+		checked = true
+
+		if !strings.EqualFold(*nodeID, id.Address.String()) {
+			return fmt.Errorf("%w: identity is for %s, member is %s", ErrIdentityMismatch, id.Address, *nodeID)
+		}
+	}
+
+	if !checked {
+		return fmt.Errorf("%w: member has no node ID", ErrIdentityMismatch)
+	}
+
+	return nil
+}
+
+// IdentityAudit is a member that failed VerifyMemberIdentity.
+type IdentityAudit struct {
+	Member *spec.Member
+	Err    error
+}
+
+// AuditIdentities runs VerifyMemberIdentity over the members, and returns the
+// ones that failed.
+func AuditIdentities(members []*spec.Member) []IdentityAudit {
+	var res []IdentityAudit
+
+	for _, m := range members {
+		if err := VerifyMemberIdentity(m); err != nil {
+			res = append(res, IdentityAudit{Member: m, Err: err})
+		}
+	}
+
+	return res
+}
+
+// AuditMemberIdentities fetches the members of a network and audits their
+// identities. See AuditIdentities.
+func (c *Client) AuditMemberIdentities(ctx context.Context, networkID string) ([]IdentityAudit, error) {
+	members, err := c.GetMembers(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	return AuditIdentities(members), nil
+}
+
+// identityHash is ZeroTier's memory-hard identity hash. go-ztidentity only
+// uses it internally to generate identities, so it is reproduced here for
+// verification.
+func identityHash(publicKey []byte) [64]byte {
+	s512 := sha512.Sum512(publicKey)
+
+	genmem := make([]byte, identityGenMemory)
+	var s20key [32]byte
+	var s20ctr [16]byte
+	var s20ctri uint64
+
+	copy(s20key[:], s512[0:32])
+	copy(s20ctr[0:8], s512[32:40])
+	salsa.XORKeyStream(genmem[0:64], genmem[0:64], &s20ctr, &s20key)
+	s20ctri++
+
+	for i := 64; i < identityGenMemory; i += 64 {
+		binary.LittleEndian.PutUint64(s20ctr[8:16], s20ctri)
+		salsa.XORKeyStream(genmem[i:i+64], genmem[i-64:i], &s20ctr, &s20key)
+		s20ctri++
+	}
+
+	var tmp [8]byte
+	for i := 0; i < identityGenMemory; {
+		idx1 := uint(binary.BigEndian.Uint64(genmem[i:])&7) * 8
+		i += 8
+		idx2 := (uint(binary.BigEndian.Uint64(genmem[i:])) % uint(identityGenMemory/8)) * 8
+		i += 8
+		gm := genmem[idx2 : idx2+8]
+		d := s512[idx1 : idx1+8]
+		copy(tmp[:], gm)
+		copy(gm, d)
+		copy(d, tmp[:])
+		binary.LittleEndian.PutUint64(s20ctr[8:16], s20ctri)
+		salsa.XORKeyStream(s512[:], s512[:], &s20ctr, &s20key)
+		s20ctri++
+	}
+
+	return s512
+}
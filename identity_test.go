@@ -0,0 +1,102 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztidentity"
+)
+
+func TestVerifyMemberIdentity(t *testing.T) {
+	alice := ztidentity.NewZeroTierIdentity()
+	bob := ztidentity.NewZeroTierIdentity()
+
+	tampered := []byte(alice.PublicKeyString())
+	if tampered[len(tampered)-1] == '0' {
+		tampered[len(tampered)-1] = '1'
+	} else {
+		tampered[len(tampered)-1] = '0'
+	}
+
+	member := func(nodeID, identity string) *spec.Member {
+		m := &spec.Member{NodeId: &nodeID, Config: &spec.MemberConfig{Id: &nodeID}}
+		if identity != "" {
+			m.Config.Identity = &identity
+		}
+
+		return m
+	}
+
+	table := map[string]struct {
+		member *spec.Member
+		err    error
+	}{
+		"valid":          {member(alice.IDString(), alice.PublicKeyString()), nil},
+		"valid secret":   {member(alice.IDString(), alice.PrivateKeyString()), nil},
+		"missing":        {member(alice.IDString(), ""), ErrIdentityMissing},
+		"no config":      {&spec.Member{NodeId: stringp(alice.IDString())}, ErrIdentityMissing},
+		"malformed":      {member(alice.IDString(), "not an identity"), ErrIdentityMalformed},
+		"truncated":      {member(alice.IDString(), alice.PublicKeyString()[:40]), ErrIdentityMalformed},
+		"wrong type":     {member(alice.IDString(), strings.Replace(alice.PublicKeyString(), ":0:", ":1:", 1)), ErrIdentityMalformed},
+		"other node":     {member(bob.IDString(), alice.PublicKeyString()), ErrIdentityMismatch},
+		"forged address": {member(bob.IDString(), bob.IDString()+alice.PublicKeyString()[10:]), ErrIdentityMismatch},
+		"tampered key":   {member(alice.IDString(), string(tampered)), ErrIdentityMalformed},
+	}
+
+	for name, harness := range table {
+		err := VerifyMemberIdentity(harness.member)
+		if harness.err == nil && err != nil {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+
+		// a tampered key fails either the proof of work or the address check,
+		// depending on the hash; both are acceptable.
+		if name == "tampered key" && errors.Is(err, ErrIdentityMismatch) {
+			continue
+		}
+
+		if harness.err != nil && !errors.Is(err, harness.err) {
+			t.Fatalf("%q: expected %v, got %v", name, harness.err, err)
+		}
+	}
+
+	audit := AuditIdentities([]*spec.Member{
+		table["valid"].member,
+		table["missing"].member,
+		table["other node"].member,
+	})
+
+	if len(audit) != 2 || audit[0].Member != table["missing"].member || audit[1].Member != table["other node"].member {
+		t.Fatalf("unexpected audit results: %+v", audit)
+	}
+}
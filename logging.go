@@ -0,0 +1,220 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger is the subset of *slog.Logger the client logs through, so a
+// *slog.Logger can be passed to SetLogger as is. Arguments are alternating
+// keys and values.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	WarnContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// LogLevel controls what the client logs.
+type LogLevel int
+
+const (
+	// LogOff disables logging.
+	LogOff LogLevel = iota
+	// LogMetadata logs the operation, path, status, duration and request
+	// headers of every call at info level, or warn level if it failed.
+	LogMetadata
+	// LogBodies also logs request and response bodies at debug level.
+	LogBodies
+)
+
+// Redacted replaces secrets in logs.
+const Redacted = "[REDACTED]"
+
+// secretFields are JSON fields whose values are never logged: API tokens in
+// AddAPIToken requests and RandomToken responses, and SSO client secrets.
+var secretFields = map[string]bool{
+	"token":        true,
+	"clientSecret": true,
+	// client_secret is how OIDC providers spell it.
+	"client_secret": true,
+}
+
+// SetLogger logs requests through l at the given level. The Authorization
+// header is always redacted, as are the fields in secretFields wherever they
+// appear in a body, and the hex encoded token of RandomToken responses. Like
+// the other setters, it must not be called while requests are in flight.
+func (c *Client) SetLogger(l Logger, level LogLevel) {
+	c.logger = l
+	c.logLevel = level
+
+	if l == nil {
+		c.logLevel = LogOff
+	}
+}
+
+// logRequest logs the request body, restoring it for sending.
+func (c *Client) logRequest(ctx context.Context, req *http.Request, info RequestInfo) error {
+	if c.logLevel < LogBodies || req.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(body)), nil }
+
+	c.logger.DebugContext(ctx, "central request body", append(logArgs(info), "body", redactBody(info, body))...)
+
+	return nil
+}
+
+// logResponse logs the outcome of the call and, at LogBodies, the response
+// body, which is replaced so the caller can still read it.
+func (c *Client) logResponse(ctx context.Context, req *http.Request, info RequestInfo, resp *http.Response, err error, duration time.Duration) {
+	if c.logLevel < LogMetadata {
+		return
+	}
+
+	args := append(logArgs(info), "duration", duration, "headers", redactHeader(req.Header))
+	if err != nil {
+		c.logger.WarnContext(ctx, "central request failed", append(args, "error", err.Error())...)
+		return
+	}
+
+	args = append(args, "status", resp.StatusCode)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		c.logger.WarnContext(ctx, "central request", args...)
+	} else {
+		c.logger.InfoContext(ctx, "central request", args...)
+	}
+
+	if c.logLevel < LogBodies {
+		return
+	}
+
+	body, rerr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if rerr != nil {
+		c.logger.ErrorContext(ctx, "reading central response body", append(logArgs(info), "error", rerr.Error())...)
+		return
+	}
+
+	c.logger.DebugContext(ctx, "central response body", append(logArgs(info), "status", resp.StatusCode, "body", redactBody(info, body))...)
+}
+
+func logArgs(info RequestInfo) []interface{} {
+	args := []interface{}{"method", info.Method, "path", info.Path}
+
+	if info.Operation != "" {
+		args = append(args, "operation", info.Operation)
+	}
+
+	if info.NetworkID != "" {
+		args = append(args, "networkId", info.NetworkID)
+	}
+
+	if info.MemberID != "" {
+		args = append(args, "memberId", info.MemberID)
+	}
+
+	return args
+}
+
+// redactHeader flattens the header for logging, without the Authorization
+// value.
+func redactHeader(h http.Header) map[string]string {
+	res := map[string]string{}
+
+	for k, v := range h {
+		if strings.EqualFold(k, "Authorization") {
+			res[k] = Redacted
+			continue
+		}
+
+		res[k] = strings.Join(v, ", ")
+	}
+
+	return res
+}
+
+// redactBody returns the body as a string with secret fields replaced. Bodies
+// that are not JSON are replaced entirely, as they cannot be checked.
+func redactBody(info RequestInfo, body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return Redacted
+	}
+
+	redactValue(v, info.Operation == "GetRandomToken")
+
+	res, err := json.Marshal(v)
+	if err != nil {
+		return Redacted
+	}
+
+	return string(res)
+}
+
+func redactValue(v interface{}, randomToken bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if secretFields[k] || (randomToken && k == "hex") {
+				v[k] = Redacted
+				continue
+			}
+
+			redactValue(field, randomToken)
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactValue(item, randomToken)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logRecord struct {
+	level string
+	msg   string
+	args  map[string]interface{}
+}
+
+type recordingLogger struct {
+	mutex   sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) record(level, msg string, args []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	r := logRecord{level: level, msg: msg, args: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		r.args[args[i].(string)] = args[i+1]
+	}
+
+	l.records = append(l.records, r)
+}
+
+func (l *recordingLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.record("debug", msg, args)
+}
+
+func (l *recordingLogger) InfoContext(ctx context.Context, msg string, args ...interface{}) {
+	l.record("info", msg, args)
+}
+
+func (l *recordingLogger) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	l.record("warn", msg, args)
+}
+
+func (l *recordingLogger) ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	l.record("error", msg, args)
+}
+
+func TestLogging(t *testing.T) {
+	c, _ := newFakeClient(t)
+
+	l := &recordingLogger{}
+	c.SetLogger(l, LogBodies)
+
+	ctx := context.Background()
+
+	user, err := c.User(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random, err := c.RandomToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	if err := c.CreateAPIToken(ctx, *user.Id, "ci", secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetNetwork(ctx, "8056c2e21c000001"); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	var bodies, warnings int
+
+	for _, r := range l.records {
+		dump := fmt.Sprintf("%v", r.args)
+		for _, s := range []string{"fake-token", secret, random} {
+			if strings.Contains(dump, s) {
+				t.Fatalf("%s record %q logged a secret: %s", r.level, r.msg, dump)
+			}
+		}
+
+		if headers, ok := r.args["headers"].(map[string]string); ok && headers["Authorization"] != Redacted {
+			t.Fatalf("authorization was not redacted: %v", headers)
+		}
+
+		if r.level == "debug" {
+			bodies++
+		}
+
+		if r.level == "warn" {
+			warnings++
+			if r.args["status"] != 404 || r.args["operation"] != "GetNetworkByID" {
+				t.Fatalf("unexpected warning: %v", r.args)
+			}
+		}
+	}
+
+	if warnings != 1 || bodies < 4 {
+		t.Fatalf("expected 1 warning and request and response bodies, got %d and %d", warnings, bodies)
+	}
+
+	var tokenBody string
+	for _, r := range l.records {
+		if r.msg == "central request body" && r.args["operation"] == "AddAPIToken" {
+			tokenBody = r.args["body"].(string)
+		}
+	}
+
+	if !strings.Contains(tokenBody, `"tokenName":"ci"`) || !strings.Contains(tokenBody, `"token":"`+Redacted+`"`) {
+		t.Fatalf("unexpected token request body: %s", tokenBody)
+	}
+
+	l.records = nil
+	c.SetLogger(l, LogMetadata)
+
+	if _, err := c.GetNetworks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.records) != 1 || l.records[0].level != "info" || l.records[0].args["status"] != 200 {
+		t.Fatalf("unexpected records: %+v", l.records)
+	}
+}
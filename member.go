@@ -30,12 +30,15 @@ package ztcentral
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/zerotier/go-ztcentral/pkg/spec"
 )
 
 func (c *Client) GetMembers(ctx context.Context, networkID string) ([]*spec.Member, error) {
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return nil, err
+	}
+
 	resp, err := c.specClient.GetNetworkMemberList(ctx, networkID)
 	if err != nil {
 		return nil, err
@@ -49,6 +52,10 @@ func (c *Client) GetMembers(ctx context.Context, networkID string) ([]*spec.Memb
 func (c *Client) GetMember(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
 	member := &spec.Member{}
 
+	if err := validateIDs(networkID, memberID); err != nil {
+		return nil, err
+	}
+
 	resp, err := c.specClient.GetNetworkMember(ctx, networkID, memberID)
 	if err != nil {
 		return nil, err
@@ -60,6 +67,14 @@ func (c *Client) GetMember(ctx context.Context, networkID, memberID string) (*sp
 func (c *Client) UpdateMember(ctx context.Context, networkID, memberID string, m *spec.Member) (*spec.Member, error) {
 	member := &spec.Member{}
 
+	if err := validateIDs(networkID, memberID); err != nil {
+		return nil, err
+	}
+
+	if c.dryRun != nil {
+		return c.dryRunUpdateMember(ctx, networkID, memberID, m)
+	}
+
 	resp, err := c.specClient.UpdateNetworkMember(ctx, networkID, memberID, spec.UpdateNetworkMemberJSONRequestBody(*m))
 	if err != nil {
 		return nil, err
@@ -102,6 +117,14 @@ func (c *Client) DeauthorizeMember(ctx context.Context, networkID, memberID stri
 }
 
 func (c *Client) DeleteMember(ctx context.Context, networkID, memberID string) error {
+	if err := validateIDs(networkID, memberID); err != nil {
+		return err
+	}
+
+	if c.dryRun != nil {
+		return c.dryRunDeleteMember(ctx, networkID, memberID)
+	}
+
 	resp, err := c.specClient.DeleteNetworkMember(ctx, networkID, memberID)
 	if err != nil {
 		return err
@@ -110,7 +133,7 @@ func (c *Client) DeleteMember(ctx context.Context, networkID, memberID string) e
 	resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("Status was %v: %w", resp.StatusCode, ErrStatus)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	return nil
@@ -0,0 +1,641 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// MemberFilter reports whether a member should be kept. Filters can be
+// combined with AllOf, AnyOf and Not, and applied with FilterMembers.
+type MemberFilter func(m *spec.Member) bool
+
+// FilterMembers returns the members that pass every filter. The input slice is
+// not modified.
+func FilterMembers(members []*spec.Member, filters ...MemberFilter) []*spec.Member {
+	f := AllOf(filters...)
+	res := []*spec.Member{}
+
+	for _, m := range members {
+		if f(m) {
+			res = append(res, m)
+		}
+	}
+
+	return res
+}
+
+// AllOf passes members that pass every filter. With no filters, every member
+// passes.
+func AllOf(filters ...MemberFilter) MemberFilter {
+	return func(m *spec.Member) bool {
+		for _, f := range filters {
+			if !f(m) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// AnyOf passes members that pass at least one filter.
+func AnyOf(filters ...MemberFilter) MemberFilter {
+	return func(m *spec.Member) bool {
+		for _, f := range filters {
+			if f(m) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Not inverts a filter.
+func Not(f MemberFilter) MemberFilter {
+	return func(m *spec.Member) bool {
+		return !f(m)
+	}
+}
+
+// IsAuthorized passes members whose authorization state equals authorized.
+func IsAuthorized(authorized bool) MemberFilter {
+	return func(m *spec.Member) bool {
+		return m.Config != nil && boolv(m.Config.Authorized) == authorized
+	}
+}
+
+// IsHidden passes members whose hidden flag equals hidden.
+func IsHidden(hidden bool) MemberFilter {
+	return func(m *spec.Member) bool {
+		return boolv(m.Hidden) == hidden
+	}
+}
+
+// SupportsRulesEngine passes members whose SupportsRulesEngine flag equals
+// supported.
+func SupportsRulesEngine(supported bool) MemberFilter {
+	return func(m *spec.Member) bool {
+		return boolv(m.SupportsRulesEngine) == supported
+	}
+}
+
+// OnlineSince passes members whose LastOnline is at or after t. Members with no
+// LastOnline never pass.
+func OnlineSince(t time.Time) MemberFilter {
+	return func(m *spec.Member) bool {
+		lo, ok := msTime(m.LastOnline)
+		return ok && !lo.Before(t)
+	}
+}
+
+// OnlineWithin passes members that were online within d of the time the filter
+// was created.
+func OnlineWithin(d time.Duration) MemberFilter {
+	return OnlineSince(time.Now().Add(-d))
+}
+
+// CreatedBetween passes members created in [from, to). A zero time leaves that
+// end of the range open.
+func CreatedBetween(from, to time.Time) MemberFilter {
+	return func(m *spec.Member) bool {
+		return m.Config != nil && timeBetween(m.Config.CreationTime, from, to)
+	}
+}
+
+// AuthorizedBetween passes members last authorized in [from, to). A zero time
+// leaves that end of the range open.
+func AuthorizedBetween(from, to time.Time) MemberFilter {
+	return func(m *spec.Member) bool {
+		return m.Config != nil && timeBetween(m.Config.LastAuthorizedTime, from, to)
+	}
+}
+
+// NameGlob passes members whose name matches the path.Match style pattern.
+func NameGlob(pattern string) (MemberFilter, error) {
+	return globFilter(pattern, func(m *spec.Member) *string { return m.Name })
+}
+
+// NameRegexp passes members whose name matches re.
+func NameRegexp(re *regexp.Regexp) MemberFilter {
+	return func(m *spec.Member) bool {
+		return re.MatchString(stringv(m.Name))
+	}
+}
+
+// DescriptionGlob passes members whose description matches the path.Match
+// style pattern.
+func DescriptionGlob(pattern string) (MemberFilter, error) {
+	return globFilter(pattern, func(m *spec.Member) *string { return m.Description })
+}
+
+// DescriptionRegexp passes members whose description matches re.
+func DescriptionRegexp(re *regexp.Regexp) MemberFilter {
+	return func(m *spec.Member) bool {
+		return re.MatchString(stringv(m.Description))
+	}
+}
+
+func globFilter(pattern string, field func(m *spec.Member) *string) (MemberFilter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return func(m *spec.Member) bool {
+		ok, _ := path.Match(pattern, stringv(field(m)))
+		return ok
+	}, nil
+}
+
+// HasTag passes members that have the tag ID set to value.
+func HasTag(id, value int) MemberFilter {
+	return func(m *spec.Member) bool {
+		v, ok := memberTag(m, id)
+		return ok && v == value
+	}
+}
+
+// HasNamedTag passes members that have the named tag set to value, resolved
+// with ResolveTag.
+func HasNamedTag(n *spec.Network, name, value string) (MemberFilter, error) {
+	id, v, err := ResolveTag(n, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return HasTag(id, v), nil
+}
+
+// ResolveTag returns the ID and value of a tag. Tag names, and the names of
+// enumerated values, are resolved with the network's TagsByName; both may also
+// be numeric.
+func ResolveTag(n *spec.Network, name, value string) (int, int, error) {
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		tag, ok := lookupByName(n, func(n *spec.Network) *map[string]interface{} { return n.TagsByName }, name)
+		if !ok {
+			return 0, 0, fmt.Errorf("network has no tag named %q", name)
+		}
+
+		if id, ok = numberv(tag["id"]); !ok {
+			return 0, 0, fmt.Errorf("tag %q has no id", name)
+		}
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		tag, _ := lookupByName(n, func(n *spec.Network) *map[string]interface{} { return n.TagsByName }, name)
+		enums, _ := tag["enums"].(map[string]interface{})
+
+		var ok bool
+		if v, ok = numberv(enums[value]); !ok {
+			return 0, 0, fmt.Errorf("tag %q has no value named %q", name, value)
+		}
+	}
+
+	return id, v, nil
+}
+
+// HasCapability passes members that have the capability ID.
+func HasCapability(id int) MemberFilter {
+	return func(m *spec.Member) bool {
+		if m.Config == nil || m.Config.Capabilities == nil {
+			return false
+		}
+
+		for _, c := range *m.Config.Capabilities {
+			if c == id {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// HasNamedCapability passes members that have the named capability, resolved
+// with the network's CapabilitiesByName.
+func HasNamedCapability(n *spec.Network, name string) (MemberFilter, error) {
+	c, ok := lookupByName(n, func(n *spec.Network) *map[string]interface{} { return n.CapabilitiesByName }, name)
+	if !ok {
+		return nil, fmt.Errorf("network has no capability named %q", name)
+	}
+
+	id, ok := numberv(c["id"])
+	if !ok {
+		return nil, fmt.Errorf("capability %q has no id", name)
+	}
+
+	return HasCapability(id), nil
+}
+
+// HasIPIn passes members with at least one assigned IP inside cidr.
+func HasIPIn(cidr *net.IPNet) MemberFilter {
+	return func(m *spec.Member) bool {
+		for _, ip := range memberIPs(m) {
+			if cidr.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// HasIPAssignments passes members with at least one assigned IP.
+func HasIPAssignments() MemberFilter {
+	return func(m *spec.Member) bool {
+		return len(memberIPs(m)) > 0
+	}
+}
+
+// ClientVersionBetween passes members whose client version is in [min, max).
+// Either bound may be empty to leave it open. Members that have never reported
+// a version never pass.
+func ClientVersionBetween(min, max string) (MemberFilter, error) {
+	var lo, hi ClientVersion
+	var err error
+
+	if min != "" {
+		if lo, err = ParseClientVersion(min); err != nil {
+			return nil, err
+		}
+	}
+
+	if max != "" {
+		if hi, err = ParseClientVersion(max); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(m *spec.Member) bool {
+		v, ok := MemberClientVersion(m)
+		if !ok {
+			return false
+		}
+
+		return (min == "" || v.Compare(lo) >= 0) && (max == "" || v.Compare(hi) < 0)
+	}, nil
+}
+
+// ClientVersion is a ZeroTier client version.
+type ClientVersion struct {
+	Major, Minor, Revision int
+}
+
+// ParseClientVersion parses versions like "1.10.2". Missing components are
+// zero, and a leading "v" is allowed.
+func ParseClientVersion(s string) (ClientVersion, error) {
+	var v ClientVersion
+
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid client version %q", s)
+	}
+
+	dst := []*int{&v.Major, &v.Minor, &v.Revision}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid client version %q", s)
+		}
+
+		*dst[i] = n
+	}
+
+	return v, nil
+}
+
+// MemberClientVersion returns the version the member last reported, and false
+// if it has never reported one.
+func MemberClientVersion(m *spec.Member) (ClientVersion, bool) {
+	if m.Config != nil && m.Config.VMajor != nil && *m.Config.VMajor >= 0 {
+		return ClientVersion{
+			Major:    *m.Config.VMajor,
+			Minor:    intv(m.Config.VMinor),
+			Revision: intv(m.Config.VRev),
+		}, true
+	}
+
+	if m.ClientVersion == nil {
+		return ClientVersion{}, false
+	}
+
+	v, err := ParseClientVersion(*m.ClientVersion)
+	return v, err == nil
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater than o.
+func (v ClientVersion) Compare(o ClientVersion) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Revision - o.Revision} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func (v ClientVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Revision)
+}
+
+// SortKey sorts members by a field from MemberFields, descending if Desc is
+// set.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// SortMembers sorts members in place by the keys, in order of precedence. The
+// sort is stable, so members that compare equal keep their relative order.
+func SortMembers(members []*spec.Member, keys ...SortKey) error {
+	for _, key := range keys {
+		if _, ok := memberFields[key.Field]; !ok {
+			return fmt.Errorf("unknown member field %q", key.Field)
+		}
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		for _, key := range keys {
+			c := compareValues(memberFields[key.Field](members[i]), memberFields[key.Field](members[j]))
+			if c == 0 {
+				continue
+			}
+
+			if key.Desc {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+
+	return nil
+}
+
+// ProjectMembers reduces each member to the requested fields from
+// MemberFields. Values are strings, numbers, booleans, times or nil when
+// unset, so the result marshals cleanly to JSON.
+func ProjectMembers(members []*spec.Member, fields ...string) ([]map[string]interface{}, error) {
+	for _, field := range fields {
+		if _, ok := memberFields[field]; !ok {
+			return nil, fmt.Errorf("unknown member field %q", field)
+		}
+	}
+
+	res := make([]map[string]interface{}, 0, len(members))
+
+	for _, m := range members {
+		row := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			row[field] = memberFields[field](m)
+		}
+
+		res = append(res, row)
+	}
+
+	return res, nil
+}
+
+// MemberFields returns the names of the fields usable with SortMembers and
+// ProjectMembers.
+func MemberFields() []string {
+	res := make([]string, 0, len(memberFields))
+	for name := range memberFields {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+var memberFields = map[string]func(m *spec.Member) interface{}{
+	"id":              func(m *spec.Member) interface{} { return ptrv(m.Id) },
+	"networkId":       func(m *spec.Member) interface{} { return ptrv(m.NetworkId) },
+	"nodeId":          func(m *spec.Member) interface{} { return ptrv(m.NodeId) },
+	"name":            func(m *spec.Member) interface{} { return ptrv(m.Name) },
+	"description":     func(m *spec.Member) interface{} { return ptrv(m.Description) },
+	"hidden":          func(m *spec.Member) interface{} { return ptrv(m.Hidden) },
+	"physicalAddress": func(m *spec.Member) interface{} { return ptrv(m.PhysicalAddress) },
+	"lastOnline":      func(m *spec.Member) interface{} { return timev(m.LastOnline) },
+	"lastSeen":        func(m *spec.Member) interface{} { return timev(m.LastSeen) },
+	"clientVersion": func(m *spec.Member) interface{} {
+		if v, ok := MemberClientVersion(m); ok {
+			return v
+		}
+
+		return nil
+	},
+	"supportsRulesEngine": func(m *spec.Member) interface{} { return ptrv(m.SupportsRulesEngine) },
+	"authorized": func(m *spec.Member) interface{} {
+		if m.Config == nil {
+			return nil
+		}
+
+		return ptrv(m.Config.Authorized)
+	},
+	"ipAssignments": func(m *spec.Member) interface{} {
+		if m.Config == nil || m.Config.IpAssignments == nil {
+			return nil
+		}
+
+		return *m.Config.IpAssignments
+	},
+	"creationTime": func(m *spec.Member) interface{} {
+		if m.Config == nil {
+			return nil
+		}
+
+		return timev(m.Config.CreationTime)
+	},
+	"lastAuthorizedTime": func(m *spec.Member) interface{} {
+		if m.Config == nil {
+			return nil
+		}
+
+		return timev(m.Config.LastAuthorizedTime)
+	},
+}
+
+// compareValues orders the values returned by memberFields. nil sorts first.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == b:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0
+		} else if bv {
+			return -1
+		}
+
+		return 1
+	case time.Time:
+		bv := b.(time.Time)
+		if av.Before(bv) {
+			return -1
+		} else if av.After(bv) {
+			return 1
+		}
+
+		return 0
+	case ClientVersion:
+		return av.Compare(b.(ClientVersion))
+	case []string:
+		return strings.Compare(strings.Join(av, ","), strings.Join(b.([]string), ","))
+	}
+
+	return 0
+}
+
+func lookupByName(n *spec.Network, field func(n *spec.Network) *map[string]interface{}, name string) (map[string]interface{}, bool) {
+	if n == nil || field(n) == nil {
+		return nil, false
+	}
+
+	res, ok := (*field(n))[name].(map[string]interface{})
+	return res, ok
+}
+
+// memberTag returns the value of the tag id on the member. Tags are [id, value]
+// pairs, which arrive from JSON as float64.
+func memberTag(m *spec.Member, id int) (int, bool) {
+	if m.Config == nil || m.Config.Tags == nil {
+		return 0, false
+	}
+
+	for _, tag := range *m.Config.Tags {
+		if len(tag) != 2 {
+			continue
+		}
+
+		if tid, ok := numberv(tag[0]); ok && tid == id {
+			return numberv(tag[1])
+		}
+	}
+
+	return 0, false
+}
+
+func memberIPs(m *spec.Member) []net.IP {
+	if m.Config == nil || m.Config.IpAssignments == nil {
+		return nil
+	}
+
+	var res []net.IP
+	for _, s := range *m.Config.IpAssignments {
+		if ip := net.ParseIP(s); ip != nil {
+			res = append(res, ip)
+		}
+	}
+
+	return res
+}
+
+func timeBetween(ms *int64, from, to time.Time) bool {
+	t, ok := msTime(ms)
+	if !ok {
+		return false
+	}
+
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// msTime converts a Central timestamp (milliseconds since the epoch) to a
+// time. Central uses 0 for "never", so that is reported as not set.
+func msTime(ms *int64) (time.Time, bool) {
+	if ms == nil || *ms <= 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, *ms*int64(time.Millisecond)), true
+}
+
+func timev(ms *int64) interface{} {
+	if t, ok := msTime(ms); ok {
+		return t
+	}
+
+	return nil
+}
+
+func numberv(i interface{}) (int, bool) {
+	switch n := i.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+
+	return 0, false
+}
+
+func ptrv(p interface{}) interface{} {
+	switch v := p.(type) {
+	case *string:
+		if v != nil {
+			return *v
+		}
+	case *bool:
+		if v != nil {
+			return *v
+		}
+	}
+
+	return nil
+}
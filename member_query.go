@@ -0,0 +1,387 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// MemberQuery is a parsed member query; see ParseMemberQuery.
+type MemberQuery struct {
+	Filter MemberFilter
+	Sort   []SortKey
+	Fields []string
+}
+
+// ParseMemberQuery parses a query string into a filter, sort order and
+// projection. The query is a whitespace separated list of terms, all of which
+// must match. Values containing spaces may be double quoted, and any filter
+// term may be prefixed with "!" to negate it.
+//
+//	authorized=true|false     authorization state
+//	hidden=true|false         hidden in the UI
+//	rules=true|false          SupportsRulesEngine
+//	online=24h                online within the duration ("7d" is allowed)
+//	name=web-*  name~^web-    name glob or regular expression
+//	description=* description~re
+//	tag.<name>=<value>        tag by name, value by enum name or number
+//	cap=<name|id>             has capability
+//	ip=10.0.0.0/8             has an IP inside the CIDR (or equal to the IP)
+//	version>=1.8 version<1.12 client version range (also <=, >, =)
+//	created>=2024-01-01       creation time (also <, <=, >); a duration like
+//	authorizedAt<30d          "30d" means that long ago
+//	sort=-lastOnline,name     sort by fields, "-" for descending
+//	fields=nodeId,name        project onto fields
+//
+// The network is used to resolve tag and capability names, and may be nil if
+// the query does not use them.
+func ParseMemberQuery(query string, n *spec.Network) (*MemberQuery, error) {
+	terms, err := splitQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &MemberQuery{}
+	var filters []MemberFilter
+
+	for _, term := range terms {
+		negate := strings.HasPrefix(term, "!")
+		term = strings.TrimPrefix(term, "!")
+
+		key, op, value, err := splitTerm(term)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "sort", "fields":
+			if negate || op != "=" {
+				return nil, fmt.Errorf("invalid term %q", term)
+			}
+
+			if key == "sort" {
+				q.Sort, err = parseSortKeys(value)
+			} else {
+				q.Fields = strings.Split(value, ",")
+				_, err = ProjectMembers(nil, q.Fields...)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		f, err := parseFilterTerm(key, op, value, n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term %q: %w", term, err)
+		}
+
+		if negate {
+			f = Not(f)
+		}
+
+		filters = append(filters, f)
+	}
+
+	q.Filter = AllOf(filters...)
+
+	return q, nil
+}
+
+// Apply filters and sorts the members. The input slice is not modified.
+func (q *MemberQuery) Apply(members []*spec.Member) []*spec.Member {
+	res := FilterMembers(members, q.Filter)
+	// the keys were checked while parsing.
+	SortMembers(res, q.Sort...)
+	return res
+}
+
+// Project applies the query and projects the result onto the query's fields,
+// or onto every field in MemberFields if the query did not name any.
+func (q *MemberQuery) Project(members []*spec.Member) []map[string]interface{} {
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = MemberFields()
+	}
+
+	res, _ := ProjectMembers(q.Apply(members), fields...)
+	return res
+}
+
+func parseFilterTerm(key, op, value string, n *spec.Network) (MemberFilter, error) {
+	switch key {
+	case "authorized", "hidden", "rules":
+		if op != "=" {
+			return nil, fmt.Errorf("%q only supports =", key)
+		}
+
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "authorized":
+			return IsAuthorized(b), nil
+		case "hidden":
+			return IsHidden(b), nil
+		default:
+			return SupportsRulesEngine(b), nil
+		}
+	case "online":
+		if op != "=" {
+			return nil, fmt.Errorf("%q only supports =", key)
+		}
+
+		d, err := parseAge(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return OnlineWithin(d), nil
+	case "name", "description":
+		glob, re := NameGlob, NameRegexp
+		if key == "description" {
+			glob, re = DescriptionGlob, DescriptionRegexp
+		}
+
+		switch op {
+		case "=":
+			return glob(value)
+		case "~":
+			r, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return re(r), nil
+		}
+
+		return nil, fmt.Errorf("%q only supports = and ~", key)
+	case "cap":
+		if op != "=" {
+			return nil, fmt.Errorf("%q only supports =", key)
+		}
+
+		if id, err := strconv.Atoi(value); err == nil {
+			return HasCapability(id), nil
+		}
+
+		return HasNamedCapability(n, value)
+	case "ip":
+		if op != "=" {
+			return nil, fmt.Errorf("%q only supports =", key)
+		}
+
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return HasIPIn(cidr), nil
+	case "version":
+		return parseVersionTerm(op, value)
+	case "created", "authorizedAt":
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return nil, err
+		}
+
+		between := CreatedBetween
+		if key == "authorizedAt" {
+			between = AuthorizedBetween
+		}
+
+		return timeRange(between, op, t)
+	}
+
+	if strings.HasPrefix(key, "tag.") {
+		if op != "=" {
+			return nil, fmt.Errorf("%q only supports =", key)
+		}
+
+		return HasNamedTag(n, strings.TrimPrefix(key, "tag."), value)
+	}
+
+	return nil, fmt.Errorf("unknown key %q", key)
+}
+
+func parseVersionTerm(op, value string) (MemberFilter, error) {
+	v, err := ParseClientVersion(value)
+	if err != nil {
+		return nil, err
+	}
+
+	next := ClientVersion{v.Major, v.Minor, v.Revision + 1}.String()
+
+	switch op {
+	case ">=":
+		return ClientVersionBetween(value, "")
+	case ">":
+		return ClientVersionBetween(next, "")
+	case "<":
+		return ClientVersionBetween("", value)
+	case "<=":
+		return ClientVersionBetween("", next)
+	case "=":
+		return ClientVersionBetween(value, next)
+	}
+
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+// timeRange turns a comparison into a [from, to) range. Central's timestamps
+// are in milliseconds, so "after t" starts a millisecond later.
+func timeRange(between func(from, to time.Time) MemberFilter, op string, t time.Time) (MemberFilter, error) {
+	switch op {
+	case ">=":
+		return between(t, time.Time{}), nil
+	case ">":
+		return between(t.Add(time.Millisecond), time.Time{}), nil
+	case "<":
+		return between(time.Time{}, t), nil
+	case "<=":
+		return between(time.Time{}, t.Add(time.Millisecond)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date, RFC3339 time or duration", s)
+	}
+
+	return time.Now().Add(-d), nil
+}
+
+// parseAge parses a time.Duration, additionally allowing a whole number of
+// days such as "30d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+func parseSortKeys(value string) ([]SortKey, error) {
+	var keys []SortKey
+
+	for _, field := range strings.Split(value, ",") {
+		key := SortKey{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if _, ok := memberFields[key.Field]; !ok {
+			return nil, fmt.Errorf("unknown member field %q", key.Field)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// splitTerm splits "key>=value" into its parts.
+func splitTerm(term string) (string, string, string, error) {
+	i := strings.IndexAny(term, "=<>~")
+	if i <= 0 {
+		return "", "", "", fmt.Errorf("invalid term %q: expected key, operator and value", term)
+	}
+
+	op := term[i : i+1]
+	if (op == "<" || op == ">") && strings.HasPrefix(term[i+1:], "=") {
+		op += "="
+	}
+
+	return term[:i], op, term[i+len(op):], nil
+}
+
+// splitQuery splits on whitespace, keeping double quoted sections together
+// and removing the quotes.
+func splitQuery(query string) ([]string, error) {
+	var (
+		terms  []string
+		cur    strings.Builder
+		quoted bool
+		inTerm bool
+	)
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inTerm = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if inTerm {
+				terms = append(terms, cur.String())
+				cur.Reset()
+				inTerm = false
+			}
+		default:
+			cur.WriteRune(r)
+			inTerm = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query %q", query)
+	}
+
+	if inTerm {
+		terms = append(terms, cur.String())
+	}
+
+	return terms, nil
+}
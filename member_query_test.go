@@ -0,0 +1,177 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func int64p(i int64) *int64 {
+	return &i
+}
+
+func testQueryMembers() []*spec.Member {
+	now := time.Now()
+	ms := func(ago time.Duration) *int64 { return int64p(now.Add(-ago).UnixNano() / int64(time.Millisecond)) }
+
+	return []*spec.Member{
+		{
+			NodeId:              stringp("aaaaaaaaaa"),
+			Name:                stringp("web-1"),
+			Description:         stringp("frontend"),
+			LastOnline:          ms(time.Minute),
+			SupportsRulesEngine: boolp(true),
+			Config: &spec.MemberConfig{
+				Authorized:         boolp(true),
+				Capabilities:       &[]int{1},
+				IpAssignments:      stringSlicePtr("10.0.0.1"),
+				Tags:               &[][]interface{}{{float64(100), float64(1)}},
+				CreationTime:       ms(48 * time.Hour),
+				LastAuthorizedTime: ms(47 * time.Hour),
+				VMajor:             intp(1), VMinor: intp(12), VRev: intp(2),
+			},
+		},
+		{
+			NodeId:      stringp("bbbbbbbbbb"),
+			Name:        stringp("web-2"),
+			Description: stringp("frontend canary"),
+			LastOnline:  ms(72 * time.Hour),
+			Hidden:      boolp(true),
+			Config: &spec.MemberConfig{
+				Authorized:    boolp(true),
+				IpAssignments: stringSlicePtr("10.1.0.1", "fd00::1"),
+				Tags:          &[][]interface{}{{float64(100), float64(2)}},
+				CreationTime:  ms(24 * time.Hour * 10),
+				VMajor:        intp(1), VMinor: intp(8), VRev: intp(0),
+			},
+		},
+		{
+			NodeId: stringp("cccccccccc"),
+			Name:   stringp("db"),
+			Config: &spec.MemberConfig{
+				Authorized:   boolp(false),
+				CreationTime: ms(time.Hour),
+				VMajor:       intp(-1),
+			},
+		},
+	}
+}
+
+func TestMemberQuery(t *testing.T) {
+	network := &spec.Network{
+		TagsByName: &map[string]interface{}{
+			"env": map[string]interface{}{
+				"id":    float64(100),
+				"enums": map[string]interface{}{"prod": float64(1), "staging": float64(2)},
+			},
+		},
+		CapabilitiesByName: &map[string]interface{}{
+			"superuser": map[string]interface{}{"id": float64(1)},
+		},
+	}
+
+	table := map[string][]string{
+		"":                                 {"aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"},
+		"authorized=true":                  {"aaaaaaaaaa", "bbbbbbbbbb"},
+		"!authorized=true":                 {"cccccccccc"},
+		"online=1h":                        {"aaaaaaaaaa"},
+		"online=7d":                        {"aaaaaaaaaa", "bbbbbbbbbb"},
+		"name=web-*":                       {"aaaaaaaaaa", "bbbbbbbbbb"},
+		"name~^d":                          {"cccccccccc"},
+		`description="frontend canary"`:    {"bbbbbbbbbb"},
+		"description~canary$":              {"bbbbbbbbbb"},
+		"tag.env=prod":                     {"aaaaaaaaaa"},
+		"tag.env=2":                        {"bbbbbbbbbb"},
+		"cap=superuser":                    {"aaaaaaaaaa"},
+		"cap=2":                            {},
+		"ip=10.0.0.0/8":                    {"aaaaaaaaaa", "bbbbbbbbbb"},
+		"ip=10.1.0.1":                      {"bbbbbbbbbb"},
+		"ip=fd00::/8":                      {"bbbbbbbbbb"},
+		"version>=1.10":                    {"aaaaaaaaaa"},
+		"version<1.10":                     {"bbbbbbbbbb"},
+		"version=1.8":                      {"bbbbbbbbbb"},
+		"version<=1.12.2 version>1.8.0":    {"aaaaaaaaaa"},
+		"rules=true":                       {"aaaaaaaaaa"},
+		"hidden=true":                      {"bbbbbbbbbb"},
+		"created>=3d":                      {"aaaaaaaaaa", "cccccccccc"},
+		"created<3d":                       {"bbbbbbbbbb"},
+		"authorizedAt>=1970-01-01":         {"aaaaaaaaaa"},
+		"sort=-name":                       {"bbbbbbbbbb", "aaaaaaaaaa", "cccccccccc"},
+		"sort=name":                        {"cccccccccc", "aaaaaaaaaa", "bbbbbbbbbb"},
+		"sort=-lastOnline authorized=true": {"aaaaaaaaaa", "bbbbbbbbbb"},
+		"sort=lastOnline":                  {"cccccccccc", "bbbbbbbbbb", "aaaaaaaaaa"},
+		"sort=-clientVersion":              {"aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"},
+	}
+
+	for query, expected := range table {
+		q, err := ParseMemberQuery(query, network)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+
+		ids := []string{}
+		for _, m := range q.Apply(testQueryMembers()) {
+			ids = append(ids, *m.NodeId)
+		}
+
+		if !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("%q: expected %v, got %v", query, expected, ids)
+		}
+	}
+
+	for _, bad := range []string{
+		"authorized", "authorized=maybe", "authorized>true", "online=soon", "name=[", "name~(",
+		"tag.owner=me", "cap=superduper", "ip=10.0.0.0/33", "version>=x", "created>=never",
+		"sort=color", "fields=nodeId,color", `name="web`, "color=red",
+	} {
+		if _, err := ParseMemberQuery(bad, network); err == nil {
+			t.Fatalf("%q parsed successfully", bad)
+		}
+	}
+}
+
+func TestMemberQueryProject(t *testing.T) {
+	q, err := ParseMemberQuery("authorized=true sort=-name fields=nodeId,name,authorized", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]interface{}{
+		{"nodeId": "bbbbbbbbbb", "name": "web-2", "authorized": true},
+		{"nodeId": "aaaaaaaaaa", "name": "web-1", "authorized": true},
+	}
+
+	if res := q.Project(testQueryMembers()); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("unexpected projection: %v", res)
+	}
+}
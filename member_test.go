@@ -32,6 +32,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -83,12 +84,7 @@ func TestGetMember(t *testing.T) {
 }
 
 func TestCRUDMembers(t *testing.T) {
-	testutil.NeedsToken(t)
-
-	c, err := NewClient(testutil.InitTokenFromEnv())
-	if err != nil {
-		t.Fatal(err)
-	}
+	c := newLiveClient(t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -109,7 +105,16 @@ func TestCRUDMembers(t *testing.T) {
 		"gopher": ztidentity.NewZeroTierIdentity(),
 	}
 
-	for name, id := range users {
+	// users and the table below are walked in name order, so that the
+	// requests match a recorded cassette.
+	var names []string
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		id := users[name]
 		_, err := c.CreateAuthorizedMember(ctx, *net.Config.Id, id.IDString(), name)
 		if err != nil {
 			t.Fatal(err)
@@ -184,8 +189,15 @@ func TestCRUDMembers(t *testing.T) {
 		},
 	}
 
+	var testNames []string
+	for testName := range table {
+		testNames = append(testNames, testName)
+	}
+	sort.Strings(testNames)
+
 	for _, member := range members {
-		for testName, harness := range table {
+		for _, testName := range testNames {
+			harness := table[testName]
 			harness.update(member)
 			updated, err := c.UpdateMember(ctx, *member.NetworkId, *member.NodeId, member)
 			if err != nil {
@@ -30,7 +30,6 @@ package ztcentral
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/zerotier/go-ztcentral/pkg/spec"
 )
@@ -50,6 +49,10 @@ func (c *Client) GetNetworks(ctx context.Context) ([]*spec.Network, error) {
 func (c *Client) GetNetwork(ctx context.Context, networkID string) (*spec.Network, error) {
 	res := &spec.Network{}
 
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return res, err
+	}
+
 	resp, err := c.specClient.GetNetworkByID(ctx, networkID)
 	if err != nil {
 		return res, err
@@ -59,8 +62,25 @@ func (c *Client) GetNetwork(ctx context.Context, networkID string) (*spec.Networ
 }
 
 func (c *Client) UpdateNetwork(ctx context.Context, id string, network *spec.Network) (*spec.Network, error) {
+	return c.updateNetwork(ctx, id, network, "update network "+id)
+}
+
+// updateNetwork is UpdateNetwork, with the summary recorded in dry-run mode.
+func (c *Client) updateNetwork(ctx context.Context, id string, network *spec.Network, summary string) (*spec.Network, error) {
 	res := &spec.Network{}
 
+	if _, err := ParseNetworkID(id); err != nil {
+		return res, err
+	}
+
+	if err := c.preflightNetwork(network); err != nil {
+		return res, err
+	}
+
+	if c.dryRun != nil {
+		return c.dryRunUpdateNetwork(ctx, id, network, summary)
+	}
+
 	resp, err := c.specClient.UpdateNetwork(ctx, id, spec.UpdateNetworkJSONRequestBody(*network))
 	if err != nil {
 		return res, err
@@ -70,7 +90,7 @@ func (c *Client) UpdateNetwork(ctx context.Context, id string, network *spec.Net
 }
 
 func (c *Client) UpdateNetworkRules(ctx context.Context, id, source string) (string, error) {
-	net, err := c.UpdateNetwork(ctx, id, &spec.Network{Id: &id, RulesSource: &source})
+	net, err := c.updateNetwork(ctx, id, &spec.Network{Id: &id, RulesSource: &source}, "update rules of network "+id)
 	if err != nil {
 		return "", err
 	}
@@ -91,6 +111,14 @@ func (c *Client) NewNetwork(ctx context.Context, name string, n *spec.Network) (
 
 	newnet := &spec.Network{}
 
+	if err := c.preflightNetwork(n); err != nil {
+		return newnet, err
+	}
+
+	if c.dryRun != nil {
+		return c.dryRunNewNetwork(n)
+	}
+
 	net, err := c.decomposeStruct(n)
 	if err != nil {
 		return newnet, err
@@ -105,6 +133,14 @@ func (c *Client) NewNetwork(ctx context.Context, name string, n *spec.Network) (
 }
 
 func (c *Client) DeleteNetwork(ctx context.Context, networkID string) error {
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return err
+	}
+
+	if c.dryRun != nil {
+		return c.dryRunDeleteNetwork(ctx, networkID)
+	}
+
 	resp, err := c.specClient.DeleteNetwork(ctx, networkID)
 	if err != nil {
 		return err
@@ -113,8 +149,16 @@ func (c *Client) DeleteNetwork(ctx context.Context, networkID string) error {
 	resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("Status was %v: %w", resp.StatusCode, ErrStatus)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	return nil
 }
+
+func (c *Client) preflightNetwork(n *spec.Network) error {
+	if !c.validateNetworks {
+		return nil
+	}
+
+	return ValidateNetwork(n).Err()
+}
@@ -46,17 +46,12 @@ func intp(i int) *int {
 }
 
 func TestNetworkCRUD(t *testing.T) {
-	testutil.NeedsToken(t)
-
-	c, err := NewClient(testutil.InitTokenFromEnv())
-	if err != nil {
-		t.Fatal(err)
-	}
+	c := newLiveClient(t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	_, err = c.GetNetwork(ctx, "8056c2e21c000001")
+	_, err := c.GetNetwork(ctx, "8056c2e21c000001")
 	if err == nil {
 		t.Fatal("Was able to fetch network we don't know about")
 	}
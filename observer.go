@@ -0,0 +1,232 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Observer receives callbacks for every request the client makes, for tracing
+// and metrics. Observers never see request headers, so the API token is not
+// exposed to them.
+//
+// OnRequest is called once per call before anything is sent, and the context
+// it returns is used for the rest of the request and passed to the other
+// callbacks; OnResponse is called once when the call completes.
+// OnRateLimitWait is called in between, before the client sleeps. The client
+// does not retry requests itself; OnRetry is called when a retry policy
+// layered on the client reports a retry with NotifyRetry.
+type Observer interface {
+	OnRequest(ctx context.Context, req RequestInfo) context.Context
+	OnResponse(ctx context.Context, req RequestInfo, resp ResponseInfo)
+	OnRetry(ctx context.Context, req RequestInfo, retry RetryInfo)
+	OnRateLimitWait(ctx context.Context, req RequestInfo, delay time.Duration)
+}
+
+// RequestInfo describes a request to Central.
+type RequestInfo struct {
+	// Operation is the API operation, such as "GetNetworkMemberList", or
+	// empty if the request is not one of Central's operations.
+	Operation string
+	Method    string
+	// Path is relative to the base URL, e.g. "/network/8056c2e21c000001".
+	Path string
+	// NetworkID and MemberID are taken from the path, when present.
+	NetworkID string
+	MemberID  string
+}
+
+// ResponseInfo describes the outcome of a request.
+type ResponseInfo struct {
+	// StatusCode is zero if no response was received, in which case Err is
+	// set.
+	StatusCode int
+	Err        error
+	// Duration covers the whole call, including rate limit waits.
+	Duration time.Duration
+	// Retries is the number of retries reported with NotifyRetry during the
+	// call.
+	Retries   int
+	RateLimit RateLimitHeaders
+}
+
+// RetryInfo describes a failed attempt that is about to be retried.
+type RetryInfo struct {
+	// Attempt is the attempt that failed, starting at 1.
+	Attempt    int
+	StatusCode int
+	Err        error
+	Delay      time.Duration
+}
+
+// ObserverFuncs is an Observer calling whichever of its functions are set.
+type ObserverFuncs struct {
+	Request       func(ctx context.Context, req RequestInfo) context.Context
+	Response      func(ctx context.Context, req RequestInfo, resp ResponseInfo)
+	Retry         func(ctx context.Context, req RequestInfo, retry RetryInfo)
+	RateLimitWait func(ctx context.Context, req RequestInfo, delay time.Duration)
+}
+
+// OnRequest implements Observer.
+func (o ObserverFuncs) OnRequest(ctx context.Context, req RequestInfo) context.Context {
+	if o.Request != nil {
+		return o.Request(ctx, req)
+	}
+
+	return ctx
+}
+
+// OnResponse implements Observer.
+func (o ObserverFuncs) OnResponse(ctx context.Context, req RequestInfo, resp ResponseInfo) {
+	if o.Response != nil {
+		o.Response(ctx, req, resp)
+	}
+}
+
+// OnRetry implements Observer.
+func (o ObserverFuncs) OnRetry(ctx context.Context, req RequestInfo, retry RetryInfo) {
+	if o.Retry != nil {
+		o.Retry(ctx, req, retry)
+	}
+}
+
+// OnRateLimitWait implements Observer.
+func (o ObserverFuncs) OnRateLimitWait(ctx context.Context, req RequestInfo, delay time.Duration) {
+	if o.RateLimitWait != nil {
+		o.RateLimitWait(ctx, req, delay)
+	}
+}
+
+// AddObserver adds an observer to the client. Like the other setters, it must
+// not be called while requests are in flight.
+func (c *Client) AddObserver(o Observer) {
+	c.observers = append(c.observers, o)
+}
+
+// NotifyRetry calls the observers' OnRetry, for retry policies layered on the
+// client. A policy in the transport (see SetTransport) passes the request's
+// context, and may leave req empty: the retry is attributed to the call in
+// flight and counted in its ResponseInfo.Retries. A policy wrapping the
+// client's methods passes its own context and describes the call in req.
+func (c *Client) NotifyRetry(ctx context.Context, req RequestInfo, retry RetryInfo) {
+	if call, ok := ctx.Value(callKey{}).(*call); ok {
+		atomic.AddInt32(&call.retries, 1)
+
+		if req == (RequestInfo{}) {
+			req = call.info
+		}
+	}
+
+	for _, o := range c.observers {
+		o.OnRetry(ctx, req, retry)
+	}
+}
+
+type callKey struct{}
+
+// call is the state of a call in flight that NotifyRetry updates.
+type call struct {
+	info    RequestInfo
+	retries int32
+}
+
+// operations maps Central's API operations to their method and path, with
+// "*" matching any single segment.
+var operations = []struct {
+	method, path, name string
+}{
+	{http.MethodGet, "/network", "GetNetworkList"},
+	{http.MethodPost, "/network", "NewNetwork"},
+	{http.MethodGet, "/network/*", "GetNetworkByID"},
+	{http.MethodPost, "/network/*", "UpdateNetwork"},
+	{http.MethodDelete, "/network/*", "DeleteNetwork"},
+	{http.MethodGet, "/network/*/member", "GetNetworkMemberList"},
+	{http.MethodGet, "/network/*/member/*", "GetNetworkMember"},
+	{http.MethodPost, "/network/*/member/*", "UpdateNetworkMember"},
+	{http.MethodDelete, "/network/*/member/*", "DeleteNetworkMember"},
+	{http.MethodGet, "/org", "GetOrganization"},
+	{http.MethodGet, "/org/*", "GetOrganizationByID"},
+	{http.MethodGet, "/org/*/user", "GetOrganizationMembers"},
+	{http.MethodGet, "/org-invitation", "GetOrganizationInvitationList"},
+	{http.MethodPost, "/org-invitation", "InviteUserByEmail"},
+	{http.MethodGet, "/org-invitation/*", "GetInvitationByID"},
+	{http.MethodPost, "/org-invitation/*", "AcceptInvitation"},
+	{http.MethodDelete, "/org-invitation/*", "DeclineInvitation"},
+	{http.MethodGet, "/randomToken", "GetRandomToken"},
+	{http.MethodGet, "/status", "GetStatus"},
+	{http.MethodGet, "/user/*", "GetUserByID"},
+	{http.MethodPost, "/user/*", "UpdateUserByID"},
+	{http.MethodDelete, "/user/*", "DeleteUserByID"},
+	{http.MethodPost, "/user/*/token", "AddAPIToken"},
+	{http.MethodDelete, "/user/*/token/*", "DeleteAPIToken"},
+}
+
+func (c *Client) requestInfo(req *http.Request) RequestInfo {
+	info := RequestInfo{
+		Method: req.Method,
+		Path:   strings.TrimPrefix(req.URL.Path, c.basePath),
+	}
+
+	segments := strings.Split(strings.Trim(info.Path, "/"), "/")
+
+	if len(segments) >= 2 && segments[0] == "network" {
+		info.NetworkID = segments[1]
+
+		if len(segments) >= 4 && segments[2] == "member" {
+			info.MemberID = segments[3]
+		}
+	}
+
+	for _, op := range operations {
+		if op.method == req.Method && pathMatches(strings.Split(strings.Trim(op.path, "/"), "/"), segments) {
+			info.Operation = op.name
+			break
+		}
+	}
+
+	return info
+}
+
+func pathMatches(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+type observed struct {
+	mutex     sync.Mutex
+	requests  []RequestInfo
+	responses []ResponseInfo
+	retries   []RetryInfo
+	waits     int
+}
+
+func (o *observed) funcs() ObserverFuncs {
+	return ObserverFuncs{
+		Request: func(ctx context.Context, req RequestInfo) context.Context {
+			o.mutex.Lock()
+			defer o.mutex.Unlock()
+
+			o.requests = append(o.requests, req)
+			return ctx
+		},
+		Response: func(ctx context.Context, req RequestInfo, resp ResponseInfo) {
+			o.mutex.Lock()
+			defer o.mutex.Unlock()
+
+			o.responses = append(o.responses, resp)
+		},
+		Retry: func(ctx context.Context, req RequestInfo, retry RetryInfo) {
+			o.mutex.Lock()
+			defer o.mutex.Unlock()
+
+			o.retries = append(o.retries, retry)
+		},
+		RateLimitWait: func(ctx context.Context, req RequestInfo, delay time.Duration) {
+			o.mutex.Lock()
+			defer o.mutex.Unlock()
+
+			o.waits++
+		},
+	}
+}
+
+func TestObserver(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0123456789")})
+
+	o := &observed{}
+	c.AddObserver(o.funcs())
+
+	failures := 0
+	fc.Fail = func(r *http.Request) int {
+		if failures > 0 {
+			failures--
+			return http.StatusServiceUnavailable
+		}
+
+		return 0
+	}
+
+	ctx := context.Background()
+
+	if _, err := c.GetMember(ctx, *n.Id, "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := RequestInfo{
+		Operation: "GetNetworkMember",
+		Method:    http.MethodGet,
+		Path:      "/network/" + *n.Id + "/member/0123456789",
+		NetworkID: *n.Id,
+		MemberID:  "0123456789",
+	}
+
+	if len(o.requests) != 1 || o.requests[0] != expected {
+		t.Fatalf("unexpected requests: %+v", o.requests)
+	}
+
+	if len(o.responses) != 1 || o.responses[0].StatusCode != http.StatusOK || o.responses[0].Duration <= 0 {
+		t.Fatalf("unexpected responses: %+v", o.responses)
+	}
+
+	failures = 1
+	if _, err := c.UpdateMember(ctx, *n.Id, "0123456789", &spec.Member{Name: stringp("web")}); err == nil {
+		t.Fatal("expected the update to fail")
+	}
+
+	last := o.responses[len(o.responses)-1]
+	if o.requests[1].Operation != "UpdateNetworkMember" || last.StatusCode != http.StatusServiceUnavailable || len(o.retries) != 0 {
+		t.Fatalf("unexpected update: %+v %+v", o.requests[1], last)
+	}
+
+	fc.RateLimit, fc.RateRemaining = 20, 19
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetNetworks(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if o.waits != 1 || o.requests[len(o.requests)-1].Operation != "GetNetworkList" {
+		t.Fatalf("expected one rate limit wait, got %d", o.waits)
+	}
+}
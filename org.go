@@ -0,0 +1,187 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// GetOrganization returns the organization of the client's user.
+func (c *Client) GetOrganization(ctx context.Context) (*spec.Organization, error) {
+	res := &spec.Organization{}
+
+	resp, err := c.specClient.GetOrganization(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	return res, c.decode(resp, res)
+}
+
+// GetOrganizationByID returns an organization by its ID.
+func (c *Client) GetOrganizationByID(ctx context.Context, orgID string) (*spec.Organization, error) {
+	res := &spec.Organization{}
+
+	resp, err := c.specClient.GetOrganizationByID(ctx, orgID)
+	if err != nil {
+		return res, err
+	}
+
+	return res, c.decode(resp, res)
+}
+
+// GetOrganizationMembers returns the members of an organization.
+func (c *Client) GetOrganizationMembers(ctx context.Context, orgID string) ([]*spec.OrganizationMember, error) {
+	var res []*spec.OrganizationMember
+
+	resp, err := c.specClient.GetOrganizationMembers(ctx, orgID)
+	if err != nil {
+		return res, err
+	}
+
+	return res, c.decode(resp, &res)
+}
+
+// GetInvitations returns the invitations of the client's organization.
+func (c *Client) GetInvitations(ctx context.Context) ([]*spec.OrganizationInvitation, error) {
+	var res []*spec.OrganizationInvitation
+
+	resp, err := c.specClient.GetOrganizationInvitationList(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	var invitations []*invitation
+	if err := c.decode(resp, &invitations); err != nil {
+		return res, err
+	}
+
+	for _, inv := range invitations {
+		res = append(res, inv.spec())
+	}
+
+	return res, nil
+}
+
+// GetInvitation returns an invitation by its ID.
+func (c *Client) GetInvitation(ctx context.Context, inviteID string) (*spec.OrganizationInvitation, error) {
+	resp, err := c.specClient.GetInvitationByID(ctx, inviteID)
+	if err != nil {
+		return &spec.OrganizationInvitation{}, err
+	}
+
+	return c.decodeInvitation(resp)
+}
+
+// InviteUser invites a user to the client's organization by email.
+func (c *Client) InviteUser(ctx context.Context, email string) (*spec.OrganizationInvitation, error) {
+	if c.dryRun != nil {
+		return c.dryRunInviteUser(email), nil
+	}
+
+	resp, err := c.specClient.InviteUserByEmail(ctx, spec.InviteUserByEmailJSONRequestBody{Email: &email})
+	if err != nil {
+		return &spec.OrganizationInvitation{}, err
+	}
+
+	return c.decodeInvitation(resp)
+}
+
+// AcceptInvitation accepts an invitation to an organization.
+func (c *Client) AcceptInvitation(ctx context.Context, inviteID string) (*spec.OrganizationInvitation, error) {
+	if c.dryRun != nil {
+		return c.dryRunAnswerInvitation(ctx, inviteID, spec.InviteStatusAccepted)
+	}
+
+	resp, err := c.specClient.AcceptInvitation(ctx, inviteID)
+	if err != nil {
+		return &spec.OrganizationInvitation{}, err
+	}
+
+	return c.decodeInvitation(resp)
+}
+
+// DeclineInvitation declines an invitation to an organization.
+func (c *Client) DeclineInvitation(ctx context.Context, inviteID string) (*spec.OrganizationInvitation, error) {
+	if c.dryRun != nil {
+		return c.dryRunAnswerInvitation(ctx, inviteID, spec.InviteStatusCanceled)
+	}
+
+	resp, err := c.specClient.DeclineInvitation(ctx, inviteID)
+	if err != nil {
+		return &spec.OrganizationInvitation{}, err
+	}
+
+	return c.decodeInvitation(resp)
+}
+
+// InvitationStatus returns the status of an invitation, or "" if it has none.
+func InvitationStatus(inv *spec.OrganizationInvitation) spec.InviteStatus {
+	if inv.Status == nil {
+		return ""
+	}
+
+	return inv.Status.InviteStatus
+}
+
+// invitation decodes an invitation. The generated status field expects an
+// object, but Central sends a plain string.
+type invitation struct {
+	spec.OrganizationInvitation
+	Status *spec.InviteStatus `json:"status,omitempty"`
+}
+
+func (inv *invitation) spec() *spec.OrganizationInvitation {
+	res := inv.OrganizationInvitation
+	if inv.Status != nil {
+		withInviteStatus(&res, *inv.Status)
+	}
+
+	return &res
+}
+
+func withInviteStatus(inv *spec.OrganizationInvitation, status spec.InviteStatus) *spec.OrganizationInvitation {
+	inv.Status = &struct {
+		spec.InviteStatus `yaml:",inline"`
+	}{status}
+
+	return inv
+}
+
+func (c *Client) decodeInvitation(resp *http.Response) (*spec.OrganizationInvitation, error) {
+	inv := &invitation{}
+	if err := c.decode(resp, inv); err != nil {
+		return &spec.OrganizationInvitation{}, err
+	}
+
+	return inv.spec(), nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func TestOrganization(t *testing.T) {
+	c, fc := newFakeClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	fc.AddOrgMember(&spec.OrganizationMember{UserId: stringp(testutil.FakeUserID), Email: stringp("owner@example.com")})
+
+	org, err := c.GetOrganization(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *org.Id != testutil.FakeOrgID || len(*org.Members) != 1 {
+		t.Fatalf("unexpected organization: %+v", org)
+	}
+
+	members, err := c.GetOrganizationMembers(ctx, *org.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 1 || *members[0].Email != "owner@example.com" {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+
+	inv, err := c.InviteUser(ctx, "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if InvitationStatus(inv) != spec.InviteStatusPending || *inv.Email != "new@example.com" {
+		t.Fatalf("unexpected invitation: %+v", inv)
+	}
+
+	if inv, err = c.AcceptInvitation(ctx, *inv.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	invitations, err := c.GetInvitations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(invitations) != 1 || InvitationStatus(invitations[0]) != spec.InviteStatusAccepted {
+		t.Fatalf("unexpected invitations: %+v", invitations)
+	}
+
+	if _, err := c.GetInvitation(ctx, "missing"); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
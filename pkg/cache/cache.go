@@ -0,0 +1,254 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package cache wraps a ztcentral.Client with a response cache, for
+// dashboards and bots that read the same networks and members repeatedly.
+//
+// Network and member reads are cached for a TTL per resource, and concurrent
+// identical reads share one request. Writes made through the cached client
+// invalidate what they affect; writes made elsewhere are seen once the TTL
+// passes, or after InvalidateNetwork.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+const (
+	// DefaultNetworkTTL is how long networks are cached when
+	// Options.NetworkTTL is not set.
+	DefaultNetworkTTL = time.Minute
+	// DefaultMemberTTL is how long members are cached when Options.MemberTTL
+	// is not set. Members change more often than networks, as they come
+	// online.
+	DefaultMemberTTL = 30 * time.Second
+)
+
+// Options configure a Client.
+type Options struct {
+	// NetworkTTL applies to GetNetworks and GetNetwork.
+	NetworkTTL time.Duration
+	// MemberTTL applies to GetMembers and GetMember.
+	MemberTTL time.Duration
+	// Store defaults to an LRU of DefaultLRUSize entries.
+	Store Store
+}
+
+// Client is a ztcentral.Client with cached network and member reads. Methods
+// of the embedded client that are not overridden here are neither cached nor
+// invalidating; the ones that change members are overridden to invalidate.
+type Client struct {
+	*ztcentral.Client
+
+	networkTTL time.Duration
+	memberTTL  time.Duration
+	store      Store
+
+	mutex sync.Mutex
+	// epoch counts invalidations, so that a read racing with a write does
+	// not store what it read before the write.
+	epoch   uint64
+	flights map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// New wraps the client.
+func New(c *ztcentral.Client, opts Options) *Client {
+	cc := &Client{
+		Client:     c,
+		networkTTL: opts.NetworkTTL,
+		memberTTL:  opts.MemberTTL,
+		store:      opts.Store,
+		flights:    map[string]*flight{},
+	}
+
+	if cc.networkTTL <= 0 {
+		cc.networkTTL = DefaultNetworkTTL
+	}
+
+	if cc.memberTTL <= 0 {
+		cc.memberTTL = DefaultMemberTTL
+	}
+
+	if cc.store == nil {
+		cc.store = NewLRU(0)
+	}
+
+	return cc
+}
+
+func networksKey() string {
+	return "networks"
+}
+
+func networkKey(networkID string) string {
+	return "network/" + networkID
+}
+
+func membersKey(networkID string) string {
+	return "members/" + networkID
+}
+
+func memberKey(networkID, memberID string) string {
+	return "member/" + networkID + "/" + memberID
+}
+
+// GetNetworks is ztcentral.Client.GetNetworks, cached for the network TTL.
+func (c *Client) GetNetworks(ctx context.Context) ([]*spec.Network, error) {
+	var res []*spec.Network
+
+	return res, c.get(networksKey(), c.networkTTL, &res, func() (interface{}, error) {
+		return c.Client.GetNetworks(ctx)
+	})
+}
+
+// GetNetwork is ztcentral.Client.GetNetwork, cached for the network TTL.
+func (c *Client) GetNetwork(ctx context.Context, networkID string) (*spec.Network, error) {
+	var res *spec.Network
+
+	return res, c.get(networkKey(networkID), c.networkTTL, &res, func() (interface{}, error) {
+		return c.Client.GetNetwork(ctx, networkID)
+	})
+}
+
+// GetMembers is ztcentral.Client.GetMembers, cached for the member TTL.
+func (c *Client) GetMembers(ctx context.Context, networkID string) ([]*spec.Member, error) {
+	var res []*spec.Member
+
+	return res, c.get(membersKey(networkID), c.memberTTL, &res, func() (interface{}, error) {
+		return c.Client.GetMembers(ctx, networkID)
+	})
+}
+
+// GetMember is ztcentral.Client.GetMember, cached for the member TTL.
+func (c *Client) GetMember(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	var res *spec.Member
+
+	return res, c.get(memberKey(networkID, memberID), c.memberTTL, &res, func() (interface{}, error) {
+		return c.Client.GetMember(ctx, networkID, memberID)
+	})
+}
+
+// Search is ztcentral.Client.Search, with networks and member lists read
+// through the cache.
+func (c *Client) Search(ctx context.Context, query string) ([]ztcentral.SearchResult, error) {
+	return ztcentral.SearchMembers(ctx, c, query)
+}
+
+// get decodes the cached value of key into res, fetching and storing it on a
+// miss. Concurrent misses for the same key share one fetch. Values are stored
+// encoded, so every caller gets its own copy to modify. Errors are not cached.
+func (c *Client) get(key string, ttl time.Duration, res interface{}, fetch func() (interface{}, error)) error {
+	if value, ok := c.store.Get(key); ok {
+		if err := json.Unmarshal(value, res); err == nil {
+			return nil
+		}
+	}
+
+	c.mutex.Lock()
+	f, ok := c.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		c.flights[key] = f
+		epoch := c.epoch
+		c.mutex.Unlock()
+
+		c.fly(key, ttl, epoch, f, fetch)
+	} else {
+		c.mutex.Unlock()
+		<-f.done
+	}
+
+	if f.err != nil {
+		return f.err
+	}
+
+	return json.Unmarshal(f.value, res)
+}
+
+func (c *Client) fly(key string, ttl time.Duration, epoch uint64, f *flight, fetch func() (interface{}, error)) {
+	defer close(f.done)
+
+	v, err := fetch()
+	if err == nil {
+		f.value, err = json.Marshal(v)
+	}
+	f.err = err
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+
+	if err == nil && c.epoch == epoch {
+		c.store.Set(key, f.value, ttl)
+	}
+}
+
+// invalidate deletes keys and stops reads in flight from storing what they
+// read.
+func (c *Client) invalidate(keys ...string) {
+	c.store.Delete(keys...)
+
+	c.mutex.Lock()
+	c.epoch++
+	c.flights = map[string]*flight{}
+	c.mutex.Unlock()
+}
+
+// invalidateMember drops a member, its network's member list, and the network
+// records, whose member counts change with it.
+func (c *Client) invalidateMember(networkID, memberID string) {
+	c.invalidate(networksKey(), networkKey(networkID), membersKey(networkID), memberKey(networkID, memberID))
+}
+
+// InvalidateNetwork drops everything cached about a network and its members,
+// for use after changing it through another client.
+func (c *Client) InvalidateNetwork(networkID string) {
+	c.store.DeletePrefix(memberKey(networkID, ""))
+	c.invalidate(networksKey(), networkKey(networkID), membersKey(networkID))
+}
+
+// InvalidateAll empties the cache.
+func (c *Client) InvalidateAll() {
+	c.store.DeletePrefix("")
+	c.invalidate()
+}
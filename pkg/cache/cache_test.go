@@ -0,0 +1,279 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func stringp(s string) *string {
+	return &s
+}
+
+func newCachedClient(t *testing.T, opts Options) (*Client, *testutil.FakeCentral) {
+	fc := testutil.NewFakeCentral()
+	t.Cleanup(fc.Close)
+
+	c, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	return New(c, opts), fc
+}
+
+// countRequests counts the requests made to the fake whose method and path
+// start with prefix, such as "GET /api/network".
+func countRequests(fc *testutil.FakeCentral, prefix string) int {
+	var n int
+	for _, r := range fc.Requests() {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestCache(t *testing.T) {
+	lru := NewLRU(0)
+	now := time.Now()
+	lru.now = func() time.Time { return now }
+
+	c, fc := newCachedClient(t, Options{Store: lru})
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0123456789"), Name: stringp("web")})
+
+	ctx := context.Background()
+	membersPath := "GET /api/network/" + *n.Id + "/member"
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetNetworks(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := c.GetMember(ctx, *n.Id, "0123456789")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *m.Name != "web" {
+			t.Fatalf("unexpected name %q", *m.Name)
+		}
+
+		// callers get their own copies.
+		m.Name = stringp("changed")
+	}
+
+	if countRequests(fc, "GET /api/network") != 2 {
+		t.Fatalf("expected one request for networks and one for the member, got %v", fc.Requests())
+	}
+
+	if _, err := c.GetMembers(ctx, *n.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.UpdateMember(ctx, *n.Id, "0123456789", &spec.Member{Name: stringp("db")}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := c.GetMember(ctx, *n.Id, "0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *m.Name != "db" {
+		t.Fatalf("expected the update to invalidate the member, got %q", *m.Name)
+	}
+
+	if _, err := c.GetMembers(ctx, *n.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if countRequests(fc, membersPath) != 4 {
+		t.Fatalf("expected the member and member list to be refetched, got %v", fc.Requests())
+	}
+
+	// the update changed the network's member counts, so it is refetched too.
+	if _, err := c.GetNetworks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// members expire before networks.
+	now = now.Add(DefaultMemberTTL)
+
+	if _, err := c.GetNetworks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetMembers(ctx, *n.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if countRequests(fc, "GET /api/network") != 7 {
+		t.Fatalf("expected only the members to be refetched, got %v", fc.Requests())
+	}
+
+	// errors are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetNetwork(ctx, "8056c2e21cffffff"); !ztcentral.IsNotFound(err) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+
+	if countRequests(fc, "GET /api/network/8056c2e21cffffff") != 2 {
+		t.Fatalf("expected the failure to be retried, got %v", fc.Requests())
+	}
+
+	if err := c.DeleteNetwork(ctx, *n.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetMember(ctx, *n.Id, "0123456789"); err == nil {
+		t.Fatal("expected the member of the deleted network to be gone")
+	}
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	c, fc := newCachedClient(t, Options{})
+	n := fc.AddNetwork(&spec.Network{})
+
+	var requests int32
+	release := make(chan struct{})
+
+	fc.Fail = func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/member") {
+			atomic.AddInt32(&requests, 1)
+			<-release
+		}
+
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := c.GetMembers(context.Background(), *n.Id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if requests != 1 {
+		t.Fatalf("expected concurrent reads to share one request, got %d", requests)
+	}
+}
+
+func TestCacheSearch(t *testing.T) {
+	c, fc := newCachedClient(t, Options{})
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0123456789"), Name: stringp("web")})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, err := c.Search(ctx, "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 || res[0].Reason != ztcentral.MatchName {
+			t.Fatalf("unexpected results: %+v", res)
+		}
+	}
+
+	if countRequests(fc, "GET /api/network/"+*n.Id+"/member") != 1 {
+		t.Fatalf("member list was not cached: %v", fc.Requests())
+	}
+
+	// the client's own writes are seen straight away.
+	if _, err := c.UpdateMember(ctx, *n.Id, "0123456789", &spec.Member{Name: stringp("db")}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Search(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || *res[0].Member.Name != "db" {
+		t.Fatalf("unexpected results: %+v", res)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	l := NewLRU(2)
+
+	l.Set("a", []byte("1"), time.Minute)
+	l.Set("b", []byte("2"), time.Minute)
+
+	// reading a makes b the least recently used.
+	if _, ok := l.Get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+
+	l.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+
+	if v, ok := l.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("unexpected a: %q", v)
+	}
+
+	l.Set("member/1/a", nil, time.Minute)
+	l.DeletePrefix("member/1/")
+	l.Delete("c")
+
+	if l.Len() != 1 {
+		t.Fatalf("expected only a to be left, got %d entries", l.Len())
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLRUSize is the number of entries NewLRU keeps when given a size of 0.
+const DefaultLRUSize = 1024
+
+// Store holds cached responses as encoded bytes. Implementations must be safe
+// for concurrent use. The in-memory LRU is the default; a shared backend such
+// as Redis or memcached lets several processes share one cache and its
+// invalidations.
+type Store interface {
+	// Get returns the value of an unexpired key.
+	Get(key string) ([]byte, bool)
+	// Set stores a value for ttl.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes keys, ignoring those that are not present.
+	Delete(keys ...string)
+	// DeletePrefix removes every key starting with prefix.
+	DeletePrefix(prefix string)
+}
+
+// LRU is an in-memory Store that evicts the least recently used entry once it
+// is full.
+type LRU struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates an LRU holding up to size entries, or DefaultLRUSize if size
+// is 0.
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = DefaultLRUSize
+	}
+
+	return &LRU{size: size, order: list.New(), entries: map[string]*list.Element{}, now: time.Now}
+}
+
+// Get implements Store.
+func (l *LRU) Get(key string) ([]byte, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if !l.now().Before(entry.expires) {
+		l.remove(e)
+		return nil, false
+	}
+
+	l.order.MoveToFront(e)
+	return entry.value, true
+}
+
+// Set implements Store.
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry := &lruEntry{key: key, value: value, expires: l.now().Add(ttl)}
+
+	if e, ok := l.entries[key]; ok {
+		e.Value = entry
+		l.order.MoveToFront(e)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(entry)
+
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+// Delete implements Store.
+func (l *LRU) Delete(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, key := range keys {
+		if e, ok := l.entries[key]; ok {
+			l.remove(e)
+		}
+	}
+}
+
+// DeletePrefix implements Store.
+func (l *LRU) DeletePrefix(prefix string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, e := range l.entries {
+		if strings.HasPrefix(key, prefix) {
+			l.remove(e)
+		}
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (l *LRU) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.order.Len()
+}
+
+func (l *LRU) remove(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.entries, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// NewNetwork is ztcentral.Client.NewNetwork, invalidating the network list.
+func (c *Client) NewNetwork(ctx context.Context, name string, n *spec.Network) (*spec.Network, error) {
+	defer c.invalidate(networksKey())
+	return c.Client.NewNetwork(ctx, name, n)
+}
+
+// UpdateNetwork is ztcentral.Client.UpdateNetwork, invalidating the network.
+func (c *Client) UpdateNetwork(ctx context.Context, id string, network *spec.Network) (*spec.Network, error) {
+	defer c.invalidate(networksKey(), networkKey(id))
+	return c.Client.UpdateNetwork(ctx, id, network)
+}
+
+// UpdateNetworkRules is ztcentral.Client.UpdateNetworkRules, invalidating the
+// network.
+func (c *Client) UpdateNetworkRules(ctx context.Context, id, source string) (string, error) {
+	defer c.invalidate(networksKey(), networkKey(id))
+	return c.Client.UpdateNetworkRules(ctx, id, source)
+}
+
+// DeleteNetwork is ztcentral.Client.DeleteNetwork, invalidating the network
+// and its members.
+func (c *Client) DeleteNetwork(ctx context.Context, networkID string) error {
+	defer c.InvalidateNetwork(networkID)
+	return c.Client.DeleteNetwork(ctx, networkID)
+}
+
+// UpdateMember is ztcentral.Client.UpdateMember, invalidating the member.
+func (c *Client) UpdateMember(ctx context.Context, networkID, memberID string, m *spec.Member) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.UpdateMember(ctx, networkID, memberID, m)
+}
+
+// CreateAuthorizedMember is ztcentral.Client.CreateAuthorizedMember,
+// invalidating the member.
+func (c *Client) CreateAuthorizedMember(ctx context.Context, networkID, memberID, name string) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.CreateAuthorizedMember(ctx, networkID, memberID, name)
+}
+
+// AuthorizeMember is ztcentral.Client.AuthorizeMember, invalidating the
+// member.
+func (c *Client) AuthorizeMember(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.AuthorizeMember(ctx, networkID, memberID)
+}
+
+// DeauthorizeMember is ztcentral.Client.DeauthorizeMember, invalidating the
+// member.
+func (c *Client) DeauthorizeMember(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.DeauthorizeMember(ctx, networkID, memberID)
+}
+
+// DeleteMember is ztcentral.Client.DeleteMember, invalidating the member.
+func (c *Client) DeleteMember(ctx context.Context, networkID, memberID string) error {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.DeleteMember(ctx, networkID, memberID)
+}
+
+// AuthorizeMemberFor is ztcentral.Client.AuthorizeMemberFor, invalidating the
+// member.
+func (c *Client) AuthorizeMemberFor(ctx context.Context, networkID, memberID string, d time.Duration) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.AuthorizeMemberFor(ctx, networkID, memberID, d)
+}
+
+// ExtendAuthorization is ztcentral.Client.ExtendAuthorization, invalidating
+// the member.
+func (c *Client) ExtendAuthorization(ctx context.Context, networkID, memberID string, d time.Duration) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.ExtendAuthorization(ctx, networkID, memberID, d)
+}
+
+// RevokeAuthorization is ztcentral.Client.RevokeAuthorization, invalidating
+// the member.
+func (c *Client) RevokeAuthorization(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.RevokeAuthorization(ctx, networkID, memberID)
+}
+
+// MakeAuthorizationPermanent is ztcentral.Client.MakeAuthorizationPermanent,
+// invalidating the member.
+func (c *Client) MakeAuthorizationPermanent(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	defer c.invalidateMember(networkID, memberID)
+	return c.Client.MakeAuthorizationPermanent(ctx, networkID, memberID)
+}
+
+// BulkUpdateMembers is ztcentral.Client.BulkUpdateMembers, invalidating the
+// network's members.
+func (c *Client) BulkUpdateMembers(ctx context.Context, networkID string, ops []ztcentral.BulkMemberOp, opts ztcentral.BulkOptions) ([]ztcentral.BulkResult, error) {
+	defer c.InvalidateNetwork(networkID)
+	return c.Client.BulkUpdateMembers(ctx, networkID, ops, opts)
+}
+
+// SweepExpired is ztcentral.Client.SweepExpired, invalidating the network's
+// members.
+func (c *Client) SweepExpired(ctx context.Context, networkID string) ([]ztcentral.Expiration, error) {
+	defer c.InvalidateNetwork(networkID)
+	return c.Client.SweepExpired(ctx, networkID)
+}
+
+// PruneMembers is ztcentral.Client.PruneMembers, invalidating the network's
+// members.
+func (c *Client) PruneMembers(ctx context.Context, networkID string, policy ztcentral.PrunePolicy) (*ztcentral.PruneReport, error) {
+	defer c.InvalidateNetwork(networkID)
+	return c.Client.PruneMembers(ctx, networkID, policy)
+}
@@ -0,0 +1,487 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package exporter exposes ZeroTier Central networks and members as
+// Prometheus metrics.
+//
+// Central is read at most once per cache TTL, however often the collector is
+// scraped, so that scrapes do not use up the API rate limit.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+const (
+	// DefaultCacheTTL is how long Central's state is served from the cache
+	// when Options.CacheTTL is not set.
+	DefaultCacheTTL = time.Minute
+	// DefaultRefreshTimeout bounds a refresh started by a scrape.
+	DefaultRefreshTimeout = 30 * time.Second
+)
+
+const namespace = "ztcentral"
+
+// Options configure a Collector.
+type Options struct {
+	// NetworkIDs limits the collector to these networks. Empty collects all
+	// of them.
+	NetworkIDs []string
+	// CacheTTL defaults to DefaultCacheTTL. Every refresh costs one request
+	// per network, plus one to list networks.
+	CacheTTL time.Duration
+	// OnlineThreshold is how recently a member must have been online to be
+	// counted as online when Central does not report the count; it defaults
+	// to ztcentral.DefaultOnlineThreshold.
+	OnlineThreshold time.Duration
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Collector is a prometheus.Collector for Central. Besides the network and
+// member metrics, it reports the requests made through the client, observed
+// as they are sent, and the rate limit Central last returned.
+type Collector struct {
+	client *ztcentral.Client
+	opts   Options
+
+	mutex     sync.Mutex
+	snapshot  *snapshot
+	attempted time.Time
+	refreshed time.Time
+	lastErr   error
+
+	requests    *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	retries     *prometheus.CounterVec
+	waits       *prometheus.CounterVec
+	waitSeconds *prometheus.CounterVec
+}
+
+type snapshot struct {
+	networks []networkStats
+	pools    []ztcentral.PoolUtilization
+}
+
+type networkStats struct {
+	id, name   string
+	total      int
+	authorized int
+	online     int
+	pending    int
+	versions   map[string]int
+	lastOnline []memberOnline
+}
+
+type memberOnline struct {
+	id, name string
+	time     time.Time
+}
+
+var (
+	upDesc = prometheus.NewDesc(namespace+"_up",
+		"Whether the last refresh from Central succeeded.", nil, nil)
+	refreshedDesc = prometheus.NewDesc(namespace+"_last_refresh_timestamp_seconds",
+		"When Central was last read successfully.", nil, nil)
+
+	networkLabels  = []string{"network", "name"}
+	membersDesc    = prometheus.NewDesc(namespace+"_network_members", "Members of the network.", networkLabels, nil)
+	authorizedDesc = prometheus.NewDesc(namespace+"_network_authorized_members", "Authorized members of the network.", networkLabels, nil)
+	onlineDesc     = prometheus.NewDesc(namespace+"_network_online_members", "Online members of the network.", networkLabels, nil)
+	pendingDesc    = prometheus.NewDesc(namespace+"_network_pending_members",
+		"Members waiting for authorization: neither authorized nor hidden.", networkLabels, nil)
+	versionsDesc = prometheus.NewDesc(namespace+"_network_client_version_members",
+		"Members of the network by client version.", []string{"network", "version"}, nil)
+
+	poolLabels   = []string{"network", "start", "end"}
+	poolSizeDesc = prometheus.NewDesc(namespace+"_network_pool_size_addresses",
+		"Addresses in the assignment pool.", poolLabels, nil)
+	poolUsedDesc = prometheus.NewDesc(namespace+"_network_pool_used_addresses",
+		"Addresses of the assignment pool assigned to members.", poolLabels, nil)
+	poolRatioDesc = prometheus.NewDesc(namespace+"_network_pool_utilization_ratio",
+		"Fraction of the assignment pool assigned to members.", poolLabels, nil)
+
+	lastOnlineDesc = prometheus.NewDesc(namespace+"_member_last_online_seconds",
+		"Seconds since the member was last online.", []string{"network", "member", "name"}, nil)
+
+	rateLimitDesc = prometheus.NewDesc(namespace+"_api_rate_limit",
+		"Request limit Central last reported.", nil, nil)
+	rateLimitRemainingDesc = prometheus.NewDesc(namespace+"_api_rate_limit_remaining",
+		"Requests remaining in the rate limit window Central last reported.", nil, nil)
+)
+
+// NewCollector creates a collector reading Central through the client. It
+// adds an observer to the client, so the API metrics cover every request made
+// through it, not only the collector's own.
+func NewCollector(c *ztcentral.Client, opts Options) *Collector {
+	col := &Collector{
+		client: c,
+		opts:   opts,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_requests_total",
+			Help:      "Requests made to Central by operation and status code, or \"error\" if there was no response. Attempts reported with Client.NotifyRetry are counted.",
+		}, []string{"operation", "status"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_request_errors_total",
+			Help:      "Requests to Central that failed or returned an error status, by operation and status code.",
+		}, []string{"operation", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of calls to Central by operation, including rate limit waits and retries made in the client's transport.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_retries_total",
+			Help:      "Retries reported with Client.NotifyRetry by retry policies layered on the client, by operation.",
+		}, []string{"operation"}),
+		waits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_rate_limit_waits_total",
+			Help:      "Requests delayed to stay within the rate limit, by operation.",
+		}, []string{"operation"}),
+		waitSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_rate_limit_wait_seconds_total",
+			Help:      "Time spent waiting for the rate limit, by operation.",
+		}, []string{"operation"}),
+	}
+
+	c.AddObserver(ztcentral.ObserverFuncs{
+		Response:      col.observeResponse,
+		Retry:         col.observeRetry,
+		RateLimitWait: col.observeRateLimitWait,
+	})
+
+	return col
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		upDesc, refreshedDesc,
+		membersDesc, authorizedDesc, onlineDesc, pendingDesc, versionsDesc,
+		poolSizeDesc, poolUsedDesc, poolRatioDesc,
+		lastOnlineDesc,
+		rateLimitDesc, rateLimitRemainingDesc,
+	} {
+		ch <- d
+	}
+
+	c.requests.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+	c.retries.Describe(ch)
+	c.waits.Describe(ch)
+	c.waitSeconds.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. It refreshes the cache first if it
+// is older than the TTL; if the refresh fails, the previous state is reported,
+// ztcentral_up is 0, and Central is not tried again until the TTL has passed.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.attempted.IsZero() || c.now().Sub(c.attempted) >= c.cacheTTL() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRefreshTimeout)
+		c.refresh(ctx)
+		cancel()
+	}
+
+	up := 1.0
+	if c.lastErr != nil {
+		up = 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up)
+
+	if c.snapshot != nil {
+		ch <- prometheus.MustNewConstMetric(refreshedDesc, prometheus.GaugeValue, float64(c.refreshed.UnixNano())/1e9)
+		c.snapshot.collect(ch, c.now())
+	}
+
+	limits := c.client.RateLimits()
+	ch <- prometheus.MustNewConstMetric(rateLimitDesc, prometheus.GaugeValue, float64(limits.Limit))
+	ch <- prometheus.MustNewConstMetric(rateLimitRemainingDesc, prometheus.GaugeValue, float64(limits.Remaining))
+
+	c.requests.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+	c.retries.Collect(ch)
+	c.waits.Collect(ch)
+	c.waitSeconds.Collect(ch)
+}
+
+// Refresh reads Central into the cache now.
+func (c *Collector) Refresh(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.refresh(ctx)
+}
+
+// Run refreshes the cache every TTL until ctx is done, so that scrapes never
+// wait on Central. Refresh errors are reported through ztcentral_up.
+func (c *Collector) Run(ctx context.Context) error {
+	t := time.NewTicker(c.cacheTTL())
+	defer t.Stop()
+
+	for {
+		c.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Collector) refresh(ctx context.Context) error {
+	c.attempted = c.now()
+	s, err := c.read(ctx)
+
+	c.lastErr = err
+	if err != nil {
+		return err
+	}
+
+	c.snapshot = s
+	c.refreshed = c.attempted
+
+	return nil
+}
+
+func (c *Collector) read(ctx context.Context) (*snapshot, error) {
+	var networks []*spec.Network
+
+	if len(c.opts.NetworkIDs) == 0 {
+		var err error
+		if networks, err = c.client.GetNetworks(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, id := range c.opts.NetworkIDs {
+			n, err := c.client.GetNetwork(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("while reading %s: %w", id, err)
+			}
+
+			networks = append(networks, n)
+		}
+	}
+
+	threshold := c.opts.OnlineThreshold
+	if threshold <= 0 {
+		threshold = ztcentral.DefaultOnlineThreshold
+	}
+
+	s := &snapshot{}
+	members := map[string][]*spec.Member{}
+
+	for _, n := range networks {
+		if n.Id == nil {
+			continue
+		}
+
+		id := *n.Id
+
+		list, err := c.client.GetMembers(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("while reading members of %s: %w", id, err)
+		}
+
+		members[id] = list
+		s.networks = append(s.networks, newNetworkStats(n, list, c.now(), threshold))
+	}
+
+	s.pools = ztcentral.AnalyzeAddressPlan(networks, members).Pools
+
+	return s, nil
+}
+
+func (c *Collector) observeResponse(ctx context.Context, req ztcentral.RequestInfo, resp ztcentral.ResponseInfo) {
+	op := operation(req)
+	c.latency.WithLabelValues(op).Observe(resp.Duration.Seconds())
+	c.countRequest(op, resp.StatusCode, resp.Err)
+}
+
+// observeRetry counts the failed attempt being retried as a request of its
+// own.
+func (c *Collector) observeRetry(ctx context.Context, req ztcentral.RequestInfo, retry ztcentral.RetryInfo) {
+	op := operation(req)
+	c.retries.WithLabelValues(op).Inc()
+	c.countRequest(op, retry.StatusCode, retry.Err)
+}
+
+func (c *Collector) observeRateLimitWait(ctx context.Context, req ztcentral.RequestInfo, delay time.Duration) {
+	op := operation(req)
+	c.waits.WithLabelValues(op).Inc()
+	c.waitSeconds.WithLabelValues(op).Add(delay.Seconds())
+}
+
+func (c *Collector) countRequest(op string, statusCode int, err error) {
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+
+	c.requests.WithLabelValues(op, status).Inc()
+
+	if err != nil || statusCode >= 400 {
+		c.errors.WithLabelValues(op, status).Inc()
+	}
+}
+
+// operation labels requests that are not one of Central's operations as
+// "other".
+func operation(req ztcentral.RequestInfo) string {
+	if req.Operation == "" {
+		return "other"
+	}
+
+	return req.Operation
+}
+
+func (c *Collector) cacheTTL() time.Duration {
+	if c.opts.CacheTTL > 0 {
+		return c.opts.CacheTTL
+	}
+
+	return DefaultCacheTTL
+}
+
+func (c *Collector) now() time.Time {
+	if c.opts.Now != nil {
+		return c.opts.Now()
+	}
+
+	return time.Now()
+}
+
+// newNetworkStats counts the members. Central's member counts are used when
+// it reports them, and the member list otherwise.
+func newNetworkStats(n *spec.Network, members []*spec.Member, now time.Time, threshold time.Duration) networkStats {
+	ns := networkStats{versions: map[string]int{}}
+
+	if n.Id != nil {
+		ns.id = *n.Id
+	}
+
+	if n.Config != nil && n.Config.Name != nil {
+		ns.name = *n.Config.Name
+	}
+
+	online := ztcentral.OnlineSince(now.Add(-threshold))
+
+	for _, m := range members {
+		ns.total++
+
+		authorized := m.Config != nil && m.Config.Authorized != nil && *m.Config.Authorized
+		if authorized {
+			ns.authorized++
+		} else if m.Hidden == nil || !*m.Hidden {
+			ns.pending++
+		}
+
+		if online(m) {
+			ns.online++
+		}
+
+		version := "unknown"
+		if v, ok := ztcentral.MemberClientVersion(m); ok {
+			version = v.String()
+		}
+		ns.versions[version]++
+
+		// members without a node ID are counted, but cannot be labelled.
+		if m.NodeId != nil && m.LastOnline != nil && *m.LastOnline > 0 {
+			mo := memberOnline{id: *m.NodeId, time: time.Unix(0, *m.LastOnline*int64(time.Millisecond))}
+			if m.Name != nil {
+				mo.name = *m.Name
+			}
+
+			ns.lastOnline = append(ns.lastOnline, mo)
+		}
+	}
+
+	if n.TotalMemberCount != nil {
+		ns.total = *n.TotalMemberCount
+	}
+
+	if n.AuthorizedMemberCount != nil {
+		ns.authorized = *n.AuthorizedMemberCount
+	}
+
+	if n.OnlineMemberCount != nil {
+		ns.online = *n.OnlineMemberCount
+	}
+
+	return ns
+}
+
+func (s *snapshot) collect(ch chan<- prometheus.Metric, now time.Time) {
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+
+	for _, ns := range s.networks {
+		gauge(membersDesc, float64(ns.total), ns.id, ns.name)
+		gauge(authorizedDesc, float64(ns.authorized), ns.id, ns.name)
+		gauge(onlineDesc, float64(ns.online), ns.id, ns.name)
+		gauge(pendingDesc, float64(ns.pending), ns.id, ns.name)
+
+		for version, count := range ns.versions {
+			gauge(versionsDesc, float64(count), ns.id, version)
+		}
+
+		for _, mo := range ns.lastOnline {
+			gauge(lastOnlineDesc, now.Sub(mo.time).Seconds(), ns.id, mo.id, mo.name)
+		}
+	}
+
+	for _, p := range s.pools {
+		gauge(poolSizeDesc, float64(p.Size), p.NetworkID, p.Start, p.End)
+		gauge(poolUsedDesc, float64(p.Used), p.NetworkID, p.Start, p.End)
+		gauge(poolRatioDesc, p.Percent/100, p.NetworkID, p.Start, p.End)
+	}
+}
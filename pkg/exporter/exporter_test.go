@@ -0,0 +1,220 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	fake "github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func stringp(s string) *string {
+	return &s
+}
+
+func int64p(i int64) *int64 {
+	return &i
+}
+
+func TestCollector(t *testing.T) {
+	fc := fake.NewFakeCentral()
+	defer fc.Close()
+
+	c, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	ms := func(d time.Duration) *int64 { return int64p(now.Add(-d).UnixNano() / int64(time.Millisecond)) }
+
+	n := fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{
+		Name:              stringp("lab"),
+		Routes:            &[]spec.Route{{Target: stringp("10.0.0.0/24")}},
+		IpAssignmentPools: &[]spec.IPRange{{IpRangeStart: stringp("10.0.0.1"), IpRangeEnd: stringp("10.0.0.4")}},
+	}})
+
+	fc.AddMember(*n.Id, &spec.Member{
+		NodeId:        stringp("0000000001"),
+		Name:          stringp("web"),
+		LastOnline:    ms(time.Minute),
+		ClientVersion: stringp("1.12.2"),
+		Config:        &spec.MemberConfig{Authorized: boolp(true), IpAssignments: &[]string{"10.0.0.1"}},
+	})
+	fc.AddMember(*n.Id, &spec.Member{
+		NodeId:     stringp("0000000002"),
+		Name:       stringp("laptop"),
+		LastOnline: ms(time.Hour),
+		Config:     &spec.MemberConfig{Authorized: boolp(false)},
+	})
+	fc.AddMember(*n.Id, &spec.Member{
+		NodeId: stringp("0000000003"),
+		Hidden: boolp(true),
+		Config: &spec.MemberConfig{Authorized: boolp(false)},
+	})
+
+	col := NewCollector(c, Options{Now: func() time.Time { return now }})
+
+	expected := strings.NewReplacer("NWID", *n.Id).Replace(`
+# HELP ztcentral_member_last_online_seconds Seconds since the member was last online.
+# TYPE ztcentral_member_last_online_seconds gauge
+ztcentral_member_last_online_seconds{member="0000000001",name="web",network="NWID"} 60
+ztcentral_member_last_online_seconds{member="0000000002",name="laptop",network="NWID"} 3600
+# HELP ztcentral_network_authorized_members Authorized members of the network.
+# TYPE ztcentral_network_authorized_members gauge
+ztcentral_network_authorized_members{name="lab",network="NWID"} 1
+# HELP ztcentral_network_client_version_members Members of the network by client version.
+# TYPE ztcentral_network_client_version_members gauge
+ztcentral_network_client_version_members{network="NWID",version="1.12.2"} 1
+ztcentral_network_client_version_members{network="NWID",version="unknown"} 2
+# HELP ztcentral_network_members Members of the network.
+# TYPE ztcentral_network_members gauge
+ztcentral_network_members{name="lab",network="NWID"} 3
+# HELP ztcentral_network_online_members Online members of the network.
+# TYPE ztcentral_network_online_members gauge
+ztcentral_network_online_members{name="lab",network="NWID"} 1
+# HELP ztcentral_network_pending_members Members waiting for authorization: neither authorized nor hidden.
+# TYPE ztcentral_network_pending_members gauge
+ztcentral_network_pending_members{name="lab",network="NWID"} 1
+# HELP ztcentral_network_pool_used_addresses Addresses of the assignment pool assigned to members.
+# TYPE ztcentral_network_pool_used_addresses gauge
+ztcentral_network_pool_used_addresses{end="10.0.0.4",network="NWID",start="10.0.0.1"} 1
+# HELP ztcentral_up Whether the last refresh from Central succeeded.
+# TYPE ztcentral_up gauge
+ztcentral_up 1
+`)
+
+	if err := testutil.CollectAndCompare(col, strings.NewReader(expected),
+		"ztcentral_member_last_online_seconds",
+		"ztcentral_network_authorized_members",
+		"ztcentral_network_client_version_members",
+		"ztcentral_network_members",
+		"ztcentral_network_online_members",
+		"ztcentral_network_pending_members",
+		"ztcentral_network_pool_used_addresses",
+		"ztcentral_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// scrapes within the TTL are served from the cache.
+	requests := len(fc.Requests())
+	testutil.CollectAndCount(col)
+
+	if len(fc.Requests()) != requests {
+		t.Fatalf("scrape within the TTL made %d requests", len(fc.Requests())-requests)
+	}
+
+	if v := testutil.ToFloat64(col.requests.WithLabelValues("GetNetworkMemberList", "200")); v != 1 {
+		t.Fatalf("expected 1 GetNetworkMemberList request, got %v", v)
+	}
+
+	// requests made outside the collector are counted too, as are the rate
+	// limit waits before them.
+	fc.RateLimit, fc.RateRemaining = 20, 19
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetMember(context.Background(), *n.Id, "0000000001"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fc.RateLimit, fc.RateRemaining = 0, 0
+
+	if v := testutil.ToFloat64(col.requests.WithLabelValues("GetNetworkMember", "200")); v != 2 {
+		t.Fatalf("expected 2 GetNetworkMember requests, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(col.waits.WithLabelValues("GetNetworkMember")); v != 1 {
+		t.Fatalf("expected 1 rate limit wait, got %v", v)
+	}
+
+	// retry policies layered on the client report their retries.
+	c.NotifyRetry(context.Background(), ztcentral.RequestInfo{Operation: "GetNetworkMember"}, ztcentral.RetryInfo{Attempt: 1, StatusCode: http.StatusBadGateway})
+
+	if v := testutil.ToFloat64(col.retries.WithLabelValues("GetNetworkMember")); v != 1 {
+		t.Fatalf("expected 1 retry, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(col.errors.WithLabelValues("GetNetworkMember", "502")); v != 1 {
+		t.Fatalf("expected the retried attempt to be counted, got %v", v)
+	}
+
+	requests = len(fc.Requests())
+
+	now = now.Add(DefaultCacheTTL)
+	fc.Fail = func(r *http.Request) int { return http.StatusInternalServerError }
+	testutil.CollectAndCount(col)
+
+	if len(fc.Requests()) == requests {
+		t.Fatal("expected a refresh after the TTL")
+	}
+
+	if v := testutil.ToFloat64(col.errors.WithLabelValues("GetNetworkList", "500")); v != 1 {
+		t.Fatalf("expected 1 failed GetNetworkList request, got %v", v)
+	}
+
+	// the stale state is still reported, but ztcentral_up is 0.
+	if n := testutil.CollectAndCount(col, "ztcentral_network_members"); n != 1 {
+		t.Fatalf("expected the stale network, got %d", n)
+	}
+
+	down := "# HELP ztcentral_up Whether the last refresh from Central succeeded.\n# TYPE ztcentral_up gauge\nztcentral_up 0\n"
+	if err := testutil.CollectAndCompare(col, strings.NewReader(down), "ztcentral_up"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkStatsWithoutNodeID(t *testing.T) {
+	n := &spec.Network{Id: stringp("8056c2e21c000001")}
+	members := []*spec.Member{{LastOnline: int64p(1), Config: &spec.MemberConfig{Authorized: boolp(true)}}}
+
+	ns := newNetworkStats(n, members, time.Now(), time.Minute)
+	if ns.total != 1 || ns.authorized != 1 || len(ns.lastOnline) != 0 {
+		t.Fatalf("unexpected stats: %+v", ns)
+	}
+
+	if ns := newNetworkStats(&spec.Network{}, members, time.Now(), time.Minute); ns.id != "" || ns.total != 1 {
+		t.Fatalf("unexpected stats: %+v", ns)
+	}
+}
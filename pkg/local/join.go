@@ -0,0 +1,176 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultJoinPollInterval is how often JoinAndAuthorize checks the local
+// service while waiting for the network to come up.
+const DefaultJoinPollInterval = 2 * time.Second
+
+// ErrJoinFailed is returned when the local service reports a network status
+// that will not resolve by waiting, such as NOT_FOUND or PORT_ERROR.
+var ErrJoinFailed = errors.New("could not join network")
+
+// JoinOptions tune JoinAndAuthorize.
+type JoinOptions struct {
+	// Settings are passed to Join; nil keeps the service defaults.
+	Settings *NetworkSettings
+	// Name, if set, names the member in Central.
+	Name string
+	// PollInterval defaults to DefaultJoinPollInterval.
+	PollInterval time.Duration
+}
+
+// JoinResult is the outcome of JoinAndAuthorize.
+type JoinResult struct {
+	NodeID  string
+	Member  *spec.Member
+	Network *Network
+}
+
+// JoinAndAuthorize joins this node to a network and authorizes it through
+// Central, then waits until the local service reports the network OK with
+// every IP Central assigned. Bound the wait with ctx; on timeout the error
+// includes the last status the service reported.
+func JoinAndAuthorize(ctx context.Context, central *ztcentral.Client, lc *Client, networkID string, opts JoinOptions) (*JoinResult, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultJoinPollInterval
+	}
+
+	status, err := lc.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while reading local status: %w", err)
+	}
+
+	res := &JoinResult{NodeID: status.Address}
+
+	if res.Network, err = lc.Join(ctx, networkID, opts.Settings); err != nil {
+		return nil, fmt.Errorf("while joining %s: %w", networkID, err)
+	}
+
+	if opts.Name != "" {
+		res.Member, err = central.CreateAuthorizedMember(ctx, networkID, res.NodeID, opts.Name)
+	} else {
+		res.Member, err = central.AuthorizeMember(ctx, networkID, res.NodeID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("while authorizing %s: %w", res.NodeID, err)
+	}
+
+	t := time.NewTicker(opts.PollInterval)
+	defer t.Stop()
+
+	for {
+		switch res.Network.Status {
+		case StatusNotFound, StatusPortError, StatusClientTooOld:
+			return res, fmt.Errorf("%w %s: status %s", ErrJoinFailed, networkID, res.Network.Status)
+		case StatusOK:
+			// Central may assign IPs from the pools only after authorizing,
+			// so look at the member again rather than at the update response.
+			if res.Member, err = central.GetMember(ctx, networkID, res.NodeID); err != nil {
+				if ctx.Err() != nil {
+					return res, waitError(networkID, res.Network, ctx.Err())
+				}
+
+				return res, fmt.Errorf("while reading member %s: %w", res.NodeID, err)
+			}
+
+			if hasAddresses(res.Network, res.Member) {
+				return res, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return res, waitError(networkID, res.Network, ctx.Err())
+		case <-t.C:
+		}
+
+		n, err := lc.Network(ctx, networkID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return res, waitError(networkID, res.Network, ctx.Err())
+			}
+
+			return res, fmt.Errorf("while reading local network %s: %w", networkID, err)
+		}
+
+		res.Network = n
+	}
+}
+
+func waitError(networkID string, n *Network, err error) error {
+	return fmt.Errorf("while waiting for %s (last status %s, addresses %v): %w", networkID, n.Status, n.AssignedAddresses, err)
+}
+
+// hasAddresses reports whether the node has every IP Central assigned the
+// member. Local addresses carry a prefix length, Central's do not, and either
+// may format an IPv6 address differently, so addresses are compared parsed.
+func hasAddresses(n *Network, m *spec.Member) bool {
+	if m.Config == nil || m.Config.IpAssignments == nil {
+		return true
+	}
+
+	var assigned []net.IP
+	for _, addr := range n.AssignedAddresses {
+		if ip := net.ParseIP(strings.SplitN(addr, "/", 2)[0]); ip != nil {
+			assigned = append(assigned, ip)
+		}
+	}
+
+	for _, s := range *m.Config.IpAssignments {
+		if !containsIP(assigned, net.ParseIP(s)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
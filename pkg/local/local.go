@@ -0,0 +1,318 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package local talks to the JSON API of the zerotier-one service running on
+// this host, the same API zerotier-cli uses.
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+)
+
+// DefaultPort is the port zerotier-one listens on for its local API.
+const DefaultPort = 9993
+
+// DefaultURL is the local API of a zerotier-one listening on DefaultPort.
+var DefaultURL = fmt.Sprintf("http://127.0.0.1:%d", DefaultPort)
+
+// AuthHeader carries the auth token on every request.
+const AuthHeader = "X-ZT1-Auth"
+
+// TokenFile is the name of the file holding the local API token.
+const TokenFile = "authtoken.secret"
+
+// ErrNoToken is returned when no authtoken.secret could be read.
+var ErrNoToken = errors.New("could not read local zerotier-one auth token")
+
+// Network status values reported by the service.
+const (
+	StatusRequestingConfiguration = "REQUESTING_CONFIGURATION"
+	StatusOK                      = "OK"
+	StatusAccessDenied            = "ACCESS_DENIED"
+	StatusNotFound                = "NOT_FOUND"
+	StatusPortError               = "PORT_ERROR"
+	StatusClientTooOld            = "CLIENT_TOO_OLD"
+	StatusAuthenticationRequired  = "AUTHENTICATION_REQUIRED"
+)
+
+// Status is the response of /status.
+type Status struct {
+	Address           string `json:"address"`
+	PublicIdentity    string `json:"publicIdentity"`
+	Online            bool   `json:"online"`
+	TCPFallbackActive bool   `json:"tcpFallbackActive"`
+	Version           string `json:"version"`
+	VersionMajor      int    `json:"versionMajor"`
+	VersionMinor      int    `json:"versionMinor"`
+	VersionRev        int    `json:"versionRev"`
+	Clock             int64  `json:"clock"`
+}
+
+// NetworkSettings are the local, per-network settings a node chooses when
+// joining.
+type NetworkSettings struct {
+	AllowManaged *bool `json:"allowManaged,omitempty"`
+	AllowGlobal  *bool `json:"allowGlobal,omitempty"`
+	AllowDefault *bool `json:"allowDefault,omitempty"`
+	AllowDNS     *bool `json:"allowDNS,omitempty"`
+}
+
+// Route is a route pushed to the node by the network.
+type Route struct {
+	Target string  `json:"target"`
+	Via    *string `json:"via"`
+	Flags  int     `json:"flags"`
+	Metric int     `json:"metric"`
+}
+
+// DNS is the DNS configuration pushed to the node by the network.
+type DNS struct {
+	Domain  string   `json:"domain"`
+	Servers []string `json:"servers"`
+}
+
+// Network is a network the node has joined, as reported by /network.
+type Network struct {
+	NetworkSettings
+
+	ID                string   `json:"id"`
+	MAC               string   `json:"mac"`
+	Name              string   `json:"name"`
+	Status            string   `json:"status"`
+	Type              string   `json:"type"`
+	MTU               int      `json:"mtu"`
+	Bridge            bool     `json:"bridge"`
+	BroadcastEnabled  bool     `json:"broadcastEnabled"`
+	NetconfRevision   int      `json:"netconfRevision"`
+	AssignedAddresses []string `json:"assignedAddresses"`
+	Routes            []Route  `json:"routes"`
+	PortDeviceName    string   `json:"portDeviceName"`
+	PortError         int      `json:"portError"`
+	DNS               *DNS     `json:"dns,omitempty"`
+}
+
+// PeerPath is a physical path to a peer.
+type PeerPath struct {
+	Active        bool   `json:"active"`
+	Address       string `json:"address"`
+	Expired       bool   `json:"expired"`
+	LastReceive   int64  `json:"lastReceive"`
+	LastSend      int64  `json:"lastSend"`
+	Preferred     bool   `json:"preferred"`
+	TrustedPathID uint64 `json:"trustedPathId"`
+}
+
+// Peer is a node this node knows about, as reported by /peer.
+type Peer struct {
+	Address      string     `json:"address"`
+	Latency      int        `json:"latency"`
+	Role         string     `json:"role"`
+	Version      string     `json:"version"`
+	VersionMajor int        `json:"versionMajor"`
+	VersionMinor int        `json:"versionMinor"`
+	VersionRev   int        `json:"versionRev"`
+	Paths        []PeerPath `json:"paths"`
+}
+
+// Client is a client for the local zerotier-one service.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the service at DefaultURL.
+func NewClient(token string) *Client {
+	return &Client{
+		baseURL:    DefaultURL,
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// NewDefaultClient creates a client with the token read from the first
+// readable path in DefaultTokenPaths.
+func NewDefaultClient() (*Client, error) {
+	token, err := ReadToken(DefaultTokenPaths()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(token), nil
+}
+
+// SetBaseURL points the client at a service on another address or port.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// DefaultTokenPaths are the places the service keeps authtoken.secret on this
+// platform, most specific first.
+func DefaultTokenPaths() []string {
+	var paths []string
+
+	switch runtime.GOOS {
+	case "windows":
+		paths = append(paths, filepath.Join(os.Getenv("ProgramData"), "ZeroTier", "One", TokenFile))
+	case "darwin":
+		if home, err := os.UserHomeDir(); err == nil {
+			paths = append(paths, filepath.Join(home, "Library", "Application Support", "ZeroTier", "One", TokenFile))
+		}
+		paths = append(paths, filepath.Join("/Library", "Application Support", "ZeroTier", "One", TokenFile))
+	default:
+		paths = append(paths, filepath.Join("/var/lib/zerotier-one", TokenFile))
+	}
+
+	return paths
+}
+
+// ReadToken returns the trimmed contents of the first readable path.
+func ReadToken(paths ...string) (string, error) {
+	for _, p := range paths {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+
+		if token := strings.TrimSpace(string(content)); token != "" {
+			return token, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w from %s", ErrNoToken, strings.Join(paths, ", "))
+}
+
+// Status returns the node's status, including its address.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	res := &Status{}
+	return res, c.do(ctx, http.MethodGet, "/status", nil, res)
+}
+
+// Networks lists the networks the node has joined.
+func (c *Client) Networks(ctx context.Context) ([]*Network, error) {
+	res := []*Network{}
+	return res, c.do(ctx, http.MethodGet, "/network", nil, &res)
+}
+
+// Network returns a joined network.
+func (c *Client) Network(ctx context.Context, networkID string) (*Network, error) {
+	if _, err := ztcentral.ParseNetworkID(networkID); err != nil {
+		return nil, err
+	}
+
+	res := &Network{}
+	return res, c.do(ctx, http.MethodGet, "/network/"+networkID, nil, res)
+}
+
+// Join joins a network, or changes its settings if already joined. settings
+// may be nil to keep the defaults.
+func (c *Client) Join(ctx context.Context, networkID string, settings *NetworkSettings) (*Network, error) {
+	if _, err := ztcentral.ParseNetworkID(networkID); err != nil {
+		return nil, err
+	}
+
+	if settings == nil {
+		settings = &NetworkSettings{}
+	}
+
+	res := &Network{}
+	return res, c.do(ctx, http.MethodPost, "/network/"+networkID, settings, res)
+}
+
+// Leave leaves a network.
+func (c *Client) Leave(ctx context.Context, networkID string) error {
+	if _, err := ztcentral.ParseNetworkID(networkID); err != nil {
+		return err
+	}
+
+	return c.do(ctx, http.MethodDelete, "/network/"+networkID, nil, nil)
+}
+
+// Peers lists the peers the node knows about.
+func (c *Client) Peers(ctx context.Context) ([]*Peer, error) {
+	res := []*Peer{}
+	return res, c.do(ctx, http.MethodGet, "/peer", nil, &res)
+}
+
+// Peer returns a single peer by its address.
+func (c *Client) Peer(ctx context.Context, address string) (*Peer, error) {
+	if _, err := ztcentral.ParseNodeID(address); err != nil {
+		return nil, err
+	}
+
+	res := &Peer{}
+	return res, c.do(ctx, http.MethodGet, "/peer/"+address, nil, res)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, res interface{}) error {
+	var buf bytes.Buffer
+
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &buf)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(AuthHeader, c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ztcentral.StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
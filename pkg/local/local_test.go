@@ -0,0 +1,322 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+const (
+	stubToken   = "local-token"
+	stubAddress = "abcdef0123"
+)
+
+// stubService mimics the local zerotier-one API. Joined networks come up once
+// fc reports the node authorized, with the IPs fc assigned.
+type stubService struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	fc       *testutil.FakeCentral
+	networks map[string]*Network
+	// holdIPs keeps networks from getting their addresses.
+	holdIPs bool
+}
+
+func newStubService(fc *testutil.FakeCentral) *stubService {
+	s := &stubService{fc: fc, networks: map[string]*Network{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *stubService) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(AuthHeader) != stubToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var res interface{}
+
+	switch {
+	case path[0] == "status":
+		res = &Status{Address: stubAddress, Online: true, Version: "1.14.0"}
+	case path[0] == "peer" && len(path) == 1:
+		res = []*Peer{{Address: "778cde7190", Role: "PLANET"}}
+	case path[0] == "network" && len(path) == 1:
+		networks := []*Network{}
+		for id := range s.networks {
+			networks = append(networks, s.network(id))
+		}
+		res = networks
+	case path[0] == "network" && r.Method == http.MethodPost:
+		if s.networks[path[1]] == nil {
+			s.networks[path[1]] = &Network{ID: path[1], Status: StatusRequestingConfiguration}
+		}
+
+		settings := NetworkSettings{}
+		json.NewDecoder(r.Body).Decode(&settings)
+		s.networks[path[1]].NetworkSettings = settings
+		res = s.network(path[1])
+	case path[0] == "network" && s.networks[path[1]] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case path[0] == "network" && r.Method == http.MethodDelete:
+		delete(s.networks, path[1])
+		res = map[string]bool{"result": true}
+	case path[0] == "network":
+		res = s.network(path[1])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(res)
+}
+
+// network must be called with the mutex held.
+func (s *stubService) network(id string) *Network {
+	n := *s.networks[id]
+
+	if m := s.fc.Member(id, stubAddress); m != nil && *m.Config.Authorized {
+		n.Status = StatusOK
+		n.AssignedAddresses = nil
+		if m.Config.IpAssignments != nil && !s.holdIPs {
+			for _, ip := range *m.Config.IpAssignments {
+				n.AssignedAddresses = append(n.AssignedAddresses, ip+"/24")
+			}
+		}
+	}
+
+	return &n
+}
+
+func newStubClients(t *testing.T) (*ztcentral.Client, *Client, *testutil.FakeCentral, *stubService) {
+	fc := testutil.NewFakeCentral()
+	t.Cleanup(fc.Close)
+
+	s := newStubService(fc)
+	t.Cleanup(s.Close)
+
+	central, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := central.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	lc := NewClient(stubToken)
+	lc.SetBaseURL(s.URL)
+
+	return central, lc, fc, s
+}
+
+func TestClient(t *testing.T) {
+	_, lc, _, _ := newStubClients(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	status, err := lc.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Address != stubAddress || !status.Online {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	peers, err := lc.Peers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(peers) != 1 || peers[0].Role != "PLANET" {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+
+	const networkID = "8056c2e21c000001"
+
+	if _, err := lc.Network(ctx, networkID); !ztcentral.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	yes := true
+	n, err := lc.Join(ctx, networkID, &NetworkSettings{AllowDNS: &yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.Status != StatusRequestingConfiguration || n.AllowDNS == nil || !*n.AllowDNS {
+		t.Fatalf("unexpected network: %+v", n)
+	}
+
+	networks, err := lc.Networks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(networks) != 1 || networks[0].ID != networkID {
+		t.Fatalf("unexpected networks: %+v", networks)
+	}
+
+	if err := lc.Leave(ctx, networkID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lc.Network(ctx, networkID); !ztcentral.IsNotFound(err) {
+		t.Fatalf("network still joined: %v", err)
+	}
+
+	if _, err := lc.Join(ctx, "nope", nil); !errors.Is(err, ztcentral.ErrInvalidID) {
+		t.Fatalf("expected invalid id, got %v", err)
+	}
+
+	bad := NewClient("wrong")
+	bad.SetBaseURL(lc.baseURL)
+	if _, err := bad.Status(ctx); !errors.Is(err, ztcentral.ErrStatus) {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, TokenFile)
+	if err := ioutil.WriteFile(p, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ReadToken(filepath.Join(dir, "missing"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "secret" {
+		t.Fatalf("unexpected token %q", token)
+	}
+
+	if _, err := ReadToken(filepath.Join(dir, "missing")); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+}
+
+func TestJoinAndAuthorize(t *testing.T) {
+	central, lc, fc, s := newStubClients(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{
+		NodeId: &[]string{stubAddress}[0],
+		Config: &spec.MemberConfig{IpAssignments: &[]string{"10.1.0.5"}},
+	})
+
+	res, err := JoinAndAuthorize(ctx, central, lc, *n.Id, JoinOptions{Name: "bootstrap", PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.NodeID != stubAddress || res.Network.Status != StatusOK {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if len(res.Network.AssignedAddresses) != 1 || res.Network.AssignedAddresses[0] != "10.1.0.5/24" {
+		t.Fatalf("unexpected addresses: %v", res.Network.AssignedAddresses)
+	}
+
+	if m := fc.Member(*n.Id, stubAddress); !*m.Config.Authorized || *m.Name != "bootstrap" {
+		t.Fatalf("member was not authorized: %+v", m)
+	}
+
+	// a network that never gets its addresses times out with the last status.
+	other := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*other.Id, &spec.Member{
+		NodeId: &[]string{stubAddress}[0],
+		Config: &spec.MemberConfig{IpAssignments: &[]string{"10.2.0.5"}},
+	})
+
+	s.mutex.Lock()
+	s.holdIPs = true
+	s.mutex.Unlock()
+
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	_, err = JoinAndAuthorize(short, central, lc, *other.Id, JoinOptions{PollInterval: 10 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "last status OK") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestHasAddresses(t *testing.T) {
+	n := &Network{AssignedAddresses: []string{"10.1.0.5/24", "fd80:56c2:e21c:0:199:9300:0:1/88"}}
+
+	for _, test := range []struct {
+		assigned []string
+		has      bool
+	}{
+		{[]string{"10.1.0.5"}, true},
+		{[]string{"fd80:56c2:e21c::199:9300:0:1"}, true},
+		{[]string{"FD80:56C2:E21C:0000:0199:9300:0000:0001", "10.1.0.5"}, true},
+		{[]string{"10.1.0.5", "10.1.0.6"}, false},
+		{[]string{"not an ip"}, false},
+	} {
+		m := &spec.Member{Config: &spec.MemberConfig{IpAssignments: &test.assigned}}
+		if has := hasAddresses(n, m); has != test.has {
+			t.Fatalf("%v: expected %v, got %v", test.assigned, test.has, has)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package mirror keeps a local copy of an account's networks, members,
+// organization members and invitations in an embedded bbolt database, so
+// questions across every network can be answered without an API call each.
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// ErrNotFound is returned for records the mirror does not hold.
+var ErrNotFound = errors.New("record is not in the mirror")
+
+var (
+	networksBucket     = []byte("networks")
+	networkStateBucket = []byte("networkState")
+	membersBucket      = []byte("members")
+	orgMembersBucket   = []byte("orgMembers")
+	invitationsBucket  = []byte("invitations")
+	metaBucket         = []byte("meta")
+
+	lastSyncKey = []byte("lastSync")
+)
+
+// Invitation is an organization invitation as the mirror stores it.
+type Invitation struct {
+	ID           string            `json:"id"`
+	OrgID        string            `json:"orgId"`
+	Email        string            `json:"email"`
+	Status       spec.InviteStatus `json:"status"`
+	CreationTime time.Time         `json:"creationTime"`
+	UpdateTime   time.Time         `json:"updateTime"`
+}
+
+// networkState is what the last sync saw of a network, to decide whether its
+// members need fetching again.
+type networkState struct {
+	LastModified          int64     `json:"lastModified"`
+	TotalMemberCount      int       `json:"totalMemberCount"`
+	AuthorizedMemberCount int       `json:"authorizedMemberCount"`
+	MembersSynced         time.Time `json:"membersSynced"`
+}
+
+// Mirror is the local database.
+type Mirror struct {
+	db *bolt.DB
+}
+
+// Open opens, or creates, the mirror at path.
+func Open(path string) (*Mirror, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{networksBucket, networkStateBucket, membersBucket, orgMembersBucket, invitationsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Mirror{db: db}, nil
+}
+
+// Close closes the mirror.
+func (m *Mirror) Close() error {
+	return m.db.Close()
+}
+
+// LastSync is when the last successful Sync finished, or zero if none has.
+func (m *Mirror) LastSync() (time.Time, error) {
+	var t time.Time
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBucket).Get(lastSyncKey)
+		if v == nil {
+			return nil
+		}
+
+		return t.UnmarshalText(v)
+	})
+
+	return t, err
+}
+
+func memberKey(networkID, memberID string) []byte {
+	return []byte(networkID + "/" + memberID)
+}
+
+// putJSON stores v under key, and reports whether the stored value changed.
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) (bool, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	if string(b.Get(key)) == string(content) {
+		return false, nil
+	}
+
+	return true, b.Put(key, content)
+}
+
+func getJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	content := b.Get(key)
+	if content == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// forEachPrefix calls fn for every key in b starting with prefix.
+func forEachPrefix(b *bolt.Bucket, prefix []byte, fn func(k, v []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deletePrefix removes every key in b starting with prefix, and returns how
+// many there were.
+func deletePrefix(b *bolt.Bucket, prefix []byte) (int, error) {
+	var keys [][]byte
+
+	err := forEachPrefix(b, prefix, func(k, v []byte) error {
+		keys = append(keys, append([]byte{}, k...))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(keys), nil
+}
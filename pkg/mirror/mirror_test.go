@@ -0,0 +1,237 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func newTestMirror(t *testing.T) (*Mirror, *ztcentral.Client, *testutil.FakeCentral) {
+	fc := testutil.NewFakeCentral()
+	t.Cleanup(fc.Close)
+
+	c, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	m, err := Open(filepath.Join(dir, "mirror.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	return m, c, fc
+}
+
+// addFixtures creates an owned network with DNS and a plain one, three members
+// and an invitation.
+func addFixtures(ctx context.Context, t *testing.T, c *ztcentral.Client, fc *testutil.FakeCentral) (dns, plain *spec.Network) {
+	owner := "00000000-0000-0000-0000-000000000002"
+	fc.AddOrgMember(&spec.OrganizationMember{UserId: &owner, Email: stringp("owner@example.com")})
+
+	dns = fc.AddNetwork(&spec.Network{OwnerId: &owner, Config: &spec.NetworkConfig{
+		Name: stringp("dns"),
+		Dns:  &spec.DNS{Domain: stringp("example.com"), Servers: &[]string{"10.20.0.1"}},
+	}})
+	plain = fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{Name: stringp("plain")}})
+
+	fc.AddMember(*dns.Id, &spec.Member{NodeId: stringp("0000000001"), Name: stringp("db"), Config: &spec.MemberConfig{IpAssignments: &[]string{"10.20.0.5"}}})
+	fc.AddMember(*dns.Id, &spec.Member{NodeId: stringp("0000000002"), Name: stringp("web"), Config: &spec.MemberConfig{IpAssignments: &[]string{"10.30.0.5"}}})
+	fc.AddMember(*plain.Id, &spec.Member{NodeId: stringp("0000000003"), Name: stringp("app"), Config: &spec.MemberConfig{IpAssignments: &[]string{"10.20.1.9"}}})
+
+	if _, err := c.InviteUser(ctx, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	return dns, plain
+}
+
+func TestSync(t *testing.T) {
+	m, c, fc := newTestMirror(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dns, plain := addFixtures(ctx, t, c, fc)
+
+	stats, err := m.Sync(ctx, c, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *stats != (SyncStats{Networks: 2, NetworksRefreshed: 2, MembersWritten: 3, OrgMembers: 1, Invitations: 1}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// nothing changed, so members are not fetched again.
+	before := len(fc.Requests())
+	if stats, err = m.Sync(ctx, c, SyncOptions{SkipOrg: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.NetworksRefreshed != 0 || len(fc.Requests()) != before+1 {
+		t.Fatalf("expected only the network list, got %+v and %v", stats, fc.Requests()[before:])
+	}
+
+	// a new member changes the counts; a deleted network goes away.
+	fc.AddMember(*plain.Id, &spec.Member{NodeId: stringp("0000000004")})
+	if err := c.DeleteNetwork(ctx, *dns.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats, err = m.Sync(ctx, c, SyncOptions{SkipOrg: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if *stats != (SyncStats{Networks: 1, NetworksRefreshed: 1, NetworksDeleted: 1, MembersWritten: 1, MembersDeleted: 2}) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// stale members are fetched again, but unchanged ones are not rewritten.
+	later := func() time.Time { return time.Now().Add(time.Hour) }
+	if stats, err = m.Sync(ctx, c, SyncOptions{SkipOrg: true, Now: later}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.NetworksRefreshed != 1 || stats.MembersWritten != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if last, err := m.LastSync(); err != nil || last.Before(time.Now()) {
+		t.Fatalf("unexpected last sync: %v %v", last, err)
+	}
+}
+
+func TestSyncWithoutNodeID(t *testing.T) {
+	m, c, fc := newTestMirror(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n := fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{Name: stringp("plain")}})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001")})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002")})
+	fc.EditMember(*n.Id, "0000000002", func(m *spec.Member) { m.NodeId = nil })
+
+	stats, err := m.Sync(ctx, c, SyncOptions{SkipOrg: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.MembersWritten != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	m, c, fc := newTestMirror(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dns, plain := addFixtures(ctx, t, c, fc)
+
+	if _, err := m.Sync(ctx, c, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := m.QueryMembers("ip=10.20.0.0/16 sort=name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 2 || *members[0].Name != "app" || *members[1].Name != "db" {
+		t.Fatalf("unexpected members: %v", members)
+	}
+
+	if _, err := m.QueryMembers("bogus=1"); err == nil {
+		t.Fatal("accepted an invalid query")
+	}
+
+	networks, err := m.Networks(HasDNS(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(networks) != 1 || *networks[0].Id != *plain.Id {
+		t.Fatalf("unexpected networks: %v", networks)
+	}
+
+	owners, err := m.Owners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range owners {
+		if *o.Network.Id == *dns.Id && (o.Owner == nil || *o.Owner.Email != "owner@example.com") {
+			t.Fatalf("unexpected owner: %+v", o)
+		}
+
+		if *o.Network.Id == *plain.Id && o.Owner != nil {
+			t.Fatalf("unexpected owner: %+v", o)
+		}
+	}
+
+	invitations, err := m.Invitations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(invitations) != 1 || invitations[0].Email != "new@example.com" || invitations[0].Status != spec.InviteStatusPending {
+		t.Fatalf("unexpected invitations: %+v", invitations)
+	}
+
+	if _, err := m.Member(*plain.Id, "0000000009"); err == nil {
+		t.Fatal("found a member that is not mirrored")
+	}
+}
+
+func stringp(s string) *string {
+	return &s
+}
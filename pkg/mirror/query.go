@@ -0,0 +1,269 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"encoding/json"
+	"path"
+
+	bolt "go.etcd.io/bbolt"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// NetworkFilter passes or rejects a network.
+type NetworkFilter func(n *spec.Network) bool
+
+// HasDNS passes networks that do, or do not, push DNS servers.
+func HasDNS(has bool) NetworkFilter {
+	return func(n *spec.Network) bool {
+		dns := n.Config != nil && n.Config.Dns != nil && n.Config.Dns.Servers != nil && len(*n.Config.Dns.Servers) > 0
+		return dns == has
+	}
+}
+
+// IsPrivate passes private, or public, networks.
+func IsPrivate(private bool) NetworkFilter {
+	return func(n *spec.Network) bool {
+		return n.Config != nil && n.Config.Private != nil && *n.Config.Private == private
+	}
+}
+
+// NetworkNameGlob passes networks whose name matches the path.Match style
+// pattern.
+func NetworkNameGlob(pattern string) (NetworkFilter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	return func(n *spec.Network) bool {
+		name := ""
+		if n.Config != nil && n.Config.Name != nil {
+			name = *n.Config.Name
+		}
+
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
+
+// OwnedBy passes networks owned by the user.
+func OwnedBy(userID string) NetworkFilter {
+	return func(n *spec.Network) bool {
+		return n.OwnerId != nil && *n.OwnerId == userID
+	}
+}
+
+// Networks returns the mirrored networks passing every filter, ordered by ID.
+func (m *Mirror) Networks(filters ...NetworkFilter) ([]*spec.Network, error) {
+	res := []*spec.Network{}
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(networksBucket).ForEach(func(k, v []byte) error {
+			n := &spec.Network{}
+			if err := json.Unmarshal(v, n); err != nil {
+				return err
+			}
+
+			for _, f := range filters {
+				if !f(n) {
+					return nil
+				}
+			}
+
+			res = append(res, n)
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+// Network returns a mirrored network.
+func (m *Mirror) Network(networkID string) (*spec.Network, error) {
+	n := &spec.Network{}
+
+	return n, m.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(networksBucket), []byte(networkID), n)
+	})
+}
+
+// Member returns a mirrored member.
+func (m *Mirror) Member(networkID, memberID string) (*spec.Member, error) {
+	member := &spec.Member{}
+
+	return member, m.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(membersBucket), memberKey(networkID, memberID), member)
+	})
+}
+
+// Members returns the mirrored members of a network passing every filter,
+// ordered by member ID. An empty networkID searches every network, ordered
+// by network.
+func (m *Mirror) Members(networkID string, filters ...ztcentral.MemberFilter) ([]*spec.Member, error) {
+	res := []*spec.Member{}
+
+	prefix := []byte{}
+	if networkID != "" {
+		prefix = memberKey(networkID, "")
+	}
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return forEachPrefix(tx.Bucket(membersBucket), prefix, func(k, v []byte) error {
+			member := &spec.Member{}
+			if err := json.Unmarshal(v, member); err != nil {
+				return err
+			}
+
+			res = append(res, member)
+			return nil
+		})
+	})
+
+	return ztcentral.FilterMembers(res, filters...), err
+}
+
+// QueryMembers runs a ztcentral.ParseMemberQuery query over the members of
+// every mirrored network, such as "ip=10.20.0.0/16 sort=name". Tag and
+// capability names are resolved per network, so a query naming a tag only
+// matches networks that define it.
+func (m *Mirror) QueryMembers(query string) ([]*spec.Member, error) {
+	networks, err := m.Networks()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*spec.Member{}
+
+	var q *ztcentral.MemberQuery
+	for _, n := range networks {
+		nq, err := ztcentral.ParseMemberQuery(query, n)
+		if err != nil {
+			// the name is not defined on this network, so nothing matches.
+			continue
+		}
+
+		members, err := m.Members(*n.Id, nq.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, members...)
+		q = nq
+	}
+
+	if q == nil {
+		// no network could resolve the query; report why.
+		if _, err := ztcentral.ParseMemberQuery(query, nil); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	return res, ztcentral.SortMembers(res, q.Sort...)
+}
+
+// OrgMembers returns the mirrored organization members.
+func (m *Mirror) OrgMembers() ([]*spec.OrganizationMember, error) {
+	res := []*spec.OrganizationMember{}
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(orgMembersBucket).ForEach(func(k, v []byte) error {
+			om := &spec.OrganizationMember{}
+			if err := json.Unmarshal(v, om); err != nil {
+				return err
+			}
+
+			res = append(res, om)
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+// Invitations returns the mirrored organization invitations.
+func (m *Mirror) Invitations() ([]*Invitation, error) {
+	res := []*Invitation{}
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(invitationsBucket).ForEach(func(k, v []byte) error {
+			inv := &Invitation{}
+			if err := json.Unmarshal(v, inv); err != nil {
+				return err
+			}
+
+			res = append(res, inv)
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+// Ownership pairs a network with its owner.
+type Ownership struct {
+	Network *spec.Network
+	OwnerID string
+	// Owner is nil when the owner is not a member of the organization.
+	Owner *spec.OrganizationMember
+}
+
+// Owners answers "who owns what": every mirrored network with its owner.
+func (m *Mirror) Owners() ([]Ownership, error) {
+	networks, err := m.Networks()
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := m.OrgMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*spec.OrganizationMember{}
+	for _, om := range members {
+		byID[*om.UserId] = om
+	}
+
+	res := []Ownership{}
+	for _, n := range networks {
+		o := Ownership{Network: n}
+		if n.OwnerId != nil {
+			o.OwnerID = *n.OwnerId
+			o.Owner = byID[o.OwnerID]
+		}
+
+		res = append(res, o)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultMaxAge is how long a network's members are trusted before Sync
+// fetches them again, when SyncOptions.MaxAge is not set.
+const DefaultMaxAge = 15 * time.Minute
+
+// DefaultSyncInterval is how often a Syncer syncs when Interval is not set.
+const DefaultSyncInterval = 5 * time.Minute
+
+// SyncOptions control Sync.
+type SyncOptions struct {
+	// Full fetches the members of every network, changed or not.
+	Full bool
+	// MaxAge is how long members are kept without fetching them again when
+	// their network looks unchanged. Member edits do not change the network,
+	// so this bounds how stale the mirror can get. It defaults to
+	// DefaultMaxAge.
+	MaxAge time.Duration
+	// SkipOrg skips organization members and invitations.
+	SkipOrg bool
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// SyncStats describe what a Sync did.
+type SyncStats struct {
+	Networks          int
+	NetworksRefreshed int
+	NetworksDeleted   int
+	MembersWritten    int
+	MembersDeleted    int
+	OrgMembers        int
+	Invitations       int
+}
+
+// Sync refreshes the mirror from Central. It always lists networks, and
+// fetches members only of networks that changed since the last sync, or whose
+// members are older than MaxAge. Only records that changed are written.
+func (m *Mirror) Sync(ctx context.Context, c *ztcentral.Client, opts SyncOptions) (*SyncStats, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+
+	stats := &SyncStats{}
+
+	networks, err := c.GetNetworks(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Networks = len(networks)
+	seen := map[string]bool{}
+
+	for _, n := range networks {
+		if n.Id == nil {
+			continue
+		}
+
+		seen[*n.Id] = true
+
+		refresh, err := m.needsRefresh(n, opts, now())
+		if err != nil {
+			return stats, err
+		}
+
+		var members []*spec.Member
+		if refresh {
+			if members, err = c.GetMembers(ctx, *n.Id); err != nil {
+				return stats, fmt.Errorf("while syncing %s: %w", *n.Id, err)
+			}
+
+			stats.NetworksRefreshed++
+		}
+
+		err = m.db.Update(func(tx *bolt.Tx) error {
+			if _, err := putJSON(tx.Bucket(networksBucket), []byte(*n.Id), n); err != nil {
+				return err
+			}
+
+			if !refresh {
+				return nil
+			}
+
+			return m.putMembers(tx, n, members, now(), stats)
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	err = m.db.Update(func(tx *bolt.Tx) error {
+		var gone []string
+
+		err := tx.Bucket(networksBucket).ForEach(func(k, v []byte) error {
+			if !seen[string(k)] {
+				gone = append(gone, string(k))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range gone {
+			if err := tx.Bucket(networksBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+
+			if err := tx.Bucket(networkStateBucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+
+			deleted, err := deletePrefix(tx.Bucket(membersBucket), memberKey(id, ""))
+			if err != nil {
+				return err
+			}
+
+			stats.NetworksDeleted++
+			stats.MembersDeleted += deleted
+		}
+
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if !opts.SkipOrg {
+		if err := m.syncOrg(ctx, c, stats); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, m.db.Update(func(tx *bolt.Tx) error {
+		t, err := now().MarshalText()
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(metaBucket).Put(lastSyncKey, t)
+	})
+}
+
+func (m *Mirror) needsRefresh(n *spec.Network, opts SyncOptions, now time.Time) (bool, error) {
+	if opts.Full {
+		return true, nil
+	}
+
+	state := &networkState{}
+
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(networkStateBucket), []byte(*n.Id), state)
+	})
+	if err != nil {
+		// never synced, or unreadable; either way, fetch.
+		return true, nil
+	}
+
+	return *newNetworkState(n, state.MembersSynced) != *state || now.Sub(state.MembersSynced) >= opts.MaxAge, nil
+}
+
+func newNetworkState(n *spec.Network, synced time.Time) *networkState {
+	state := &networkState{MembersSynced: synced}
+
+	if n.Config != nil && n.Config.LastModified != nil {
+		state.LastModified = *n.Config.LastModified
+	}
+
+	if n.TotalMemberCount != nil {
+		state.TotalMemberCount = *n.TotalMemberCount
+	}
+
+	if n.AuthorizedMemberCount != nil {
+		state.AuthorizedMemberCount = *n.AuthorizedMemberCount
+	}
+
+	return state
+}
+
+func (m *Mirror) putMembers(tx *bolt.Tx, n *spec.Network, members []*spec.Member, now time.Time, stats *SyncStats) error {
+	b := tx.Bucket(membersBucket)
+	seen := map[string]bool{}
+
+	for _, member := range members {
+		if member.NodeId == nil {
+			continue
+		}
+
+		key := memberKey(*n.Id, *member.NodeId)
+		seen[string(key)] = true
+
+		changed, err := putJSON(b, key, member)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			stats.MembersWritten++
+		}
+	}
+
+	var gone [][]byte
+
+	err := forEachPrefix(b, memberKey(*n.Id, ""), func(k, v []byte) error {
+		if !seen[string(k)] {
+			gone = append(gone, append([]byte{}, k...))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range gone {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+
+		stats.MembersDeleted++
+	}
+
+	_, err = putJSON(tx.Bucket(networkStateBucket), []byte(*n.Id), newNetworkState(n, now))
+	return err
+}
+
+func (m *Mirror) syncOrg(ctx context.Context, c *ztcentral.Client, stats *SyncStats) error {
+	var (
+		members     []*spec.OrganizationMember
+		invitations []*spec.OrganizationInvitation
+	)
+
+	org, err := c.GetOrganization(ctx)
+	switch {
+	case ztcentral.IsNotFound(err):
+		// users without an organization have nothing to mirror.
+	case err != nil:
+		return err
+	default:
+		if members, err = c.GetOrganizationMembers(ctx, *org.Id); err != nil {
+			return err
+		}
+
+		if invitations, err = c.GetInvitations(ctx); err != nil {
+			return err
+		}
+	}
+
+	stats.OrgMembers = len(members)
+	stats.Invitations = len(invitations)
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{orgMembersBucket, invitationsBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		for _, om := range members {
+			if om.UserId == nil {
+				continue
+			}
+
+			if _, err := putJSON(tx.Bucket(orgMembersBucket), []byte(*om.UserId), om); err != nil {
+				return err
+			}
+		}
+
+		for _, inv := range invitations {
+			rec := newInvitation(inv)
+			if _, err := putJSON(tx.Bucket(invitationsBucket), []byte(rec.ID), rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func newInvitation(inv *spec.OrganizationInvitation) *Invitation {
+	rec := &Invitation{Status: ztcentral.InvitationStatus(inv)}
+
+	if inv.Id != nil {
+		rec.ID = *inv.Id
+	}
+
+	if inv.OrgId != nil {
+		rec.OrgID = *inv.OrgId
+	}
+
+	if inv.Email != nil {
+		rec.Email = *inv.Email
+	}
+
+	if inv.CreationTime != nil {
+		rec.CreationTime = time.Unix(0, *inv.CreationTime*int64(time.Millisecond))
+	}
+
+	if inv.UpdateTime != nil {
+		rec.UpdateTime = time.Unix(0, *inv.UpdateTime*int64(time.Millisecond))
+	}
+
+	return rec
+}
+
+// Syncer keeps a mirror in sync.
+type Syncer struct {
+	Client *ztcentral.Client
+	Mirror *Mirror
+	// Interval defaults to DefaultSyncInterval.
+	Interval time.Duration
+	Options  SyncOptions
+	// OnSync is called after every sync; it may be nil.
+	OnSync func(*SyncStats, error)
+}
+
+// Run syncs until ctx is done.
+func (s *Syncer) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		stats, err := s.Mirror.Sync(ctx, s.Client, s.Options)
+		if s.OnSync != nil && ctx.Err() == nil {
+			s.OnSync(stats, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package notify sends notifications about ZeroTier Central events, such as
+// the ones produced by ztcentral.Client.Watch, to webhooks, Slack and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"text/template"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+)
+
+// Message is a rendered notification.
+type Message struct {
+	// Subject is a one line summary, used as the email subject.
+	Subject string
+	// Text is the rendered body.
+	Text string
+	// Event is the event the message is about.
+	Event ztcentral.Event
+}
+
+// Notifier delivers messages to a destination.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Route sends matching events to a notifier. Empty match fields match
+// everything.
+type Route struct {
+	Name string
+	// Notifier is the key of the notifier in Dispatcher.Notifiers.
+	Notifier string
+	// Events are the event types to send.
+	Events []ztcentral.EventType
+	// Networks are network IDs, or path.Match patterns matched against
+	// network IDs and names.
+	Networks []string
+	// Subject and Template override the default text/templates for the event
+	// type. They are executed with the TemplateData.
+	Subject  string
+	Template string
+}
+
+// TemplateData is passed to message templates.
+type TemplateData struct {
+	ztcentral.Event
+	NetworkName string
+	MemberName  string
+}
+
+// DefaultSubjects are the subject templates used for routes without one.
+var DefaultSubjects = map[ztcentral.EventType]string{
+	ztcentral.EventNetworkCreated:       `Network {{.NetworkName}} ({{.NetworkID}}) was created`,
+	ztcentral.EventNetworkDeleted:       `Network {{.NetworkID}} was deleted`,
+	ztcentral.EventNetworkConfigChanged: `Configuration changed on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberJoined:         `New member {{.MemberID}} waiting for authorization on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberDeleted:        `Member {{.MemberID}} was deleted from network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberAuthorized:     `Member {{.MemberID}} {{with .MemberName}}({{.}}) {{end}}was authorized on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberDeauthorized:   `Member {{.MemberID}} {{with .MemberName}}({{.}}) {{end}}was deauthorized on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberOnline:         `Member {{.MemberID}} {{with .MemberName}}({{.}}) {{end}}is online on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventMemberOffline:        `Member {{.MemberID}} {{with .MemberName}}({{.}}) {{end}}went offline on network {{.NetworkName}} ({{.NetworkID}})`,
+	ztcentral.EventIPAssignmentChanged:  `IP assignments of member {{.MemberID}} changed on network {{.NetworkName}} ({{.NetworkID}})`,
+}
+
+// DefaultTemplate is the body template used for routes without one.
+const DefaultTemplate = `{{.Type}} at {{.Time.UTC.Format "2006-01-02 15:04:05 UTC"}}
+Network: {{.NetworkID}}{{with .NetworkName}} ({{.}}){{end}}
+{{- if .MemberID}}
+Member: {{.MemberID}}{{with .MemberName}} ({{.}}){{end}}
+{{- with .Member}}{{with .Config}}{{with .IpAssignments}}
+IPs: {{range $i, $ip := .}}{{if $i}}, {{end}}{{$ip}}{{end}}{{end}}{{end}}
+{{- with .PhysicalAddress}}
+Physical address: {{.}}{{end}}{{end}}
+{{- end}}
+`
+
+// Retry controls redelivery of failed notifications.
+type Retry struct {
+	// Attempts is the total number of tries; it defaults to 3.
+	Attempts int
+	// Backoff is the delay before the first retry, doubling after each; it
+	// defaults to one second.
+	Backoff time.Duration
+}
+
+// Dispatcher routes events to notifiers.
+type Dispatcher struct {
+	Notifiers map[string]Notifier
+	Routes    []Route
+	Retry     Retry
+	// DeadLetter is a file that notifications are appended to, as JSON lines,
+	// once all retries have failed. Empty disables it.
+	DeadLetter string
+
+	mutex     sync.Mutex
+	templates map[string]*template.Template
+}
+
+// DeadLetterRecord is written to the dead letter file for every undeliverable
+// notification.
+type DeadLetterRecord struct {
+	Time     time.Time           `json:"time"`
+	Route    string              `json:"route"`
+	Notifier string              `json:"notifier"`
+	Type     ztcentral.EventType `json:"type"`
+	Subject  string              `json:"subject"`
+	Text     string              `json:"text"`
+	Error    string              `json:"error"`
+}
+
+// Run dispatches events until the channel is closed or the context is
+// canceled. Checkpoint and error events are not dispatched. Delivery errors
+// are handled by the retry and dead letter settings and do not stop Run.
+func (d *Dispatcher) Run(ctx context.Context, events <-chan ztcentral.Event) error {
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if e.Type == ztcentral.EventCheckpoint || e.Type == ztcentral.EventError {
+				continue
+			}
+
+			d.Dispatch(ctx, e)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Dispatch sends the event through every matching route. It returns the
+// errors of routes that could not be delivered, after retries.
+func (d *Dispatcher) Dispatch(ctx context.Context, e ztcentral.Event) error {
+	var errs []error
+
+	for i := range d.Routes {
+		r := &d.Routes[i]
+		if !r.matches(e) {
+			continue
+		}
+
+		if err := d.deliver(ctx, r, e); err != nil {
+			errs = append(errs, fmt.Errorf("route %q: %w", r.Name, err))
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d routes failed; first: %w", len(errs), errs[0])
+	}
+}
+
+func (r *Route) matches(e ztcentral.Event) bool {
+	if len(r.Events) > 0 {
+		found := false
+		for _, t := range r.Events {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Networks) == 0 {
+		return true
+	}
+
+	name := networkName(e)
+	for _, pattern := range r.Networks {
+		if ok, _ := path.Match(pattern, e.NetworkID); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(pattern, name); ok && name != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, r *Route, e ztcentral.Event) error {
+	n, ok := d.Notifiers[r.Notifier]
+	if !ok {
+		return fmt.Errorf("no notifier named %q", r.Notifier)
+	}
+
+	msg, err := d.render(r, e)
+	if err != nil {
+		return err
+	}
+
+	attempts := d.Retry.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	backoff := d.Retry.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err = n.Notify(ctx, msg); err == nil {
+			return nil
+		}
+
+		if attempt >= attempts || !sleep(ctx, backoff) {
+			break
+		}
+
+		backoff *= 2
+	}
+
+	if dlErr := d.deadLetter(r, msg, err); dlErr != nil {
+		return fmt.Errorf("%v; additionally, writing the dead letter failed: %w", err, dlErr)
+	}
+
+	return err
+}
+
+func (d *Dispatcher) render(r *Route, e ztcentral.Event) (Message, error) {
+	data := TemplateData{Event: e, NetworkName: networkName(e)}
+	if e.Member != nil && e.Member.Name != nil {
+		data.MemberName = *e.Member.Name
+	}
+
+	subject := r.Subject
+	if subject == "" {
+		subject = DefaultSubjects[e.Type]
+	}
+
+	if subject == "" {
+		subject = "{{.Type}} on network {{.NetworkID}}"
+	}
+
+	body := r.Template
+	if body == "" {
+		body = DefaultTemplate
+	}
+
+	msg := Message{Event: e}
+	var err error
+
+	if msg.Subject, err = d.execute(subject, data); err != nil {
+		return msg, err
+	}
+
+	msg.Text, err = d.execute(body, data)
+	return msg, err
+}
+
+// execute runs a template, caching the parsed form.
+func (d *Dispatcher) execute(text string, data TemplateData) (string, error) {
+	d.mutex.Lock()
+	if d.templates == nil {
+		d.templates = map[string]*template.Template{}
+	}
+
+	t, ok := d.templates[text]
+	if !ok {
+		var err error
+		if t, err = template.New("").Parse(text); err != nil {
+			d.mutex.Unlock()
+			return "", err
+		}
+
+		d.templates[text] = t
+	}
+	d.mutex.Unlock()
+
+	buf := &bytes.Buffer{}
+	err := t.Execute(buf, data)
+	return buf.String(), err
+}
+
+func (d *Dispatcher) deadLetter(r *Route, msg Message, err error) error {
+	if d.DeadLetter == "" {
+		return nil
+	}
+
+	content, jErr := json.Marshal(DeadLetterRecord{
+		Time:     time.Now(),
+		Route:    r.Name,
+		Notifier: r.Notifier,
+		Type:     msg.Event.Type,
+		Subject:  msg.Subject,
+		Text:     msg.Text,
+		Error:    err.Error(),
+	})
+	if jErr != nil {
+		return jErr
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	f, fErr := os.OpenFile(d.DeadLetter, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if fErr != nil {
+		return fErr
+	}
+
+	if _, wErr := f.Write(append(content, '\n')); wErr != nil {
+		f.Close()
+		return wErr
+	}
+
+	return f.Close()
+}
+
+func networkName(e ztcentral.Event) string {
+	if e.Network != nil && e.Network.Config != nil && e.Network.Config.Name != nil {
+		return *e.Network.Config.Name
+	}
+
+	return ""
+}
+
+// sleep waits for d, returning false if the context was canceled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ErrStatus is returned by the HTTP notifiers for non-2xx responses.
+var ErrStatus = errors.New("status code was not 2xx")
@@ -0,0 +1,286 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func stringp(s string) *string {
+	return &s
+}
+
+func testEvent(t ztcentral.EventType) ztcentral.Event {
+	return ztcentral.Event{
+		Type:      t,
+		Time:      time.Now(),
+		NetworkID: "8056c2e21c000001",
+		MemberID:  "0123456789",
+		Network:   &spec.Network{Id: stringp("8056c2e21c000001"), Config: &spec.NetworkConfig{Name: stringp("prod")}},
+		Member:    &spec.Member{NodeId: stringp("0123456789"), Name: stringp("laptop")},
+	}
+}
+
+// smtpStub is a minimal SMTP server that records the messages it receives.
+type smtpStub struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	messages []string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &smtpStub{listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 stub ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if l == ".\r\n" {
+					break
+				}
+
+				msg.WriteString(l)
+			}
+
+			s.mutex.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mutex.Unlock()
+
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	const secret = "sekrit"
+
+	var (
+		mutex    sync.Mutex
+		webhooks []WebhookPayload
+		slack    []SlackPayload
+	)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := Verify(r, secret, time.Minute)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		var p WebhookPayload
+		json.Unmarshal(body, &p)
+
+		mutex.Lock()
+		webhooks = append(webhooks, p)
+		mutex.Unlock()
+	}))
+	defer hook.Close()
+
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p SlackPayload
+		json.NewDecoder(r.Body).Decode(&p)
+
+		mutex.Lock()
+		slack = append(slack, p)
+		mutex.Unlock()
+	}))
+	defer slackServer.Close()
+
+	smtpServer := newSMTPStub(t)
+
+	d := &Dispatcher{
+		Notifiers: map[string]Notifier{
+			"hook":  &Webhook{URL: hook.URL, Secret: secret},
+			"slack": &Slack{WebhookURL: slackServer.URL},
+			"email": &Email{Addr: smtpServer.listener.Addr().String(), From: "central@example.com", To: []string{"ops@example.com"}},
+		},
+		Routes: []Route{
+			{Name: "everything", Notifier: "hook"},
+			{Name: "joins", Notifier: "slack", Events: []ztcentral.EventType{ztcentral.EventMemberJoined}},
+			{
+				Name:     "prod rules",
+				Notifier: "email",
+				Events:   []ztcentral.EventType{ztcentral.EventNetworkConfigChanged},
+				Networks: []string{"prod*"},
+				Template: "rules on {{.NetworkName}} changed\n.leading dot\n",
+			},
+			{Name: "staging", Notifier: "email", Networks: []string{"staging"}},
+		},
+	}
+
+	events := make(chan ztcentral.Event, 3)
+	events <- testEvent(ztcentral.EventMemberJoined)
+	events <- ztcentral.Event{Type: ztcentral.EventCheckpoint}
+	events <- testEvent(ztcentral.EventNetworkConfigChanged)
+	close(events)
+
+	if err := d.Run(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(webhooks) != 2 || webhooks[0].Type != ztcentral.EventMemberJoined || webhooks[0].Member == nil {
+		t.Fatalf("unexpected webhooks: %+v", webhooks)
+	}
+
+	expected := "New member 0123456789 waiting for authorization on network prod (8056c2e21c000001)"
+	if webhooks[0].Subject != expected {
+		t.Fatalf("unexpected subject: %q", webhooks[0].Subject)
+	}
+
+	if len(slack) != 1 || slack[0].Text != expected {
+		t.Fatalf("unexpected slack messages: %+v", slack)
+	}
+
+	smtpServer.mutex.Lock()
+	defer smtpServer.mutex.Unlock()
+
+	if len(smtpServer.messages) != 1 {
+		t.Fatalf("unexpected emails: %v", smtpServer.messages)
+	}
+
+	msg := smtpServer.messages[0]
+	if !strings.Contains(msg, "Subject: Configuration changed on network prod") || !strings.Contains(msg, "rules on prod changed\r\n..leading dot\r\n") {
+		t.Fatalf("unexpected email:\n%s", msg)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		attempts int
+	)
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		attempts++
+		mutex.Unlock()
+
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer hook.Close()
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := &Dispatcher{
+		Notifiers:  map[string]Notifier{"hook": &Webhook{URL: hook.URL}},
+		Routes:     []Route{{Name: "hook", Notifier: "hook"}},
+		Retry:      Retry{Attempts: 3, Backoff: time.Millisecond},
+		DeadLetter: filepath.Join(dir, "dead.jsonl"),
+	}
+
+	if err := d.Dispatch(context.Background(), testEvent(ztcentral.EventMemberOffline)); err == nil {
+		t.Fatal("dispatch to a failing webhook succeeded")
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	content, err := ioutil.ReadFile(d.DeadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record DeadLetterRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Route != "hook" || record.Type != ztcentral.EventMemberOffline || !strings.Contains(record.Error, "502") {
+		t.Fatalf("unexpected dead letter: %+v", record)
+	}
+}
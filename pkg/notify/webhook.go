@@ -0,0 +1,199 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of webhook bodies, as
+// "sha256=<hex>".
+const SignatureHeader = "X-ZTCentral-Signature"
+
+// TimestampHeader carries the unix time the webhook was sent. It is included
+// in the signature to prevent replays.
+const TimestampHeader = "X-ZTCentral-Timestamp"
+
+// WebhookPayload is the JSON body of a generic webhook.
+type WebhookPayload struct {
+	Type      ztcentral.EventType `json:"type"`
+	Time      time.Time           `json:"time"`
+	NetworkID string              `json:"networkId"`
+	MemberID  string              `json:"memberId,omitempty"`
+	Subject   string              `json:"subject"`
+	Text      string              `json:"text"`
+	Network   *spec.Network       `json:"network,omitempty"`
+	Member    *spec.Member        `json:"member,omitempty"`
+}
+
+// Webhook posts a WebhookPayload to a URL.
+type Webhook struct {
+	URL string
+	// Secret, if set, signs every request; see Sign.
+	Secret string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	return post(ctx, w.Client, w.URL, w.Secret, WebhookPayload{
+		Type:      msg.Event.Type,
+		Time:      msg.Event.Time,
+		NetworkID: msg.Event.NetworkID,
+		MemberID:  msg.Event.MemberID,
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		Network:   msg.Event.Network,
+		Member:    msg.Event.Member,
+	})
+}
+
+// Sign returns the signature header value for a body sent at timestamp: the
+// hex HMAC-SHA256, keyed with the secret, of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a webhook request's signature, for receivers written in Go. It
+// returns the body. Requests older than maxAge are rejected.
+func Verify(r *http.Request, secret string, maxAge time.Duration) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header", TimestampHeader)
+	}
+
+	if age := time.Since(time.Unix(ts, 0)); age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("webhook timestamp is %v old", age.Round(time.Second))
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get(SignatureHeader)), []byte(Sign(secret, ts, body))) {
+		return nil, fmt.Errorf("invalid %s header", SignatureHeader)
+	}
+
+	return body, nil
+}
+
+// Slack posts to a Slack (or Slack-compatible, such as Mattermost) incoming
+// webhook.
+type Slack struct {
+	WebhookURL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// SlackPayload is the body posted to Slack.
+type SlackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks,omitempty"`
+}
+
+// SlackBlock is a Slack section block.
+type SlackBlock struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+}
+
+// SlackText is the text of a SlackBlock.
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	return post(ctx, s.Client, s.WebhookURL, "", SlackPayload{
+		Text: msg.Subject,
+		Blocks: []SlackBlock{
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "*" + msg.Subject + "*"}},
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "```" + msg.Text + "```"}},
+		},
+	})
+}
+
+func post(ctx context.Context, client *http.Client, url, secret string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(SignatureHeader, Sign(secret, ts, body))
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Status code %v: %w", resp.StatusCode, ErrStatus)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package presence
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func openTestStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "presence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s, err := Open(filepath.Join(dir, "presence.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestHistory(t *testing.T) {
+	s := openTestStore(t)
+
+	start := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+
+	samples := []Sample{
+		{Time: at(0), Online: true, LastOnline: at(0), PhysicalAddress: "1.2.3.4/9993", ClientVersion: "1.12.0"},
+		{Time: at(1), Online: true, LastOnline: at(1), PhysicalAddress: "1.2.3.4/9993", ClientVersion: "1.12.0"},
+		// Central reset LastOnline and the address while the node was away.
+		{Time: at(3), Online: false},
+		{Time: at(5), Online: true, LastOnline: at(5), PhysicalAddress: "5.6.7.8/9993", ClientVersion: "1.14.0"},
+		{Time: at(6), Online: true, LastOnline: at(6), PhysicalAddress: "5.6.7.8/9993", ClientVersion: "1.14.0"},
+	}
+
+	for _, sample := range samples {
+		if err := s.Record("8056c2e21c000001", "0000000001", sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := s.Member("8056c2e21c000001", "0000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.FirstSeen.Equal(at(0)) || !h.LastOnline.Equal(at(6)) || !h.Online {
+		t.Fatalf("unexpected history: %+v", h)
+	}
+
+	if len(h.PhysicalAddresses) != 2 || h.PhysicalAddresses[1].Value != "5.6.7.8/9993" || !h.PhysicalAddresses[1].Time.Equal(at(5)) {
+		t.Fatalf("unexpected addresses: %+v", h.PhysicalAddresses)
+	}
+
+	if len(h.ClientVersions) != 2 || h.ClientVersions[0].Value != "1.12.0" {
+		t.Fatalf("unexpected versions: %+v", h.ClientVersions)
+	}
+
+	if len(h.Intervals) != 2 || !h.Intervals[0].End.Equal(at(1)) || !h.Intervals[1].End.IsZero() {
+		t.Fatalf("unexpected intervals: %+v", h.Intervals)
+	}
+
+	// online 0-1 and 5-6 of the first 6 hours.
+	if d := h.OnlineDuration(at(0), at(6)); d != 2*time.Hour {
+		t.Fatalf("unexpected online duration: %v", d)
+	}
+
+	if u := h.Uptime(at(0), at(8)); u != 0.25 {
+		t.Fatalf("unexpected uptime: %v", u)
+	}
+
+	if _, err := s.Member("8056c2e21c000001", "0000000002"); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded, got %v", err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	fc := testutil.NewFakeCentral()
+	defer fc.Close()
+
+	c, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n := fc.AddNetwork(&spec.Network{})
+	other := fc.AddNetwork(&spec.Network{})
+
+	now := time.Now()
+	ms := now.Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001"), Name: stringp("online"), LastOnline: &ms, PhysicalAddress: stringp("1.2.3.4/9993")})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002"), Name: stringp("offline")})
+	fc.AddMember(*other.Id, &spec.Member{NodeId: stringp("0000000003")})
+	fc.AddMember(*other.Id, &spec.Member{NodeId: stringp("0000000004")})
+	fc.EditMember(*other.Id, "0000000004", func(m *spec.Member) { m.NodeId = nil })
+
+	s := openTestStore(t)
+	r := &Recorder{Client: c, Store: s, Now: func() time.Time { return now }}
+
+	if err := r.Sample(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := s.Members(*n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 2 || !members[0].Online || members[1].Online || members[0].Name != "online" {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+
+	all, err := s.Members("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 3 {
+		t.Fatalf("expected all networks, got %d members", len(all))
+	}
+
+	last, err := s.LastOnline(*n.Id, "0000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last.UnixNano()/int64(time.Millisecond) != ms {
+		t.Fatalf("unexpected last online: %v", last)
+	}
+}
+
+func stringp(s string) *string {
+	return &s
+}
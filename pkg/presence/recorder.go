@@ -0,0 +1,163 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package presence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultInterval is how often a Recorder samples when Interval is not set.
+const DefaultInterval = time.Minute
+
+// Recorder samples members from Central into a Store.
+type Recorder struct {
+	Client *ztcentral.Client
+	Store  *Store
+	// NetworkIDs limits sampling to these networks. Empty samples all of them.
+	NetworkIDs []string
+	// Interval defaults to DefaultInterval. Every sample costs one request
+	// per network, plus one to list networks if NetworkIDs is empty.
+	Interval time.Duration
+	// OnlineThreshold is how recently a member must have been online to be
+	// considered online; it defaults to ztcentral.DefaultOnlineThreshold.
+	OnlineThreshold time.Duration
+	// OnError is called with errors from Run; it may be nil.
+	OnError func(error)
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Run samples until ctx is done.
+func (r *Recorder) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := r.Sample(ctx); err != nil && r.OnError != nil && ctx.Err() == nil {
+			r.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Sample records every member of the watched networks once, in one
+// transaction per network. Members without a node ID are skipped.
+func (r *Recorder) Sample(ctx context.Context) error {
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+
+	threshold := r.OnlineThreshold
+	if threshold <= 0 {
+		threshold = ztcentral.DefaultOnlineThreshold
+	}
+
+	networkIDs := r.NetworkIDs
+	if len(networkIDs) == 0 {
+		networks, err := r.Client.GetNetworks(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range networks {
+			networkIDs = append(networkIDs, *n.Id)
+		}
+	}
+
+	for _, networkID := range networkIDs {
+		members, err := r.Client.GetMembers(ctx, networkID)
+		if err != nil {
+			return fmt.Errorf("while sampling %s: %w", networkID, err)
+		}
+
+		t := now()
+		samples := map[string]Sample{}
+
+		for _, m := range members {
+			if m.NodeId == nil {
+				continue
+			}
+
+			samples[*m.NodeId] = newSample(m, t, threshold)
+		}
+
+		if err := r.Store.RecordNetwork(networkID, samples); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newSample(m *spec.Member, now time.Time, threshold time.Duration) Sample {
+	s := Sample{
+		Time:       now,
+		LastOnline: msTime(m.LastOnline),
+		LastSeen:   msTime(m.LastSeen),
+	}
+
+	if m.Name != nil {
+		s.Name = *m.Name
+	}
+
+	if m.PhysicalAddress != nil {
+		s.PhysicalAddress = *m.PhysicalAddress
+	}
+
+	if v, ok := ztcentral.MemberClientVersion(m); ok {
+		s.ClientVersion = v.String()
+	}
+
+	s.Online = !s.LastOnline.IsZero() && now.Sub(s.LastOnline) < threshold
+	return s
+}
+
+func msTime(ms *int64) time.Time {
+	if ms == nil || *ms == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, *ms*int64(time.Millisecond))
+}
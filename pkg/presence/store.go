@@ -0,0 +1,321 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package presence keeps the member presence history Central does not:
+// LastOnline, LastSeen and PhysicalAddress are ephemeral there, and may be
+// reset to 0 at any time. A Recorder samples members periodically into a
+// Store, an embedded bbolt database, which answers questions like "when was
+// this node last online" or "what was its uptime over 30 days".
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotRecorded is returned for members the store has never sampled.
+var ErrNotRecorded = errors.New("member has not been recorded")
+
+var membersBucket = []byte("members")
+
+// Change is a value a member reported, and when it was first seen.
+type Change struct {
+	Time  time.Time `json:"time"`
+	Value string    `json:"value"`
+}
+
+// Interval is a period a member was online. End is zero while the member is
+// still online.
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`
+}
+
+// History is everything recorded about a member.
+type History struct {
+	NetworkID string `json:"networkId"`
+	MemberID  string `json:"memberId"`
+	Name      string `json:"name"`
+	// FirstSeen and LastSampled are when the recorder first and last found
+	// the member in Central.
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSampled time.Time `json:"lastSampled"`
+	// LastOnline and LastSeen are the latest values Central ever reported,
+	// kept when Central resets them.
+	LastOnline time.Time `json:"lastOnline"`
+	LastSeen   time.Time `json:"lastSeen"`
+	// Online is the state at the last sample.
+	Online            bool       `json:"online"`
+	PhysicalAddresses []Change   `json:"physicalAddresses"`
+	ClientVersions    []Change   `json:"clientVersions"`
+	Intervals         []Interval `json:"intervals"`
+}
+
+// OnlineDuration is how long the member was online in [from, to). An open
+// interval counts as online up to the last sample.
+func (h *History) OnlineDuration(from, to time.Time) time.Duration {
+	var total time.Duration
+
+	for _, i := range h.Intervals {
+		end := i.End
+		if end.IsZero() {
+			end = h.LastSampled
+		}
+
+		if i.Start.Before(from) {
+			i.Start = from
+		}
+
+		if end.After(to) {
+			end = to
+		}
+
+		if end.After(i.Start) {
+			total += end.Sub(i.Start)
+		}
+	}
+
+	return total
+}
+
+// Uptime is the fraction of [from, to) the member was online.
+func (h *History) Uptime(from, to time.Time) float64 {
+	if !to.After(from) {
+		return 0
+	}
+
+	return float64(h.OnlineDuration(from, to)) / float64(to.Sub(from))
+}
+
+// Sample is one observation of a member.
+type Sample struct {
+	Time            time.Time
+	Name            string
+	Online          bool
+	LastOnline      time.Time
+	LastSeen        time.Time
+	PhysicalAddress string
+	ClientVersion   string
+}
+
+// apply folds a sample into the history.
+func (h *History) apply(s Sample) {
+	if h.FirstSeen.IsZero() {
+		h.FirstSeen = s.Time
+	}
+
+	prevSample := h.LastSampled
+	h.LastSampled = s.Time
+	h.Name = s.Name
+
+	if s.LastOnline.After(h.LastOnline) {
+		h.LastOnline = s.LastOnline
+	}
+
+	if s.LastSeen.After(h.LastSeen) {
+		h.LastSeen = s.LastSeen
+	}
+
+	h.PhysicalAddresses = appendChange(h.PhysicalAddresses, s.Time, s.PhysicalAddress)
+	h.ClientVersions = appendChange(h.ClientVersions, s.Time, s.ClientVersion)
+
+	open := len(h.Intervals) > 0 && h.Intervals[len(h.Intervals)-1].End.IsZero()
+
+	switch {
+	case s.Online && !open:
+		h.Intervals = append(h.Intervals, Interval{Start: s.Time})
+	case !s.Online && open:
+		// the member went away somewhere between the last sample that saw it
+		// online and its last contact with Central, whichever is later.
+		end := prevSample
+		if h.LastOnline.After(end) && h.LastOnline.Before(s.Time) {
+			end = h.LastOnline
+		}
+
+		h.Intervals[len(h.Intervals)-1].End = end
+	}
+
+	h.Online = s.Online
+}
+
+// appendChange records value if it differs from the last one. Empty values,
+// which Central reports for offline members, are not changes.
+func appendChange(changes []Change, t time.Time, value string) []Change {
+	if value == "" || (len(changes) > 0 && changes[len(changes)-1].Value == value) {
+		return changes
+	}
+
+	return append(changes, Change{Time: t, Value: value})
+}
+
+// Store is the embedded presence database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens, or creates, the store at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(membersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record folds a sample into the member's history.
+func (s *Store) Record(networkID, memberID string, sample Sample) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return record(tx.Bucket(membersBucket), networkID, memberID, sample)
+	})
+}
+
+// RecordNetwork folds samples, keyed by member ID, into the histories of a
+// network's members in a single transaction.
+func (s *Store) RecordNetwork(networkID string, samples map[string]Sample) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(membersBucket)
+
+		for memberID, sample := range samples {
+			if err := record(b, networkID, memberID, sample); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func record(b *bolt.Bucket, networkID, memberID string, sample Sample) error {
+	key := memberKey(networkID, memberID)
+
+	h := &History{NetworkID: networkID, MemberID: memberID}
+	if v := b.Get(key); v != nil {
+		if err := json.Unmarshal(v, h); err != nil {
+			return err
+		}
+	}
+
+	h.apply(sample)
+
+	v, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key, v)
+}
+
+// Member returns a member's history.
+func (s *Store) Member(networkID, memberID string) (*History, error) {
+	var h *History
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(membersBucket).Get(memberKey(networkID, memberID))
+		if v == nil {
+			return fmt.Errorf("%w: %s/%s", ErrNotRecorded, networkID, memberID)
+		}
+
+		h = &History{}
+		return json.Unmarshal(v, h)
+	})
+
+	return h, err
+}
+
+// Members returns the history of every recorded member of a network, ordered
+// by network and member ID. An empty networkID returns all networks.
+func (s *Store) Members(networkID string) ([]*History, error) {
+	res := []*History{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte{}
+		if networkID != "" {
+			prefix = memberKey(networkID, "")
+		}
+
+		c := tx.Bucket(membersBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			h := &History{}
+			if err := json.Unmarshal(v, h); err != nil {
+				return err
+			}
+
+			res = append(res, h)
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+// LastOnline returns the last time the member was known to be online.
+func (s *Store) LastOnline(networkID, memberID string) (time.Time, error) {
+	h, err := s.Member(networkID, memberID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return h.LastOnline, nil
+}
+
+// Uptime returns the fraction of the window ending now that the member was
+// online.
+func (s *Store) Uptime(networkID, memberID string, window time.Duration) (float64, error) {
+	h, err := s.Member(networkID, memberID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	return h.Uptime(now.Add(-window), now), nil
+}
+
+func memberKey(networkID, memberID string) []byte {
+	return []byte(networkID + "/" + memberID)
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package provision creates ZeroTier node identities ahead of time and
+// pre-authorizes them in Central, so immutable infrastructure can join a
+// network on first boot without a manual step.
+package provision
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztidentity"
+)
+
+// DefaultHomeDir is where zerotier-one keeps its state on Linux.
+const DefaultHomeDir = "/var/lib/zerotier-one"
+
+// DefaultInstallCommand installs ZeroTier in the cloud-init snippet.
+const DefaultInstallCommand = "curl -s https://install.zerotier.com | bash"
+
+// LocalConf are the per-network settings of the node, written to
+// networks.d/<nwid>.local.conf.
+type LocalConf struct {
+	// AllowManaged allows the network to assign IPs and routes.
+	AllowManaged bool
+	// AllowGlobal allows assigned IPs and routes that overlap global IPs.
+	AllowGlobal bool
+	// AllowDefault allows the network to override the default route.
+	AllowDefault bool
+	// AllowDNS allows the network to configure DNS.
+	AllowDNS bool
+}
+
+// DefaultLocalConf is ZeroTier's default: managed addresses only.
+var DefaultLocalConf = LocalConf{AllowManaged: true}
+
+// Options describe the node to provision.
+type Options struct {
+	NetworkID   string
+	Name        string
+	Description string
+	// IPAssignments are static IPs for the node. Without them, Central assigns
+	// IPs from the network's pools when the node joins.
+	IPAssignments []string
+	// Tags are [id, value] pairs.
+	Tags         [][2]int
+	Capabilities []int
+	// LocalConf defaults to DefaultLocalConf.
+	LocalConf *LocalConf
+	// HomeDir is where the node keeps its ZeroTier state; it defaults to
+	// DefaultHomeDir.
+	HomeDir string
+	// InstallCommand is run by the cloud-init snippet after the files are
+	// written; it defaults to DefaultInstallCommand. Set it to "-" to skip it.
+	InstallCommand string
+}
+
+// Bundle is a provisioned node: its identity, its Central member record and
+// the files that make it join on boot.
+type Bundle struct {
+	NodeID         string
+	NetworkID      string
+	IdentityPublic string
+	// IdentitySecret contains the private key. Treat the bundle, and
+	// anything rendered from it, as a secret.
+	IdentitySecret string
+	LocalConf      LocalConf
+	HomeDir        string
+	InstallCommand string
+	Member         *spec.Member
+}
+
+// Provision generates a new identity and authorizes it on the network with the
+// requested name, IPs and tags.
+func Provision(ctx context.Context, c *ztcentral.Client, opts Options) (*Bundle, error) {
+	if _, err := ztcentral.ParseNetworkID(opts.NetworkID); err != nil {
+		return nil, err
+	}
+
+	id := ztidentity.NewZeroTierIdentity()
+
+	b := &Bundle{
+		NodeID:         id.IDString(),
+		NetworkID:      opts.NetworkID,
+		IdentityPublic: id.PublicKeyString(),
+		IdentitySecret: id.PrivateKeyString(),
+		LocalConf:      DefaultLocalConf,
+		HomeDir:        opts.HomeDir,
+		InstallCommand: opts.InstallCommand,
+	}
+
+	if opts.LocalConf != nil {
+		b.LocalConf = *opts.LocalConf
+	}
+
+	if b.HomeDir == "" {
+		b.HomeDir = DefaultHomeDir
+	}
+
+	if b.InstallCommand == "" {
+		b.InstallCommand = DefaultInstallCommand
+	}
+
+	m := &spec.Member{
+		NetworkId: &b.NetworkID,
+		NodeId:    &b.NodeID,
+		Name:      &opts.Name,
+		Config:    &spec.MemberConfig{Authorized: &[]bool{true}[0]},
+	}
+
+	if opts.Description != "" {
+		m.Description = &opts.Description
+	}
+
+	if len(opts.IPAssignments) > 0 {
+		ips := append([]string{}, opts.IPAssignments...)
+		m.Config.IpAssignments = &ips
+	}
+
+	if len(opts.Tags) > 0 {
+		tags := [][]interface{}{}
+		for _, tag := range opts.Tags {
+			tags = append(tags, []interface{}{tag[0], tag[1]})
+		}
+
+		m.Config.Tags = &tags
+	}
+
+	if len(opts.Capabilities) > 0 {
+		caps := append([]int{}, opts.Capabilities...)
+		m.Config.Capabilities = &caps
+	}
+
+	var err error
+	if b.Member, err = c.UpdateMember(ctx, b.NetworkID, b.NodeID, m); err != nil {
+		return nil, fmt.Errorf("while authorizing %s: %w", b.NodeID, err)
+	}
+
+	return b, nil
+}
+
+// Files returns the bundle's files, relative to the ZeroTier home directory,
+// with their permissions.
+func (b *Bundle) Files() map[string]File {
+	return map[string]File{
+		"identity.public": {Content: b.IdentityPublic + "\n", Mode: 0644},
+		"identity.secret": {Content: b.IdentitySecret + "\n", Mode: 0600},
+		// an empty conf file is enough for zerotier-one to join the network
+		// on start; it is replaced with the real config once joined.
+		filepath.Join("networks.d", b.NetworkID+".conf"):       {Content: "", Mode: 0644},
+		filepath.Join("networks.d", b.NetworkID+".local.conf"): {Content: b.LocalConf.String(), Mode: 0644},
+	}
+}
+
+// File is a file in the bundle.
+type File struct {
+	Content string
+	Mode    os.FileMode
+}
+
+func (lc LocalConf) String() string {
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+
+		return 0
+	}
+
+	return fmt.Sprintf("allowManaged=%d\nallowGlobal=%d\nallowDefault=%d\nallowDNS=%d\n",
+		flag(lc.AllowManaged), flag(lc.AllowGlobal), flag(lc.AllowDefault), flag(lc.AllowDNS))
+}
+
+// WriteDir writes the bundle to dir: the ZeroTier state files laid out as they
+// are in the home directory, plus install.sh and cloud-init.yaml.
+func (b *Bundle) WriteDir(dir string) error {
+	files := b.Files()
+	files["install.sh"] = File{Content: b.ShellScript(), Mode: 0700}
+	files["cloud-init.yaml"] = File{Content: b.CloudInit(), Mode: 0600}
+
+	for _, name := range sortedFiles(files) {
+		f := files[name]
+		p := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(p, []byte(f.Content), f.Mode); err != nil {
+			return err
+		}
+
+		// WriteFile does not change the mode of existing files.
+		if err := os.Chmod(p, f.Mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShellScript returns a shell script that installs the bundle's files into
+// the home directory and restarts zerotier-one. It expects ZeroTier to be
+// installed already.
+func (b *Bundle) ShellScript() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "#!/bin/sh\n# ZeroTier node %s for network %s\nset -e\n\n", b.NodeID, b.NetworkID)
+	fmt.Fprintf(buf, "mkdir -p %s/networks.d\n", shellQuote(b.HomeDir))
+
+	files := b.Files()
+	for _, name := range sortedFiles(files) {
+		f := files[name]
+		p := shellQuote(filepath.Join(b.HomeDir, name))
+
+		fmt.Fprintf(buf, "cat > %s <<'ZTEOF'\n%sZTEOF\n", p, f.Content)
+		fmt.Fprintf(buf, "chmod %o %s\n", f.Mode, p)
+	}
+
+	buf.WriteString("\nif command -v systemctl >/dev/null 2>&1; then\n\tsystemctl restart zerotier-one\nelse\n\tservice zerotier-one restart\nfi\n")
+	return buf.String()
+}
+
+// CloudInit returns a #cloud-config document that writes the bundle's files
+// and then runs the install command.
+func (b *Bundle) CloudInit() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString("#cloud-config\nwrite_files:\n")
+
+	files := b.Files()
+	for _, name := range sortedFiles(files) {
+		f := files[name]
+
+		fmt.Fprintf(buf, "  - path: %s\n", filepath.Join(b.HomeDir, name))
+		fmt.Fprintf(buf, "    permissions: '0%o'\n", f.Mode)
+		if f.Content == "" {
+			buf.WriteString("    content: ''\n")
+			continue
+		}
+
+		buf.WriteString("    content: |\n")
+		for _, line := range strings.Split(strings.TrimSuffix(f.Content, "\n"), "\n") {
+			fmt.Fprintf(buf, "      %s\n", line)
+		}
+	}
+
+	if b.InstallCommand != "-" {
+		fmt.Fprintf(buf, "runcmd:\n  - [sh, -c, %s]\n", yamlQuote(b.InstallCommand))
+	}
+
+	return buf.String()
+}
+
+func sortedFiles(files map[string]File) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
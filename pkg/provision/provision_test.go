@@ -0,0 +1,152 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package provision
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func TestProvision(t *testing.T) {
+	fc := testutil.NewFakeCentral()
+	defer fc.Close()
+
+	c, err := ztcentral.NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := Provision(ctx, c, Options{NetworkID: "nope"}); err == nil {
+		t.Fatal("provisioned on an invalid network id")
+	}
+
+	network := fc.AddNetwork(&spec.Network{})
+
+	b, err := Provision(ctx, c, Options{
+		NetworkID:     *network.Id,
+		Name:          "web-1",
+		IPAssignments: []string{"10.0.0.10"},
+		Tags:          [][2]int{{1, 2}},
+		LocalConf:     &LocalConf{AllowManaged: true, AllowDNS: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := ztcentral.ParseIdentity(b.IdentitySecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := id.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id.Address.String() != b.NodeID || !strings.HasPrefix(b.IdentitySecret, b.IdentityPublic+":") {
+		t.Fatalf("identity does not match node id %s", b.NodeID)
+	}
+
+	m := fc.Member(*network.Id, b.NodeID)
+	if m == nil {
+		t.Fatal("member was not created")
+	}
+
+	if !*m.Config.Authorized || *m.Name != "web-1" {
+		t.Fatalf("member was not authorized and named: %+v", m)
+	}
+
+	if !reflect.DeepEqual(*m.Config.IpAssignments, []string{"10.0.0.10"}) {
+		t.Fatalf("unexpected ips: %v", *m.Config.IpAssignments)
+	}
+
+	if len(*m.Config.Tags) != 1 {
+		t.Fatalf("unexpected tags: %v", *m.Config.Tags)
+	}
+
+	dir, err := ioutil.TempDir("", "provision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := b.WriteDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, "identity.secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("identity.secret has mode %v", fi.Mode().Perm())
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "networks.d", *network.Id+".local.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "allowManaged=1\nallowGlobal=0\nallowDefault=0\nallowDNS=1\n" {
+		t.Fatalf("unexpected local.conf: %q", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "networks.d", *network.Id+".conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	script := b.ShellScript()
+	if !strings.Contains(script, b.IdentitySecret) || !strings.Contains(script, "/var/lib/zerotier-one/networks.d/"+*network.Id+".conf") {
+		t.Fatalf("shell script is missing files:\n%s", script)
+	}
+
+	ci := b.CloudInit()
+	for _, want := range []string{"#cloud-config", "permissions: '0600'", "      " + b.IdentitySecret, DefaultInstallCommand} {
+		if !strings.Contains(ci, want) {
+			t.Fatalf("cloud-init is missing %q:\n%s", want, ci)
+		}
+	}
+}
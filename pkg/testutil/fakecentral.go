@@ -0,0 +1,635 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// FakeControllerID is the controller prefix of networks created by FakeCentral.
+const FakeControllerID = "8056c2e21c"
+
+// FakeUserID is the ID of the user FakeCentral reports in /status.
+const FakeUserID = "00000000-0000-0000-0000-000000000001"
+
+// FakeOrgID is the ID of the organization FakeCentral reports in /org.
+const FakeOrgID = "00000000-0000-0000-0000-0000000000a1"
+
+// FakeCentral is an in-memory stand-in for the parts of the Central API the
+// client uses. Updates are merged into the stored records the way Central
+// merges them, so partial updates behave as they do against the real service.
+//
+// Point a client at it with client.SetBaseURL(fake.BaseURL()).
+type FakeCentral struct {
+	Server *httptest.Server
+
+	// Token, if set, is the only bearer token accepted.
+	Token string
+
+	// Fail, if set, is consulted before every request. Returning a non-zero
+	// status code fails the request with that status.
+	Fail func(r *http.Request) int
+
+	// RateLimit and RateRemaining are sent as the rate limit headers when
+	// RateLimit is non-zero.
+	RateLimit     int
+	RateRemaining int
+
+	mutex       sync.Mutex
+	networks    map[string]*spec.Network
+	members     map[string]map[string]*spec.Member
+	tokens      map[string]string
+	orgMembers  []*spec.OrganizationMember
+	invitations map[string]*FakeInvitation
+	nextNetwork int
+	nextInvite  int
+	requests    []string
+}
+
+// FakeInvitation is an organization invitation as Central sends it; unlike
+// spec.OrganizationInvitation, its status is a plain string.
+type FakeInvitation struct {
+	ID           string `json:"id"`
+	OrgID        string `json:"orgId"`
+	Email        string `json:"email"`
+	Status       string `json:"status"`
+	CreationTime int64  `json:"creation_time"`
+	UpdateTime   int64  `json:"update_time"`
+}
+
+// NewFakeCentral starts a FakeCentral. Close it when finished.
+func NewFakeCentral() *FakeCentral {
+	fc := &FakeCentral{
+		networks:    map[string]*spec.Network{},
+		members:     map[string]map[string]*spec.Member{},
+		tokens:      map[string]string{},
+		invitations: map[string]*FakeInvitation{},
+	}
+
+	fc.Server = httptest.NewServer(http.HandlerFunc(fc.serveHTTP))
+
+	return fc
+}
+
+// Close stops the server.
+func (fc *FakeCentral) Close() {
+	fc.Server.Close()
+}
+
+// BaseURL is the API URL to give to the client.
+func (fc *FakeCentral) BaseURL() string {
+	return fc.Server.URL + "/api"
+}
+
+// Requests returns the "METHOD /path" of every request served so far.
+func (fc *FakeCentral) Requests() []string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	return append([]string{}, fc.requests...)
+}
+
+// AddNetwork stores a network, assigning an ID if it has none, and returns a
+// copy of the stored record.
+func (fc *FakeCentral) AddNetwork(n *spec.Network) *spec.Network {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	return fc.createNetwork(n)
+}
+
+// AddMember stores a member of an existing network, and returns a copy of the
+// stored record.
+func (fc *FakeCentral) AddMember(networkID string, m *spec.Member) *spec.Member {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if m.NodeId == nil && m.Config != nil && m.Config.Id != nil {
+		m.NodeId = m.Config.Id
+	}
+
+	res, _ := fc.updateMember(networkID, *m.NodeId, m)
+	return res
+}
+
+// Network returns a copy of a stored network, or nil.
+func (fc *FakeCentral) Network(id string) *spec.Network {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	n, ok := fc.networks[id]
+	if !ok {
+		return nil
+	}
+
+	return fc.networkView(n)
+}
+
+// Member returns a copy of a stored member, or nil.
+func (fc *FakeCentral) Member(networkID, memberID string) *spec.Member {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	m, ok := fc.members[networkID][memberID]
+	if !ok {
+		return nil
+	}
+
+	res := &spec.Member{}
+	copyJSON(m, res)
+	return res
+}
+
+// EditMember calls fn with the stored member, allowing tests to change fields
+// Central controls, such as LastOnline. It returns false if there is no such
+// member.
+func (fc *FakeCentral) EditMember(networkID, memberID string, fn func(m *spec.Member)) bool {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	m, ok := fc.members[networkID][memberID]
+	if ok {
+		fn(m)
+	}
+
+	return ok
+}
+
+// AddOrgMember adds a member to the organization.
+func (fc *FakeCentral) AddOrgMember(m *spec.OrganizationMember) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	stored := &spec.OrganizationMember{}
+	copyJSON(m, stored)
+	stored.OrgId = stringp(FakeOrgID)
+	fc.orgMembers = append(fc.orgMembers, stored)
+}
+
+// Invitation returns a copy of a stored invitation, or nil.
+func (fc *FakeCentral) Invitation(id string) *FakeInvitation {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	inv, ok := fc.invitations[id]
+	if !ok {
+		return nil
+	}
+
+	res := *inv
+	return &res
+}
+
+// Tokens returns the API tokens that have been added, by name.
+func (fc *FakeCentral) Tokens() map[string]string {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	res := map[string]string{}
+	for k, v := range fc.tokens {
+		res[k] = v
+	}
+
+	return res
+}
+
+func (fc *FakeCentral) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.requests = append(fc.requests, r.Method+" "+r.URL.Path)
+
+	if fc.RateLimit != 0 {
+		w.Header().Set("X-Ratelimit-Limit", strconv.Itoa(fc.RateLimit))
+		w.Header().Set("X-Ratelimit-Remaining", strconv.Itoa(fc.RateRemaining))
+		w.Header().Set("X-Ratelimit-Reset", time.Now().Add(time.Minute).UTC().Format(time.RFC1123))
+	}
+
+	if fc.Token != "" && !strings.EqualFold(r.Header.Get("Authorization"), "bearer "+fc.Token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if fc.Fail != nil {
+		if status := fc.Fail(r); status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, status := fc.route(r.Method, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/"), body)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (fc *FakeCentral) route(method string, path []string, body map[string]interface{}) (interface{}, int) {
+	switch {
+	case len(path) == 1 && path[0] == "status" && method == http.MethodGet:
+		return &spec.Status{User: &spec.User{Id: stringp(FakeUserID)}}, http.StatusOK
+	case len(path) == 1 && path[0] == "randomToken" && method == http.MethodGet:
+		return &spec.RandomToken{Token: stringp(randomToken())}, http.StatusOK
+	case len(path) == 3 && path[0] == "user" && path[2] == "token" && method == http.MethodPost:
+		name, _ := body["tokenName"].(string)
+		token, _ := body["token"].(string)
+		fc.tokens[name] = token
+		return &spec.APIToken{TokenName: &name}, http.StatusOK
+	case len(path) == 4 && path[0] == "user" && path[2] == "token" && method == http.MethodDelete:
+		if _, ok := fc.tokens[path[3]]; !ok {
+			return nil, http.StatusNotFound
+		}
+
+		delete(fc.tokens, path[3])
+		return struct{}{}, http.StatusOK
+	case len(path) >= 1 && path[0] == "network":
+		return fc.routeNetwork(method, path[1:], body)
+	case len(path) >= 1 && (path[0] == "org" || path[0] == "org-invitation"):
+		return fc.routeOrg(method, path, body)
+	}
+
+	return nil, http.StatusNotFound
+}
+
+func (fc *FakeCentral) routeOrg(method string, path []string, body map[string]interface{}) (interface{}, int) {
+	org := func() *spec.Organization {
+		members := []spec.OrganizationMember{}
+		for _, m := range fc.orgMembers {
+			members = append(members, *m)
+		}
+
+		return &spec.Organization{Id: stringp(FakeOrgID), OwnerId: stringp(FakeUserID), Members: &members}
+	}
+
+	switch {
+	case path[0] == "org" && len(path) == 1 && method == http.MethodGet:
+		return org(), http.StatusOK
+	case path[0] == "org" && len(path) == 2 && path[1] == FakeOrgID && method == http.MethodGet:
+		return org(), http.StatusOK
+	case path[0] == "org" && len(path) == 3 && path[1] == FakeOrgID && path[2] == "user" && method == http.MethodGet:
+		return *org().Members, http.StatusOK
+	case path[0] == "org-invitation" && len(path) == 1 && method == http.MethodGet:
+		ids := make([]string, 0, len(fc.invitations))
+		for id := range fc.invitations {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+
+		res := []*FakeInvitation{}
+		for _, id := range ids {
+			res = append(res, fc.invitations[id])
+		}
+
+		return res, http.StatusOK
+	case path[0] == "org-invitation" && len(path) == 1 && method == http.MethodPost:
+		email, _ := body["email"].(string)
+		if email == "" {
+			return nil, http.StatusBadRequest
+		}
+
+		fc.nextInvite++
+		now := nowMillis()
+		inv := &FakeInvitation{
+			ID:           fmt.Sprintf("00000000-0000-0000-0001-%012x", fc.nextInvite),
+			OrgID:        FakeOrgID,
+			Email:        email,
+			Status:       "pending",
+			CreationTime: now,
+			UpdateTime:   now,
+		}
+
+		fc.invitations[inv.ID] = inv
+		return inv, http.StatusOK
+	case path[0] == "org-invitation" && len(path) == 2:
+		inv, ok := fc.invitations[path[1]]
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+
+		switch method {
+		case http.MethodGet:
+		case http.MethodPost:
+			inv.Status = "accepted"
+			inv.UpdateTime = nowMillis()
+		case http.MethodDelete:
+			inv.Status = "canceled"
+			inv.UpdateTime = nowMillis()
+		default:
+			return nil, http.StatusMethodNotAllowed
+		}
+
+		return inv, http.StatusOK
+	}
+
+	return nil, http.StatusNotFound
+}
+
+func (fc *FakeCentral) routeNetwork(method string, path []string, body map[string]interface{}) (interface{}, int) {
+	if len(path) == 0 {
+		switch method {
+		case http.MethodGet:
+			ids := make([]string, 0, len(fc.networks))
+			for id := range fc.networks {
+				ids = append(ids, id)
+			}
+
+			sort.Strings(ids)
+
+			res := []*spec.Network{}
+			for _, id := range ids {
+				res = append(res, fc.networkView(fc.networks[id]))
+			}
+
+			return res, http.StatusOK
+		case http.MethodPost:
+			n := &spec.Network{}
+			copyJSON(body, n)
+			return fc.createNetwork(n), http.StatusOK
+		}
+
+		return nil, http.StatusMethodNotAllowed
+	}
+
+	n, ok := fc.networks[path[0]]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+
+	if len(path) == 1 {
+		switch method {
+		case http.MethodGet:
+			return fc.networkView(n), http.StatusOK
+		case http.MethodPost:
+			delete(body, "id")
+			if config, ok := body["config"].(map[string]interface{}); ok {
+				delete(config, "id")
+			}
+
+			mergeJSON(n, body)
+			n.Config.LastModified = int64p(nowMillis())
+			return fc.networkView(n), http.StatusOK
+		case http.MethodDelete:
+			delete(fc.networks, path[0])
+			delete(fc.members, path[0])
+			return struct{}{}, http.StatusOK
+		}
+
+		return nil, http.StatusMethodNotAllowed
+	}
+
+	if path[1] != "member" || len(path) > 3 {
+		return nil, http.StatusNotFound
+	}
+
+	if len(path) == 2 {
+		if method != http.MethodGet {
+			return nil, http.StatusMethodNotAllowed
+		}
+
+		ids := make([]string, 0, len(fc.members[path[0]]))
+		for id := range fc.members[path[0]] {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+
+		res := []*spec.Member{}
+		for _, id := range ids {
+			res = append(res, fc.members[path[0]][id])
+		}
+
+		return res, http.StatusOK
+	}
+
+	m, ok := fc.members[path[0]][path[2]]
+
+	switch method {
+	case http.MethodGet:
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+
+		return m, http.StatusOK
+	case http.MethodPost:
+		// Central creates members that are updated before they join.
+		update := &spec.Member{}
+		copyJSON(body, update)
+		return fc.updateMember(path[0], path[2], update)
+	case http.MethodDelete:
+		if !ok {
+			return nil, http.StatusNotFound
+		}
+
+		delete(fc.members[path[0]], path[2])
+		return struct{}{}, http.StatusOK
+	}
+
+	return nil, http.StatusMethodNotAllowed
+}
+
+// createNetwork must be called with the mutex held.
+func (fc *FakeCentral) createNetwork(n *spec.Network) *spec.Network {
+	stored := &spec.Network{}
+	copyJSON(n, stored)
+
+	if stored.Config == nil {
+		stored.Config = &spec.NetworkConfig{}
+	}
+
+	id := stored.Id
+	if id == nil {
+		id = stored.Config.Id
+	}
+
+	if id == nil {
+		fc.nextNetwork++
+		id = stringp(fmt.Sprintf("%s%06x", FakeControllerID, fc.nextNetwork))
+	}
+
+	now := nowMillis()
+
+	stored.Id = stringp(*id)
+	stored.Config.Id = stringp(*id)
+	if stored.Config.CreationTime == nil {
+		stored.Config.CreationTime = int64p(now)
+	}
+	stored.Config.LastModified = int64p(now)
+	if stored.Config.Private == nil {
+		stored.Config.Private = boolp(true)
+	}
+
+	fc.networks[*id] = stored
+	if fc.members[*id] == nil {
+		fc.members[*id] = map[string]*spec.Member{}
+	}
+
+	return fc.networkView(stored)
+}
+
+// updateMember must be called with the mutex held.
+func (fc *FakeCentral) updateMember(networkID, memberID string, update *spec.Member) (*spec.Member, int) {
+	if _, ok := fc.networks[networkID]; !ok {
+		return nil, http.StatusNotFound
+	}
+
+	now := nowMillis()
+
+	m, ok := fc.members[networkID][memberID]
+	if !ok {
+		m = &spec.Member{
+			Id:        stringp(networkID + "-" + memberID),
+			NetworkId: stringp(networkID),
+			NodeId:    stringp(memberID),
+			Config: &spec.MemberConfig{
+				Id:           stringp(memberID),
+				Authorized:   boolp(false),
+				CreationTime: int64p(now),
+				Revision:     intp(0),
+			},
+		}
+
+		fc.members[networkID][memberID] = m
+	}
+
+	wasAuthorized := *m.Config.Authorized
+
+	body := map[string]interface{}{}
+	copyJSON(update, &body)
+	for _, key := range []string{"id", "networkId", "nodeId"} {
+		delete(body, key)
+	}
+
+	if config, ok := body["config"].(map[string]interface{}); ok {
+		delete(config, "id")
+	}
+
+	mergeJSON(m, body)
+
+	if m.Config.Authorized == nil {
+		m.Config.Authorized = boolp(false)
+	}
+
+	if *m.Config.Authorized && !wasAuthorized {
+		m.Config.LastAuthorizedTime = int64p(now)
+	} else if !*m.Config.Authorized && wasAuthorized {
+		m.Config.LastDeauthorizedTime = int64p(now)
+	}
+
+	m.Config.Revision = intp(intv(m.Config.Revision) + 1)
+	m.Clock = int64p(now)
+
+	res := &spec.Member{}
+	copyJSON(m, res)
+
+	return res, http.StatusOK
+}
+
+// networkView copies the network and fills in the member counts, which Central
+// computes on the fly. It must be called with the mutex held.
+func (fc *FakeCentral) networkView(n *spec.Network) *spec.Network {
+	res := &spec.Network{}
+	copyJSON(n, res)
+
+	var authorized int
+	for _, m := range fc.members[*n.Id] {
+		if m.Config != nil && m.Config.Authorized != nil && *m.Config.Authorized {
+			authorized++
+		}
+	}
+
+	res.AuthorizedMemberCount = intp(authorized)
+	res.TotalMemberCount = intp(len(fc.members[*n.Id]))
+	res.Clock = int64p(nowMillis())
+
+	return res
+}
+
+// mergeJSON merges the JSON object update into dst, recursing into objects and
+// replacing everything else. Like Central, null values are ignored; the
+// generated types send every unset field as null.
+func mergeJSON(dst interface{}, update map[string]interface{}) {
+	cur := map[string]interface{}{}
+	copyJSON(dst, &cur)
+	mergeMaps(cur, update)
+	copyJSON(cur, dst)
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			continue
+		}
+
+		sub, ok := v.(map[string]interface{})
+		if cur, isMap := dst[k].(map[string]interface{}); ok && isMap {
+			mergeMaps(cur, sub)
+			continue
+		}
+
+		dst[k] = v
+	}
+}
+
+func copyJSON(src, dst interface{}) {
+	content, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := json.Unmarshal(content, dst); err != nil {
+		panic(err)
+	}
+}
+
+func randomToken() string {
+	return RandomString(32, 32)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func stringp(s string) *string {
+	return &s
+}
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func intp(i int) *int {
+	return &i
+}
+
+func int64p(i int64) *int64 {
+	return &i
+}
+
+func intv(i *int) int {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
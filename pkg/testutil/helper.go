@@ -1,11 +1,13 @@
 package testutil
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
 	"testing"
+
+	"github.com/zerotier/go-ztcentral/pkg/token"
 )
 
 // TokenFile is the filename of where the token resides. Whitespace will be
@@ -26,19 +28,16 @@ func InitTokenFromEnv() string {
 // InitToken will attempt to read the string passed; if it is empty, it will
 // attempt to read it from the file (see TokenFile).
 func InitToken(controllerToken string) string {
-	if controllerToken == "" {
-		if fi, err := os.Stat("test-token.txt"); err != nil {
-			fmt.Fprintln(os.Stderr, "test-token.txt not present in tree; ZEROTIER_CENTRAL_TOKEN is required in environment for many tests.")
-		} else if fi.Mode()&os.ModeIrregular != 0 {
-			panic("test-token.txt is not a regular file; not sure what to do here, so bailing")
-		} else {
-			content, err := ioutil.ReadFile("test-token.txt")
-			if err != nil {
-				panic(err)
-			}
-
-			controllerToken = strings.TrimSpace(string(content))
-		}
+	if controllerToken != "" {
+		return controllerToken
+	}
+
+	controllerToken, err := token.Source{File: TokenFile}.Token(context.Background())
+	switch {
+	case os.IsNotExist(err), errors.Is(err, token.ErrNoToken):
+		fmt.Fprintf(os.Stderr, "%s not present in tree; %s is required in environment for many tests.\n", TokenFile, TokenEnv)
+	case err != nil:
+		panic(err)
 	}
 
 	return controllerToken
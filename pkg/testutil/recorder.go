@@ -0,0 +1,437 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RecordEnv, when set along with a token, makes UseCassette record against
+// the live Central instead of replaying.
+var RecordEnv = "ZEROTIER_CENTRAL_RECORD"
+
+// CassetteDir is where UseCassette keeps cassettes, relative to the test's
+// package.
+var CassetteDir = filepath.Join("testdata", "cassettes")
+
+// ScrubbedToken replaces API tokens, and other secrets, in cassettes. It is
+// as long as a Central token so that replayed tokens pass length checks.
+const ScrubbedToken = "00000000000000000000000000000000"
+
+// Mode is what a Recorder does with requests.
+type Mode int
+
+const (
+	// ModeReplay serves requests from the cassette, without the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to Central and adds them to the cassette.
+	ModeRecord
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequestBody  string `json:"requestBody,omitempty"`
+	Status       int    `json:"status"`
+	ContentType  string `json:"contentType,omitempty"`
+	ResponseBody string `json:"responseBody"`
+}
+
+// Cassette is the file a Recorder reads and writes.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records interactions with Central to
+// a cassette, or replays them from one. Plug it into a client with
+// SetTransport.
+//
+// Secrets and IDs are scrubbed before anything is written: the Authorization
+// header is never recorded, token and client secret fields become
+// ScrubbedToken, and network, node and user IDs are replaced by placeholders
+// numbered in the order they are first seen. On replay, the IDs of the
+// incoming requests are numbered the same way, so a test that makes the same
+// requests in the same order matches the cassette even if it generates fresh
+// IDs, and gets its own IDs back in the responses.
+//
+// Requests are matched on method, path and body, and each interaction is
+// served once, in order, so repeated requests can see changing state.
+type Recorder struct {
+	// Transport sends requests in ModeRecord; it defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mode     Mode
+	path     string
+	mutex    sync.Mutex
+	cassette Cassette
+	used     []bool
+	ids      *idScrubber
+}
+
+// NewRecorder creates a recorder for the cassette at path. In ModeReplay, the
+// cassette is read now.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{mode: mode, path: path, ids: newIDScrubber()}
+
+	if mode == ModeReplay {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(content, &r.cassette); err != nil {
+			return nil, fmt.Errorf("while reading cassette %s: %w", path, err)
+		}
+
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// Save writes the cassette in ModeRecord, and does nothing in ModeReplay.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	content, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, append(content, '\n'), 0644)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	path := r.ids.scrub(req.URL.Path)
+	reqBody := r.ids.scrub(scrubSecrets(body, false))
+
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Method:       req.Method,
+		Path:         path,
+		RequestBody:  reqBody,
+		Status:       resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ResponseBody: r.ids.scrub(scrubSecrets(respBody, strings.HasSuffix(req.URL.Path, "/randomToken"))),
+	})
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	path := r.ids.scrub(req.URL.Path)
+	reqBody := r.ids.scrub(scrubSecrets(body, false))
+
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Method != req.Method || in.Path != path || !sameBody(in.RequestBody, reqBody) {
+			continue
+		}
+
+		r.used[i] = true
+
+		resp := &http.Response{
+			StatusCode:    in.Status,
+			Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(strings.NewReader(r.ids.unscrub(in.ResponseBody))),
+			ContentLength: -1,
+			Request:       req,
+		}
+
+		if in.ContentType != "" {
+			resp.Header.Set("Content-Type", in.ContentType)
+		}
+
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("cassette %s has no unused interaction for %s %s %s", r.path, req.Method, path, reqBody)
+}
+
+// Unused returns the interactions that have not been replayed.
+func (r *Recorder) Unused() []*Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var res []*Interaction
+	for i, in := range r.cassette.Interactions {
+		if !r.used[i] {
+			res = append(res, in)
+		}
+	}
+
+	return res
+}
+
+// UseCassette sets up a test written against the live Central. It returns
+// the token to create the client with, and a recorder to pass to the client's
+// SetTransport, or nil to talk to Central directly:
+//
+//   - with a token and RecordEnv set, the test runs against Central and is
+//     recorded to CassetteDir/<test name>.json when it passes
+//   - otherwise, if the cassette exists, the test is replayed from it, and
+//     fails if any interaction is left unused
+//   - otherwise, with a token, the test runs against Central unrecorded
+//   - otherwise, the test is skipped
+func UseCassette(t *testing.T) (string, *Recorder) {
+	token := InitTokenFromEnv()
+	path := filepath.Join(CassetteDir, strings.Replace(t.Name(), "/", "_", -1)+".json")
+
+	if token != "" && os.Getenv(RecordEnv) != "" {
+		r, err := NewRecorder(path, ModeRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			if t.Failed() {
+				return
+			}
+
+			if err := r.Save(); err != nil {
+				t.Errorf("while saving cassette: %v", err)
+			}
+		})
+
+		return token, r
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		r, err := NewRecorder(path, ModeReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			for _, in := range r.Unused() {
+				t.Errorf("cassette interaction was not replayed: %s %s", in.Method, in.Path)
+			}
+		})
+
+		return ScrubbedToken, r
+	}
+
+	if token == "" {
+		t.Skipf("This test requires %q be set in the environment, %q exists in the repository root with the token inside, or a cassette at %s; record one with %s=1 and a token (make record-cassettes).", TokenEnv, TokenFile, path, RecordEnv)
+	}
+
+	return token, nil
+}
+
+// secretFields are the JSON fields scrubbed from bodies.
+var secretFields = map[string]bool{
+	"token":         true,
+	"clientSecret":  true,
+	"client_secret": true,
+}
+
+// scrubSecrets replaces secret fields in a JSON body, and "hex" as well in
+// RandomToken responses. Other bodies are returned as they are.
+func scrubSecrets(body []byte, randomToken bool) string {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+
+	if !scrubValue(v, randomToken) {
+		return string(body)
+	}
+
+	res, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+
+	return string(res)
+}
+
+func scrubValue(v interface{}, randomToken bool) bool {
+	var changed bool
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if _, ok := field.(string); ok && (secretFields[k] || (randomToken && k == "hex")) {
+				v[k] = ScrubbedToken
+				changed = true
+				continue
+			}
+
+			changed = scrubValue(field, randomToken) || changed
+		}
+	case []interface{}:
+		for _, item := range v {
+			changed = scrubValue(item, randomToken) || changed
+		}
+	}
+
+	return changed
+}
+
+// sameBody compares bodies as JSON when both are JSON, ignoring formatting.
+func sameBody(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	var av, bv interface{}
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+
+	an, _ := json.Marshal(av)
+	bn, _ := json.Marshal(bv)
+
+	return bytes.Equal(an, bn)
+}
+
+// idKinds are the IDs scrubbed, in the order they are looked for, with the
+// format of their placeholders. IDs must be delimited by quotes, slashes or
+// dashes, so numbers in JSON are left alone, or be followed by a colon, as
+// the node ID at the start of an identity is. Node IDs starting with ff are
+// reserved, so node and controller placeholders start with fe, and remain
+// valid when a test passes them back to the client.
+var idKinds = []struct {
+	name   string
+	re     *regexp.Regexp
+	format string
+}{
+	{"user", idPattern(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "00000000-0000-4000-8000-%012x"},
+	{"network", idPattern(`[0-9a-f]{16}`), "fe%014x"},
+	{"node", idPattern(`[0-9a-f]{10}`), "fe%08x"},
+}
+
+func idPattern(id string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|["/-])(` + id + `)(["/:-]|$)`)
+}
+
+// replaceIDs calls fn for every ID of the kind in text, replacing the ID with
+// its result.
+func replaceIDs(re *regexp.Regexp, text string, fn func(id string) string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		return m[1] + fn(m[2]) + m[3]
+	})
+}
+
+// idScrubber maps IDs to placeholders, numbering them per kind in the order
+// they are first seen.
+type idScrubber struct {
+	forward map[string]string
+	reverse map[string]string
+	counts  map[string]int
+}
+
+func newIDScrubber() *idScrubber {
+	return &idScrubber{forward: map[string]string{}, reverse: map[string]string{}, counts: map[string]int{}}
+}
+
+// scrub replaces IDs with their placeholders, assigning new ones as needed.
+func (s *idScrubber) scrub(text string) string {
+	for _, kind := range idKinds {
+		text = replaceIDs(kind.re, text, func(id string) string {
+			if p, ok := s.forward[id]; ok {
+				return p
+			}
+
+			s.counts[kind.name]++
+			p := fmt.Sprintf(kind.format, s.counts[kind.name])
+			s.forward[id] = p
+			s.reverse[p] = id
+
+			if _, ok := s.forward[p]; !ok {
+				s.forward[p] = p
+			}
+
+			return p
+		})
+	}
+
+	return text
+}
+
+// unscrub replaces placeholders with the IDs they stand for in this run.
+// Placeholders not seen before stand for IDs Central created while recording;
+// they keep their placeholder, which takes the next number as it did then.
+func (s *idScrubber) unscrub(text string) string {
+	for _, kind := range idKinds {
+		text = replaceIDs(kind.re, text, func(p string) string {
+			if id, ok := s.reverse[p]; ok {
+				return id
+			}
+
+			s.counts[kind.name]++
+			s.forward[p] = p
+			s.reverse[p] = p
+
+			return p
+		})
+	}
+
+	return text
+}
@@ -0,0 +1,150 @@
+package testutil_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func stringp(s string) *string {
+	return &s
+}
+
+// recordedScenario is run once while recording and once while replaying,
+// with a different member ID each time.
+func recordedScenario(c *ztcentral.Client, memberID, token string) (string, error) {
+	ctx := context.Background()
+
+	// IDs that Central created while recording are replayed as placeholders,
+	// which must still be valid IDs.
+	networks, err := c.GetNetworks(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(networks) != 1 {
+		return "", fmt.Errorf("expected the existing network, got %d", len(networks))
+	}
+
+	members, err := c.GetMembers(ctx, *networks[0].Id)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := c.GetMember(ctx, *networks[0].Id, *members[0].NodeId); err != nil {
+		return "", err
+	}
+
+	user, err := c.User(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := c.NewNetwork(ctx, "recorded", &spec.Network{})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := c.CreateAuthorizedMember(ctx, *n.Id, memberID, "laptop"); err != nil {
+		return "", err
+	}
+
+	m, err := c.GetMember(ctx, *n.Id, memberID)
+	if err != nil {
+		return "", err
+	}
+
+	if *m.NodeId != memberID || *m.NetworkId != *n.Id {
+		return "", fmt.Errorf("unexpected member %s of %s", *m.NodeId, *m.NetworkId)
+	}
+
+	if err := c.CreateAPIToken(ctx, *user.Id, "ci", token); err != nil {
+		return "", err
+	}
+
+	if _, err := c.GetNetwork(ctx, "8056c2e21cffffff"); !ztcentral.IsNotFound(err) {
+		return "", fmt.Errorf("expected not found, got %v", err)
+	}
+
+	return *n.Id, nil
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassette.json")
+
+	fc := testutil.NewFakeCentral()
+	existing := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*existing.Id, &spec.Member{NodeId: stringp("a1b2c3d4e5"), Config: &spec.MemberConfig{Identity: stringp("a1b2c3d4e5:0:" + strings.Repeat("ab", 64))}})
+
+	c, err := ztcentral.NewClient("live-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := testutil.NewRecorder(path, testutil.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetTransport(rec)
+
+	const secret = "abcdefabcdefabcdefabcdefabcdefab"
+
+	networkID, err := recordedScenario(c, "0123456789", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	fc.Close()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"live-token", secret, networkID, *existing.Id, "0123456789", "a1b2c3d4e5", testutil.FakeUserID} {
+		if strings.Contains(string(content), s) {
+			t.Fatalf("cassette contains %q:\n%s", s, content)
+		}
+	}
+
+	// the fake is gone, so everything is served from the cassette.
+	rec, err = testutil.NewRecorder(path, testutil.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetTransport(rec)
+
+	if _, err := recordedScenario(c, "fedcba9876", "another-token-another-token-1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if unused := rec.Unused(); len(unused) != 0 {
+		t.Fatalf("unused interactions: %+v", unused[0])
+	}
+
+	if _, err := c.GetNetworks(context.Background()); err == nil {
+		t.Fatal("expected an unrecorded request to fail")
+	}
+}
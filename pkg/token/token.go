@@ -0,0 +1,209 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package token resolves API tokens from the sources a profile can name: a
+// literal value, an environment variable, a file, a command or the operating
+// system's keyring.
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNoToken is returned when a source yields no token.
+	ErrNoToken = errors.New("no token")
+	// ErrNoKeyring is returned by keyring sources when DefaultKeyring is not
+	// set.
+	ErrNoKeyring = errors.New("no keyring configured")
+)
+
+// Keyring reads secrets from the operating system's keyring. The library does
+// not ship an implementation; programs set DefaultKeyring to an adapter over
+// the keyring package of their choice.
+type Keyring interface {
+	Get(service, user string) (string, error)
+}
+
+// DefaultKeyring is the keyring used by keyring sources.
+var DefaultKeyring Keyring
+
+// KeyringRef names a secret in the keyring.
+type KeyringRef struct {
+	Service string `yaml:"service"`
+	User    string `yaml:"user"`
+}
+
+// Source says where an API token comes from. Exactly one field should be set.
+// In YAML, a plain string is shorthand for Value.
+type Source struct {
+	// Value is the token itself.
+	Value string `yaml:"value,omitempty"`
+	// Env is an environment variable holding the token.
+	Env string `yaml:"env,omitempty"`
+	// File is a file holding the token; a leading ~/ is the home directory.
+	File string `yaml:"file,omitempty"`
+	// Command is run, without a shell, and its stdout is the token.
+	Command []string `yaml:"command,omitempty"`
+	// Keyring is a secret in DefaultKeyring.
+	Keyring *KeyringRef `yaml:"keyring,omitempty"`
+}
+
+// UnmarshalYAML accepts a plain string as a literal token.
+func (s *Source) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*s = Source{Value: value}
+		return nil
+	}
+
+	type plain Source
+	return unmarshal((*plain)(s))
+}
+
+// Token resolves the token from the process environment.
+func (s Source) Token(ctx context.Context) (string, error) {
+	return s.Resolve(ctx, os.Getenv)
+}
+
+// Resolve resolves the token, reading Env and HOME with getenv, for programs
+// that supply their own environment. Surrounding whitespace is trimmed.
+func (s Source) Resolve(ctx context.Context, getenv func(string) string) (string, error) {
+	var (
+		token string
+		err   error
+		set   int
+	)
+
+	if s.Value != "" {
+		set++
+		token = s.Value
+	}
+
+	if s.Env != "" {
+		set++
+		token = getenv(s.Env)
+	}
+
+	if s.File != "" {
+		set++
+
+		var content []byte
+		if content, err = ioutil.ReadFile(expandHome(s.File, getenv)); err == nil {
+			token = string(content)
+		}
+	}
+
+	if len(s.Command) > 0 {
+		set++
+		token, err = commandToken(ctx, s.Command)
+	}
+
+	if s.Keyring != nil {
+		set++
+
+		if DefaultKeyring == nil {
+			err = ErrNoKeyring
+		} else {
+			token, err = DefaultKeyring.Get(s.Keyring.Service, s.Keyring.User)
+		}
+	}
+
+	switch {
+	case set == 0:
+		return "", fmt.Errorf("%w: token source is empty", ErrNoToken)
+	case set > 1:
+		return "", fmt.Errorf("token source must set exactly one of value, env, file, command and keyring")
+	case err != nil:
+		return "", err
+	}
+
+	if token = strings.TrimSpace(token); token == "" {
+		return "", fmt.Errorf("%w: token source %s yielded an empty token", ErrNoToken, s)
+	}
+
+	return token, nil
+}
+
+// String describes the source without revealing a literal token.
+func (s Source) String() string {
+	switch {
+	case s.Value != "":
+		return "value"
+	case s.Env != "":
+		return "env " + s.Env
+	case s.File != "":
+		return "file " + s.File
+	case len(s.Command) > 0:
+		return "command " + s.Command[0]
+	case s.Keyring != nil:
+		return fmt.Sprintf("keyring %s/%s", s.Keyring.Service, s.Keyring.User)
+	}
+
+	return "empty"
+}
+
+func commandToken(ctx context.Context, argv []string) (string, error) {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("while running %s: %w: %s", argv[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+// expandHome expands a leading ~/ to HOME, or the user's home directory if
+// HOME is unset.
+func expandHome(path string, getenv func(string) string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home := getenv("HOME")
+	if home == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return path
+		}
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package token
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeKeyring map[string]string
+
+func (k fakeKeyring) Get(service, user string) (string, error) {
+	secret, ok := k[service+"/"+user]
+	if !ok {
+		return "", errors.New("secret not found")
+	}
+
+	return secret, nil
+}
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ztcentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "key"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"ZTCENTRAL_TEST_TOKEN": "from-env", "HOME": dir}
+	getenv := func(k string) string { return env[k] }
+
+	DefaultKeyring = fakeKeyring{"zerotier/work": "from-keyring"}
+	defer func() { DefaultKeyring = nil }()
+
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		source Source
+		token  string
+	}{
+		{Source{Value: " literal "}, "literal"},
+		{Source{Env: "ZTCENTRAL_TEST_TOKEN"}, "from-env"},
+		{Source{File: filepath.Join(dir, "key")}, "from-file"},
+		{Source{File: "~/key"}, "from-file"},
+		{Source{Command: []string{"echo", "from-command"}}, "from-command"},
+		{Source{Keyring: &KeyringRef{Service: "zerotier", User: "work"}}, "from-keyring"},
+	} {
+		token, err := test.source.Resolve(ctx, getenv)
+		if err != nil {
+			t.Fatalf("%s: %v", test.source, err)
+		}
+
+		if token != test.token {
+			t.Fatalf("%s: expected %q, got %q", test.source, test.token, token)
+		}
+	}
+
+	for _, source := range []Source{
+		{},
+		{Env: "ZTCENTRAL_TEST_UNSET"},
+		{Value: "a", Env: "ZTCENTRAL_TEST_TOKEN"},
+		{Command: []string{"false"}},
+		{Keyring: &KeyringRef{Service: "zerotier", User: "home"}},
+	} {
+		if _, err := source.Resolve(ctx, getenv); err == nil {
+			t.Fatalf("%s: expected an error", source)
+		}
+	}
+
+	// Token reads the process environment.
+	if _, err := (Source{Env: "ZTCENTRAL_TEST_TOKEN"}).Token(ctx); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("expected ErrNoToken, got %v", err)
+	}
+
+	DefaultKeyring = nil
+	if _, err := (Source{Keyring: &KeyringRef{}}).Resolve(ctx, getenv); !errors.Is(err, ErrNoKeyring) {
+		t.Fatalf("expected ErrNoKeyring, got %v", err)
+	}
+}
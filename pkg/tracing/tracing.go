@@ -0,0 +1,143 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package tracing adapts ztcentral's client observer to OpenTelemetry, with a
+// span per call to Central.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+)
+
+// InstrumentationName names the tracer.
+const InstrumentationName = "github.com/zerotier/go-ztcentral"
+
+// Span attributes besides the HTTP semantic conventions.
+const (
+	NetworkIDKey = attribute.Key("ztcentral.network_id")
+	MemberIDKey  = attribute.Key("ztcentral.member_id")
+	RetriesKey   = attribute.Key("ztcentral.retries")
+	AttemptKey   = attribute.Key("ztcentral.attempt")
+	DelayKey     = attribute.Key("ztcentral.delay_ms")
+)
+
+// Observer is a ztcentral.Observer creating spans named after the operation,
+// such as "GetNetworkMemberList". Retries and rate limit waits are recorded as
+// span events. Only the information in ztcentral.RequestInfo is recorded, so
+// the API token never reaches the exporter.
+type Observer struct {
+	tracer trace.Tracer
+}
+
+// NewObserver creates an observer using the provider, or the global provider
+// if it is nil. Add it to a client with AddObserver.
+func NewObserver(tp trace.TracerProvider) *Observer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Observer{tracer: tp.Tracer(InstrumentationName)}
+}
+
+// OnRequest starts the span.
+func (o *Observer) OnRequest(ctx context.Context, req ztcentral.RequestInfo) context.Context {
+	name := req.Operation
+	if name == "" {
+		name = "Central " + req.Method
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(req.Method),
+		semconv.HTTPTargetKey.String(req.Path),
+	}
+
+	if req.NetworkID != "" {
+		attrs = append(attrs, NetworkIDKey.String(req.NetworkID))
+	}
+
+	if req.MemberID != "" {
+		attrs = append(attrs, MemberIDKey.String(req.MemberID))
+	}
+
+	ctx, _ = o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx
+}
+
+// OnResponse records the outcome and ends the span.
+func (o *Observer) OnResponse(ctx context.Context, req ztcentral.RequestInfo, resp ztcentral.ResponseInfo) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	span.SetAttributes(RetriesKey.Int(resp.Retries))
+
+	switch {
+	case resp.Err != nil:
+		span.RecordError(resp.Err)
+		span.SetStatus(codes.Error, resp.Err.Error())
+	default:
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, fmt.Sprintf("status code %d", resp.StatusCode))
+		}
+	}
+}
+
+// OnRetry adds a "retry" event.
+func (o *Observer) OnRetry(ctx context.Context, req ztcentral.RequestInfo, retry ztcentral.RetryInfo) {
+	attrs := []attribute.KeyValue{
+		AttemptKey.Int(retry.Attempt),
+		DelayKey.Int64(retry.Delay.Milliseconds()),
+	}
+
+	if retry.StatusCode != 0 {
+		attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(retry.StatusCode))
+	}
+
+	if retry.Err != nil {
+		attrs = append(attrs, attribute.String("error", retry.Err.Error()))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attrs...))
+}
+
+// OnRateLimitWait adds a "rate limit wait" event.
+func (o *Observer) OnRateLimitWait(ctx context.Context, req ztcentral.RequestInfo, delay time.Duration) {
+	trace.SpanFromContext(ctx).AddEvent("rate limit wait", trace.WithAttributes(DelayKey.Int64(delay.Milliseconds())))
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	ztcentral "github.com/zerotier/go-ztcentral"
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func stringp(s string) *string {
+	return &s
+}
+
+func TestObserver(t *testing.T) {
+	const token = "secret-token"
+
+	fc := testutil.NewFakeCentral()
+	defer fc.Close()
+
+	c, err := ztcentral.NewClient(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	c.AddObserver(NewObserver(tp))
+
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0123456789")})
+
+	ctx := context.Background()
+
+	if _, err := c.GetMembers(ctx, *n.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetMember(ctx, *n.Id, "0000000bad"); !ztcentral.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	list := spans[0]
+	if list.Name != "GetNetworkMemberList" || list.SpanKind != trace.SpanKindClient {
+		t.Fatalf("unexpected span: %+v", list)
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range list.Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	if attrs[string(NetworkIDKey)] != *n.Id || attrs[string(RetriesKey)] != "0" || attrs["http.status_code"] != "200" {
+		t.Fatalf("unexpected attributes: %v", attrs)
+	}
+
+	get := spans[1]
+	if get.Name != "GetNetworkMember" || get.Status.Code != codes.Error {
+		t.Fatalf("unexpected span: %+v", get)
+	}
+
+	for _, span := range spans {
+		for _, kv := range span.Attributes {
+			if strings.Contains(kv.Value.Emit(), token) {
+				t.Fatalf("span %s recorded the token in %s", span.Name, kv.Key)
+			}
+		}
+	}
+}
+
+func TestObserverRetry(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	o := NewObserver(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	req := ztcentral.RequestInfo{Operation: "GetNetworkList", Method: http.MethodGet, Path: "/network"}
+
+	ctx := o.OnRequest(context.Background(), req)
+	o.OnRetry(ctx, req, ztcentral.RetryInfo{Attempt: 1, StatusCode: http.StatusBadGateway, Delay: time.Second})
+	o.OnResponse(ctx, req, ztcentral.ResponseInfo{StatusCode: http.StatusOK, Retries: 1})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || len(spans[0].Events) != 1 || spans[0].Events[0].Name != "retry" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range spans[0].Events[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	if attrs[string(AttemptKey)] != "1" || attrs[string(DelayKey)] != "1000" || attrs["http.status_code"] != "502" {
+		t.Fatalf("unexpected retry event: %v", attrs)
+	}
+}
+
+// retryingTransport retries a request once if it gets a 502, reporting the
+// retry to the client.
+type retryingTransport struct {
+	c *ztcentral.Client
+}
+
+func (rt *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	rt.c.NotifyRetry(req.Context(), ztcentral.RequestInfo{}, ztcentral.RetryInfo{Attempt: 1, StatusCode: resp.StatusCode})
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNotifyRetry(t *testing.T) {
+	fc := testutil.NewFakeCentral()
+	defer fc.Close()
+
+	failed := false
+	fc.Fail = func(r *http.Request) int {
+		if failed {
+			return 0
+		}
+
+		failed = true
+		return http.StatusBadGateway
+	}
+
+	c, err := ztcentral.NewClient("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.SetBaseURL(fc.BaseURL()); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	c.AddObserver(NewObserver(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	c.SetTransport(&retryingTransport{c: c})
+
+	if _, err := c.GetNetworks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || len(spans[0].Events) != 1 || spans[0].Events[0].Name != "retry" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range spans[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	if spans[0].Name != "GetNetworkList" || attrs[string(RetriesKey)] != "1" || attrs["http.status_code"] != "200" {
+		t.Fatalf("unexpected span %s: %v", spans[0].Name, attrs)
+	}
+}
@@ -0,0 +1,598 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// PolicyAction is what the policy engine does with a pending member.
+type PolicyAction string
+
+const (
+	// ActionNone leaves the member pending.
+	ActionNone PolicyAction = ""
+	// ActionAuthorize authorizes the member.
+	ActionAuthorize PolicyAction = "authorize"
+	// ActionDelete deletes the member from the network.
+	ActionDelete PolicyAction = "delete"
+)
+
+// AuthPolicy is a declarative auto-authorization policy, usually loaded from
+// JSON with ParseAuthPolicy. Rules are evaluated in order and the first match
+// decides; members that match no rule get DefaultAction.
+type AuthPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+	// DefaultAction applies to members no rule matches. It defaults to leaving
+	// them pending.
+	DefaultAction PolicyAction `json:"defaultAction,omitempty"`
+	// VerifyIdentity requires members to pass VerifyMemberIdentity before any
+	// rule can authorize them. Members that fail are left pending.
+	VerifyIdentity bool `json:"verifyIdentity,omitempty"`
+
+	compiled bool
+}
+
+// PolicyRule matches pending members. Every condition that is set must match;
+// a rule with no conditions matches everything.
+type PolicyRule struct {
+	Name   string       `json:"name"`
+	Action PolicyAction `json:"action"`
+
+	// Identities is an allowlist of public identities.
+	Identities []string `json:"identities,omitempty"`
+	// NodeIDs is an allowlist of node IDs.
+	NodeIDs []string `json:"nodeIds,omitempty"`
+	// PhysicalCIDRs matches the address the member last contacted the
+	// controller from.
+	PhysicalCIDRs []string `json:"physicalCidrs,omitempty"`
+	// MinClientVersion is the oldest client version allowed, e.g. "1.10.0".
+	MinClientVersion string `json:"minClientVersion,omitempty"`
+	// NamePattern is a path.Match pattern matched against the member name.
+	NamePattern string `json:"namePattern,omitempty"`
+	// Window restricts the rule to a time of day and days of the week.
+	Window *TimeWindow `json:"window,omitempty"`
+
+	// AssignName names authorized members. "{nodeId}" is replaced with the
+	// member's node ID.
+	AssignName string `json:"assignName,omitempty"`
+	// AssignTags sets [id, value] tags on authorized members.
+	AssignTags [][2]int `json:"assignTags,omitempty"`
+	// AssignIPs sets the IP assignments of authorized members. As every
+	// member the rule matches would get the same addresses, it is only allowed
+	// on rules that match a single node ID or identity.
+	AssignIPs []string `json:"assignIps,omitempty"`
+
+	physical   []*net.IPNet
+	minVersion *ClientVersion
+	identities map[string]bool
+	nodeIDs    map[NodeID]bool
+}
+
+// TimeWindow is a daily window of time, such as business hours. If Start is
+// after End the window spans midnight.
+type TimeWindow struct {
+	// Start and End are "15:04" times. End is exclusive.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days limits the window to days of the week ("mon", "tue", ...). Empty
+	// means every day.
+	Days []string `json:"days,omitempty"`
+	// Location is an IANA time zone; it defaults to UTC.
+	Location string `json:"location,omitempty"`
+
+	start, end time.Duration
+	days       map[time.Weekday]bool
+	location   *time.Location
+}
+
+// ParseAuthPolicy parses and compiles a JSON policy. Unknown fields are
+// rejected, so typos don't silently widen a rule.
+func ParseAuthPolicy(r io.Reader) (*AuthPolicy, error) {
+	p := &AuthPolicy{}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("while parsing auth policy: %w", err)
+	}
+
+	return p, p.Compile()
+}
+
+// ErrPolicyNotCompiled is returned when an AuthPolicy is used before Compile
+// succeeded on it.
+var ErrPolicyNotCompiled = errors.New("auth policy is not compiled")
+
+// Compile validates the policy and prepares it for evaluation. It must be
+// called on policies that were not created with ParseAuthPolicy, and again
+// after changing a policy's rules.
+func (p *AuthPolicy) Compile() error {
+	p.compiled = false
+
+	if err := validAction(p.DefaultAction); err != nil {
+		return fmt.Errorf("defaultAction: %w", err)
+	}
+
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return fmt.Errorf("rule %d (%q): %w", i, p.Rules[i].Name, err)
+		}
+	}
+
+	p.compiled = true
+	return nil
+}
+
+func validAction(a PolicyAction) error {
+	switch a {
+	case ActionNone, ActionAuthorize, ActionDelete:
+		return nil
+	}
+
+	return fmt.Errorf("unknown action %q", a)
+}
+
+func (r *PolicyRule) compile() error {
+	if err := validAction(r.Action); err != nil {
+		return err
+	}
+
+	r.identities = map[string]bool{}
+	for _, s := range r.Identities {
+		id, err := ParseIdentity(s)
+		if err != nil {
+			return err
+		}
+
+		r.identities[id.String()] = true
+	}
+
+	r.nodeIDs = map[NodeID]bool{}
+	for _, s := range r.NodeIDs {
+		id, err := ParseNodeID(s)
+		if err != nil {
+			return err
+		}
+
+		r.nodeIDs[id] = true
+	}
+
+	r.physical = nil
+	for _, s := range r.PhysicalCIDRs {
+		_, cidr, err := net.ParseCIDR(s)
+		if err != nil {
+			return err
+		}
+
+		r.physical = append(r.physical, cidr)
+	}
+
+	r.minVersion = nil
+	if r.MinClientVersion != "" {
+		v, err := ParseClientVersion(r.MinClientVersion)
+		if err != nil {
+			return err
+		}
+
+		r.minVersion = &v
+	}
+
+	if _, err := path.Match(r.NamePattern, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", r.NamePattern, err)
+	}
+
+	if len(r.AssignIPs) > 0 && len(r.NodeIDs) != 1 && len(r.Identities) != 1 {
+		return errors.New("assignIps requires the rule to match exactly one node ID or identity")
+	}
+
+	for _, ip := range r.AssignIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("%q is not an IP address", ip)
+		}
+	}
+
+	if r.Window != nil {
+		return r.Window.compile()
+	}
+
+	return nil
+}
+
+func (w *TimeWindow) compile() error {
+	var err error
+
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+
+	w.location = time.UTC
+	if w.Location != "" {
+		if w.location, err = time.LoadLocation(w.Location); err != nil {
+			return err
+		}
+	}
+
+	w.days = map[time.Weekday]bool{}
+	for _, day := range w.Days {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(day, d.String()[:3]) || strings.EqualFold(day, d.String()) {
+				w.days[d] = true
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown day %q", day)
+		}
+	}
+
+	return nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t is inside the window.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	day := t.Weekday()
+	var inside bool
+
+	if w.start <= w.end {
+		inside = since >= w.start && since < w.end
+	} else {
+		inside = since >= w.start || since < w.end
+		// the early morning part of an overnight window belongs to the
+		// previous day's window.
+		if since < w.end {
+			day = (day + 6) % 7
+		}
+	}
+
+	return inside && (len(w.days) == 0 || w.days[day])
+}
+
+// match returns why the member matches the rule, or false.
+func (r *PolicyRule) match(m *spec.Member, now time.Time) (string, bool) {
+	var reasons []string
+
+	if len(r.identities) > 0 {
+		if m.Config == nil || m.Config.Identity == nil {
+			return "", false
+		}
+
+		id, err := ParseIdentity(*m.Config.Identity)
+		if err != nil || !r.identities[id.String()] {
+			return "", false
+		}
+
+		reasons = append(reasons, "identity allowlisted")
+	}
+
+	if len(r.nodeIDs) > 0 {
+		id, err := ParseNodeID(stringv(m.NodeId))
+		if err != nil || !r.nodeIDs[id] {
+			return "", false
+		}
+
+		reasons = append(reasons, "node ID allowlisted")
+	}
+
+	if len(r.physical) > 0 {
+		ip := physicalIP(stringv(m.PhysicalAddress))
+		if ip == nil {
+			return "", false
+		}
+
+		matched := false
+		for _, cidr := range r.physical {
+			if cidr.Contains(ip) {
+				reasons = append(reasons, fmt.Sprintf("physical address %s in %s", ip, cidr))
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return "", false
+		}
+	}
+
+	if r.minVersion != nil {
+		v, ok := MemberClientVersion(m)
+		if !ok || v.Compare(*r.minVersion) < 0 {
+			return "", false
+		}
+
+		reasons = append(reasons, fmt.Sprintf("client version %s >= %s", v, r.minVersion))
+	}
+
+	if r.NamePattern != "" {
+		if ok, _ := path.Match(r.NamePattern, stringv(m.Name)); !ok {
+			return "", false
+		}
+
+		reasons = append(reasons, fmt.Sprintf("name matches %q", r.NamePattern))
+	}
+
+	if r.Window != nil {
+		if !r.Window.Contains(now) {
+			return "", false
+		}
+
+		reasons = append(reasons, "inside time window")
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "rule has no conditions")
+	}
+
+	return strings.Join(reasons, ", "), true
+}
+
+// physicalIP parses Central's physical address, which carries the port as
+// "ip/port".
+func physicalIP(s string) net.IP {
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+
+	return net.ParseIP(s)
+}
+
+// PolicyDecision is the outcome of evaluating a member against a policy.
+type PolicyDecision struct {
+	Time      time.Time    `json:"time"`
+	NetworkID string       `json:"networkId"`
+	NodeID    string       `json:"nodeId"`
+	Action    PolicyAction `json:"action"`
+	// Rule is the name of the matching rule, empty if none matched.
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason"`
+	// DryRun is set when the action was decided but not applied.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Error is set if applying the action failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Evaluate decides what to do with a pending member at the given time. It does
+// not contact Central. Members are left pending if the policy has not been
+// compiled, as its rules' conditions are not ready to be checked.
+func (p *AuthPolicy) Evaluate(m *spec.Member, now time.Time) PolicyDecision {
+	d, _ := p.evaluate(m, now)
+	return d
+}
+
+// evaluate also returns the matching rule, if any.
+func (p *AuthPolicy) evaluate(m *spec.Member, now time.Time) (PolicyDecision, *PolicyRule) {
+	d := PolicyDecision{
+		Time:      now,
+		NetworkID: stringv(m.NetworkId),
+		NodeID:    stringv(m.NodeId),
+	}
+
+	if !p.compiled {
+		d.Reason = ErrPolicyNotCompiled.Error()
+		return d, nil
+	}
+
+	var identityErr error
+	if p.VerifyIdentity {
+		identityErr = VerifyMemberIdentity(m)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+
+		reason, ok := r.match(m, now)
+		if !ok {
+			continue
+		}
+
+		d.Rule = r.Name
+		d.Action = r.Action
+		d.Reason = reason
+
+		if d.Action == ActionAuthorize && identityErr != nil {
+			d.Action = ActionNone
+			d.Reason = fmt.Sprintf("identity verification failed: %v", identityErr)
+		}
+
+		return d, r
+	}
+
+	d.Action = p.DefaultAction
+	d.Reason = "no rule matched"
+
+	if d.Action == ActionAuthorize && identityErr != nil {
+		d.Action = ActionNone
+		d.Reason = fmt.Sprintf("no rule matched; identity verification failed: %v", identityErr)
+	}
+
+	return d, nil
+}
+
+// AuditSink receives every decision the policy engine makes.
+type AuditSink interface {
+	Record(d PolicyDecision) error
+}
+
+// JSONAuditSink writes decisions to a writer as JSON, one per line.
+type JSONAuditSink struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+}
+
+// NewJSONAuditSink returns a sink writing to w.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{enc: json.NewEncoder(w)}
+}
+
+// Record implements AuditSink.
+func (s *JSONAuditSink) Record(d PolicyDecision) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.enc.Encode(d)
+}
+
+// PolicyEngine applies an AuthPolicy to the pending members of networks.
+type PolicyEngine struct {
+	client *Client
+	policy *AuthPolicy
+	sink   AuditSink
+
+	// DryRun records decisions without applying them.
+	DryRun bool
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewPolicyEngine compiles the policy and creates an engine for it. sink may
+// be nil, in which case decisions are only returned from Run.
+func NewPolicyEngine(c *Client, p *AuthPolicy, sink AuditSink) (*PolicyEngine, error) {
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+
+	return &PolicyEngine{client: c, policy: p, sink: sink, Now: time.Now}, nil
+}
+
+// PendingMembers returns the members waiting for authorization: members that
+// are not authorized and have never been deauthorized. Members that were
+// deauthorized were removed on purpose, and are never considered pending.
+func PendingMembers(members []*spec.Member) []*spec.Member {
+	return FilterMembers(members, IsAuthorized(false), func(m *spec.Member) bool {
+		_, deauthorized := msTime(m.Config.LastDeauthorizedTime)
+		return !deauthorized
+	})
+}
+
+// Run evaluates every pending member of the network and applies the decisions.
+// Each decision is sent to the audit sink and returned. Failures to apply a
+// decision are recorded in the decision rather than stopping the run; an
+// error is returned only if the members could not be listed or the audit sink
+// failed.
+func (e *PolicyEngine) Run(ctx context.Context, networkID string) ([]PolicyDecision, error) {
+	if !e.policy.compiled {
+		return nil, ErrPolicyNotCompiled
+	}
+
+	members, err := e.client.GetMembers(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	var decisions []PolicyDecision
+
+	for _, m := range PendingMembers(members) {
+		if err := ctx.Err(); err != nil {
+			return decisions, err
+		}
+
+		d, rule := e.policy.evaluate(m, e.Now())
+		d.NetworkID = networkID
+		d.DryRun = e.DryRun
+
+		if !e.DryRun {
+			if err := e.apply(ctx, networkID, rule, d); err != nil {
+				d.Error = err.Error()
+			}
+		}
+
+		decisions = append(decisions, d)
+
+		if e.sink != nil {
+			if err := e.sink.Record(d); err != nil {
+				return decisions, fmt.Errorf("while recording decision for %q: %w", d.NodeID, err)
+			}
+		}
+	}
+
+	return decisions, nil
+}
+
+func (e *PolicyEngine) apply(ctx context.Context, networkID string, r *PolicyRule, d PolicyDecision) error {
+	switch d.Action {
+	case ActionAuthorize:
+		update := &spec.Member{Config: &spec.MemberConfig{Authorized: boolp(true)}}
+
+		if r != nil {
+			if r.AssignName != "" {
+				update.Name = stringp(strings.ReplaceAll(r.AssignName, "{nodeId}", d.NodeID))
+			}
+
+			if len(r.AssignTags) > 0 {
+				tags := [][]interface{}{}
+				for _, tag := range r.AssignTags {
+					tags = append(tags, []interface{}{tag[0], tag[1]})
+				}
+
+				update.Config.Tags = &tags
+			}
+
+			if len(r.AssignIPs) > 0 {
+				ips := append([]string{}, r.AssignIPs...)
+				update.Config.IpAssignments = &ips
+			}
+		}
+
+		_, err := e.client.UpdateMember(ctx, networkID, d.NodeID, update)
+		return err
+	case ActionDelete:
+		return e.client.DeleteMember(ctx, networkID, d.NodeID)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+	"github.com/zerotier/go-ztidentity"
+)
+
+const testPolicy = `{
+	"verifyIdentity": true,
+	"rules": [
+		{
+			"name": "servers",
+			"action": "authorize",
+			"nodeIds": ["%SERVER%"],
+			"assignName": "server-{nodeId}",
+			"assignTags": [[100, 1]],
+			"assignIps": ["10.0.0.10"]
+		},
+		{
+			"name": "office",
+			"action": "authorize",
+			"physicalCidrs": ["192.0.2.0/24"],
+			"minClientVersion": "1.10.0",
+			"window": {"start": "09:00", "end": "17:00", "days": ["mon", "tue", "wed", "thu", "fri"]}
+		},
+		{
+			"name": "ci",
+			"action": "delete",
+			"namePattern": "ci-*"
+		}
+	]
+}`
+
+func TestPolicyEngine(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+
+	server := ztidentity.NewZeroTierIdentity()
+	laptop := ztidentity.NewZeroTierIdentity()
+	forged := ztidentity.NewZeroTierIdentity()
+	other := ztidentity.NewZeroTierIdentity()
+
+	policy, err := ParseAuthPolicy(strings.NewReader(strings.Replace(testPolicy, "%SERVER%", server.IDString(), 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(id ztidentity.ZeroTierIdentity, identity string, m *spec.Member) {
+		m.NodeId = stringp(id.IDString())
+		m.Config = &spec.MemberConfig{Identity: &identity}
+		fc.AddMember(*n.Id, m)
+	}
+
+	add(server, server.PublicKeyString(), &spec.Member{})
+	add(laptop, laptop.PublicKeyString(), &spec.Member{
+		PhysicalAddress: stringp("192.0.2.7/9993"),
+		ClientVersion:   stringp("1.12.1"),
+	})
+	add(forged, other.PublicKeyString(), &spec.Member{
+		PhysicalAddress: stringp("192.0.2.8/9993"),
+		ClientVersion:   stringp("1.12.1"),
+	})
+	add(other, other.PublicKeyString(), &spec.Member{Name: stringp("ci-runner-17")})
+
+	deauthorized := ztidentity.NewZeroTierIdentity()
+	add(deauthorized, deauthorized.PublicKeyString(), &spec.Member{})
+	fc.EditMember(*n.Id, deauthorized.IDString(), func(m *spec.Member) {
+		m.Config.LastDeauthorizedTime = int64p(1)
+	})
+
+	audit := &bytes.Buffer{}
+	engine, err := NewPolicyEngine(c, policy, NewJSONAuditSink(audit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a Wednesday afternoon
+	engine.Now = func() time.Time { return time.Date(2024, 8, 7, 13, 0, 0, 0, time.UTC) }
+
+	decisions, err := engine.Run(context.Background(), *n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]PolicyAction{
+		server.IDString(): ActionAuthorize,
+		laptop.IDString(): ActionAuthorize,
+		forged.IDString(): ActionNone,
+		other.IDString():  ActionDelete,
+	}
+
+	if len(decisions) != len(expected) {
+		t.Fatalf("unexpected decisions: %+v", decisions)
+	}
+
+	for _, d := range decisions {
+		if action, ok := expected[d.NodeID]; !ok || action != d.Action || d.Error != "" {
+			t.Fatalf("unexpected decision: %+v", d)
+		}
+	}
+
+	m := fc.Member(*n.Id, server.IDString())
+	if !*m.Config.Authorized || *m.Name != "server-"+server.IDString() || (*m.Config.IpAssignments)[0] != "10.0.0.10" {
+		t.Fatalf("server was not authorized with its assignments: %+v", m)
+	}
+
+	if tags := *m.Config.Tags; len(tags) != 1 || tags[0][0].(float64) != 100 {
+		t.Fatalf("unexpected tags: %+v", tags)
+	}
+
+	if !*fc.Member(*n.Id, laptop.IDString()).Config.Authorized {
+		t.Fatal("laptop was not authorized")
+	}
+
+	if *fc.Member(*n.Id, forged.IDString()).Config.Authorized {
+		t.Fatal("member with a forged identity was authorized")
+	}
+
+	if fc.Member(*n.Id, other.IDString()) != nil {
+		t.Fatal("ci runner was not deleted")
+	}
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != len(decisions) {
+		t.Fatalf("expected %d audit records, got %d", len(decisions), len(lines))
+	}
+
+	var d PolicyDecision
+	if err := json.Unmarshal([]byte(lines[0]), &d); err != nil || d.Reason == "" {
+		t.Fatalf("invalid audit record %q: %v", lines[0], err)
+	}
+}
+
+func TestUncompiledPolicy(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001")})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002")})
+
+	// built in Go, so the allowlist is only in the exported fields.
+	policy := &AuthPolicy{Rules: []PolicyRule{
+		{Name: "servers", Action: ActionAuthorize, NodeIDs: []string{"0000000001"}},
+	}}
+
+	if d := policy.Evaluate(fc.Member(*n.Id, "0000000002"), time.Now()); d.Action != ActionNone {
+		t.Fatalf("uncompiled policy decided %+v", d)
+	}
+
+	engine, err := NewPolicyEngine(c, policy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decisions, err := engine.Run(context.Background(), *n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decisions) != 2 {
+		t.Fatalf("unexpected decisions: %+v", decisions)
+	}
+
+	if *fc.Member(*n.Id, "0000000002").Config.Authorized || !*fc.Member(*n.Id, "0000000001").Config.Authorized {
+		t.Fatal("the node ID allowlist was not applied")
+	}
+
+	if _, err := NewPolicyEngine(c, &AuthPolicy{Rules: []PolicyRule{{Action: "approve"}}}, nil); err == nil {
+		t.Fatal("invalid policy was accepted")
+	}
+
+	if _, err := (&PolicyEngine{client: c, policy: &AuthPolicy{}}).Run(context.Background(), *n.Id); !errors.Is(err, ErrPolicyNotCompiled) {
+		t.Fatalf("expected ErrPolicyNotCompiled, got %v", err)
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	w := &TimeWindow{Start: "22:00", End: "06:00", Days: []string{"friday"}}
+	if err := w.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	table := map[time.Time]bool{
+		time.Date(2024, 8, 9, 23, 0, 0, 0, time.UTC):  true,  // friday night
+		time.Date(2024, 8, 10, 5, 59, 0, 0, time.UTC): true,  // saturday morning, friday's window
+		time.Date(2024, 8, 10, 6, 0, 0, 0, time.UTC):  false, // end is exclusive
+		time.Date(2024, 8, 9, 5, 0, 0, 0, time.UTC):   false, // thursday's window
+		time.Date(2024, 8, 9, 12, 0, 0, 0, time.UTC):  false,
+	}
+
+	for when, inside := range table {
+		if w.Contains(when) != inside {
+			t.Fatalf("%v: expected %v", when, inside)
+		}
+	}
+}
+
+func TestParseAuthPolicyErrors(t *testing.T) {
+	for _, bad := range []string{
+		`{"rules": [{"action": "approve"}]}`,
+		`{"rules": [{"action": "authorize", "nodeIds": ["xyz"]}]}`,
+		`{"rules": [{"action": "authorize", "physicalCidrs": ["10.0.0.0"]}]}`,
+		`{"rules": [{"action": "authorize", "window": {"start": "9am", "end": "17:00"}}]}`,
+		`{"rules": [{"action": "authorize", "window": {"start": "09:00", "end": "17:00", "days": ["caturday"]}}]}`,
+		`{"rules": [{"action": "authorize", "nodeID": ["0123456789"]}]}`,
+		`{"rules": [{"action": "authorize", "physicalCidrs": ["10.0.0.0/8"], "assignIps": ["10.0.0.10"]}]}`,
+		`{"rules": [{"action": "authorize", "nodeIds": ["0123456789", "0123456788"], "assignIps": ["10.0.0.10"]}]}`,
+	} {
+		if _, err := ParseAuthPolicy(strings.NewReader(bad)); err == nil {
+			t.Fatalf("policy parsed: %s", bad)
+		}
+	}
+}
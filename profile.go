@@ -0,0 +1,212 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/zerotier/go-ztcentral/pkg/token"
+)
+
+// ProfileEnv names the profile NewClientFromProfile uses when given no name.
+const ProfileEnv = "ZTCENTRAL_PROFILE"
+
+// ErrNoProfile is returned when the requested profile is not configured.
+var ErrNoProfile = errors.New("profile not found")
+
+// ProfileDefaults are defaults for programs using a profile.
+type ProfileDefaults struct {
+	// Network is the network to act on when none is given.
+	Network string `yaml:"network,omitempty"`
+	// Output is the preferred output format, such as "json".
+	Output string `yaml:"output,omitempty"`
+}
+
+// Profile is a named set of client settings.
+type Profile struct {
+	// URL is the Central API; it defaults to BaseURLV1.
+	URL   string       `yaml:"url,omitempty"`
+	Token token.Source `yaml:"token"`
+	// UserAgent is appended to the client's user agent, see SetUserAgent.
+	UserAgent string `yaml:"userAgent,omitempty"`
+	// ValidateNetworks enables SetNetworkValidation.
+	ValidateNetworks bool            `yaml:"validateNetworks,omitempty"`
+	Defaults         ProfileDefaults `yaml:"defaults,omitempty"`
+}
+
+// NewClient creates a client from the profile, resolving its token.
+func (p *Profile) NewClient(ctx context.Context) (*Client, error) {
+	key, err := p.Token.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.URL != "" {
+		if err := c.SetBaseURL(p.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.UserAgent != "" {
+		c.SetUserAgent(p.UserAgent)
+	}
+
+	c.SetNetworkValidation(p.ValidateNetworks)
+
+	return c, nil
+}
+
+// Config is the profile configuration file:
+//
+//	default: work
+//	profiles:
+//	  work:
+//	    token:
+//	      command: [pass, show, zerotier/work]
+//	    defaults:
+//	      network: 8056c2e21c000001
+//	  lab:
+//	    url: https://central.example.com/api
+//	    token:
+//	      env: LAB_ZT_TOKEN
+type Config struct {
+	// Default is the profile used when none is named.
+	Default  string              `yaml:"default,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// DefaultConfigPath is config.yaml in the ztcentral directory of the user's
+// config directory, e.g. ~/.config/ztcentral/config.yaml.
+func DefaultConfigPath() string {
+	return ConfigPath(os.Getenv)
+}
+
+// ConfigPath is DefaultConfigPath, reading XDG_CONFIG_HOME and HOME with
+// getenv, for programs that supply their own environment.
+func ConfigPath(getenv func(string) string) string {
+	dir := getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			home = expandHome("~")
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "ztcentral", "config.yaml")
+}
+
+// LoadConfig reads a config file. Unknown fields are errors, so typos don't
+// silently drop settings.
+func LoadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Profile returns the named profile. An empty name is the config's default.
+func (cfg *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = cfg.Default
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoProfile, name)
+	}
+
+	return p, nil
+}
+
+// SelectProfile returns the named profile. An empty name is the profile named
+// by ProfileEnv, looked up with getenv, or failing that the config's default.
+func (cfg *Config) SelectProfile(name string, getenv func(string) string) (*Profile, error) {
+	if name == "" {
+		name = getenv(ProfileEnv)
+	}
+
+	return cfg.Profile(name)
+}
+
+// NewClientFromProfile creates a client from a profile in the file at
+// DefaultConfigPath. An empty name selects the profile as Config.SelectProfile
+// does with the process environment.
+func NewClientFromProfile(name string) (*Client, error) {
+	path := DefaultConfigPath()
+
+	cfg, err := LoadConfig(path)
+	if os.IsNotExist(err) {
+		// unwrapped, so callers can tell that nothing is configured.
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", path, err)
+	}
+
+	p, err := cfg.SelectProfile(name, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.NewClient(context.Background())
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zerotier/go-ztcentral/pkg/testutil"
+)
+
+func TestNewClientFromProfile(t *testing.T) {
+	fc := testutil.NewFakeCentral()
+	defer fc.Close()
+	fc.Token = "work-token"
+
+	dir, err := ioutil.TempDir("", "ztcentral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	if _, err := NewClientFromProfile(""); !os.IsNotExist(err) {
+		t.Fatalf("expected a missing config error, got %v", err)
+	}
+
+	content := `default: work
+profiles:
+  work:
+    url: ` + fc.BaseURL() + `
+    token: work-token
+    defaults:
+      network: 8056c2e21c000001
+  home:
+    url: ` + fc.BaseURL() + `
+    token:
+      value: wrong
+`
+
+	path := DefaultConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := cfg.Profile("work"); err != nil || p.Defaults.Network != "8056c2e21c000001" {
+		t.Fatalf("unexpected profile %+v: %v", p, err)
+	}
+
+	if _, err := cfg.Profile("lab"); !errors.Is(err, ErrNoProfile) {
+		t.Fatalf("expected ErrNoProfile, got %v", err)
+	}
+
+	env := map[string]string{ProfileEnv: "home", "HOME": "/home/someone"}
+	getenv := func(k string) string { return env[k] }
+
+	if p, err := cfg.SelectProfile("", getenv); err != nil || p.Token.Value != "wrong" {
+		t.Fatalf("expected the home profile, got %+v: %v", p, err)
+	}
+
+	if p, err := cfg.SelectProfile("work", getenv); err != nil || p.Token.Value != "work-token" {
+		t.Fatalf("expected the work profile, got %+v: %v", p, err)
+	}
+
+	if path := ConfigPath(getenv); path != "/home/someone/.config/ztcentral/config.yaml" {
+		t.Fatalf("unexpected config path %s", path)
+	}
+
+	ctx := context.Background()
+
+	c, err := NewClientFromProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(ProfileEnv, "home")
+	defer os.Unsetenv(ProfileEnv)
+
+	c, err = NewClientFromProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Status(ctx); err == nil {
+		t.Fatal("expected the home profile's wrong token to be rejected")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("profiles:\n  work:\n    tokn: x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewClientFromProfile("work"); err == nil {
+		t.Fatal("expected an unknown field to be rejected")
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultMaxDeletions is the deletion cap used when PrunePolicy.MaxDeletions
+// is zero.
+const DefaultMaxDeletions = 10
+
+// ErrPruneLimit is returned when a prune would delete more members than the
+// policy allows. Nothing is deleted in that case.
+var ErrPruneLimit = errors.New("prune exceeds the maximum number of deletions")
+
+// PrunePolicy describes which stale members PruneMembers removes.
+type PrunePolicy struct {
+	// DeauthorizeAfter deauthorizes authorized members that have not been
+	// online for this long. Zero disables deauthorization.
+	DeauthorizeAfter time.Duration
+	// DeleteAfter deletes unauthorized members that were deauthorized this
+	// long ago. Zero disables deletion.
+	DeleteAfter time.Duration
+	// DeletePending also deletes members that were never deauthorized, such
+	// as members still waiting to be authorized, once they were created
+	// DeleteAfter ago.
+	DeletePending bool
+	// MaxDeletions caps the number of deletions in one run. If more members
+	// qualify, nothing is deleted and ErrPruneLimit is returned. Zero means
+	// DefaultMaxDeletions; negative means no limit.
+	MaxDeletions int
+	// KeepTag is the name of a tag (from the network's TagsByName); members
+	// with the tag set to any value are never touched.
+	KeepTag string
+	// Keep, if set, protects any member it passes.
+	Keep MemberFilter
+	// DryRun plans the prune without changing anything.
+	DryRun bool
+}
+
+// PruneAction is what PruneMembers did, or would do, to a member.
+type PruneAction string
+
+const (
+	// PruneDeauthorize deauthorizes a member.
+	PruneDeauthorize PruneAction = "deauthorize"
+	// PruneDelete deletes a member.
+	PruneDelete PruneAction = "delete"
+	// PruneSkip is reported for members that would have been pruned, but were
+	// protected or had too little information to act on safely.
+	PruneSkip PruneAction = "skip"
+)
+
+// PruneResult is the outcome of pruning a single member.
+type PruneResult struct {
+	NodeID string
+	Name   string
+	Action PruneAction
+	Reason string
+	// Applied is set once the action was carried out.
+	Applied bool
+	Err     error
+}
+
+// PruneReport is the outcome of PruneMembers.
+type PruneReport struct {
+	NetworkID string
+	DryRun    bool
+	Results   []PruneResult
+}
+
+// Count returns the number of results with the action.
+func (r *PruneReport) Count(action PruneAction) int {
+	var count int
+	for _, res := range r.Results {
+		if res.Action == action {
+			count++
+		}
+	}
+
+	return count
+}
+
+// WriteTo writes a human readable table of the report, suitable for reviewing
+// a dry run.
+func (r *PruneReport) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 8, 2, ' ', 0)
+
+	mode := ""
+	if r.DryRun {
+		mode = " (dry run)"
+	}
+
+	fmt.Fprintf(tw, "prune of network %s%s: %d to deauthorize, %d to delete, %d skipped\n",
+		r.NetworkID, mode, r.Count(PruneDeauthorize), r.Count(PruneDelete), r.Count(PruneSkip))
+
+	for _, res := range r.Results {
+		status := "planned"
+		if res.Err != nil {
+			status = "failed: " + res.Err.Error()
+		} else if res.Applied {
+			status = "done"
+		} else if res.Action == PruneSkip {
+			status = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.NodeID, res.Name, res.Action, res.Reason, status)
+	}
+
+	return cw.result(tw.Flush())
+}
+
+// countWriter counts the bytes written to w, and keeps the first error, after
+// which nothing more is written.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// result is the count and the first error, or the error of the last flush
+// through the writer.
+func (cw *countWriter) result(err error) (int64, error) {
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+
+	return cw.n, err
+}
+
+// PlanPrune decides what to do with each member at the given time without
+// contacting Central. The network is used to resolve the policy's KeepTag.
+//
+// Central warns that LastOnline and LastSeen may be reset to 0, so members
+// with no activity timestamps at all are skipped rather than treated as
+// stale, and members are never deauthorized less than DeauthorizeAfter after
+// they were authorized.
+func PlanPrune(n *spec.Network, members []*spec.Member, policy PrunePolicy, now time.Time) ([]PruneResult, error) {
+	keep := policy.Keep
+	if policy.KeepTag != "" {
+		tag, ok := lookupByName(n, func(n *spec.Network) *map[string]interface{} { return n.TagsByName }, policy.KeepTag)
+		if !ok {
+			return nil, fmt.Errorf("network has no tag named %q", policy.KeepTag)
+		}
+
+		id, ok := numberv(tag["id"])
+		if !ok {
+			return nil, fmt.Errorf("tag %q has no id", policy.KeepTag)
+		}
+
+		tagged := func(m *spec.Member) bool {
+			_, ok := memberTag(m, id)
+			return ok
+		}
+
+		if keep != nil {
+			keep = AnyOf(keep, tagged)
+		} else {
+			keep = tagged
+		}
+	}
+
+	var results []PruneResult
+
+	for _, m := range members {
+		if m.Config == nil {
+			continue
+		}
+
+		res := PruneResult{NodeID: stringv(m.NodeId), Name: stringv(m.Name)}
+
+		if boolv(m.Config.Authorized) {
+			if policy.DeauthorizeAfter == 0 {
+				continue
+			}
+
+			res.Action, res.Reason = planDeauthorize(m, policy.DeauthorizeAfter, now)
+		} else {
+			if policy.DeleteAfter == 0 {
+				continue
+			}
+
+			res.Action, res.Reason = planDelete(m, policy.DeleteAfter, policy.DeletePending, now)
+		}
+
+		if res.Action == "" {
+			continue
+		}
+
+		if res.Action != PruneSkip && keep != nil && keep(m) {
+			res.Reason = fmt.Sprintf("protected from %s (%s)", res.Action, res.Reason)
+			res.Action = PruneSkip
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+func planDeauthorize(m *spec.Member, after time.Duration, now time.Time) (PruneAction, string) {
+	cutoff := now.Add(-after)
+
+	if t, ok := msTime(m.Config.LastAuthorizedTime); ok && t.After(cutoff) {
+		return "", ""
+	}
+
+	last, ok := lastActivity(m)
+	if !ok {
+		return PruneSkip, "no activity timestamps; they may have been reset"
+	}
+
+	if last.After(cutoff) {
+		return "", ""
+	}
+
+	return PruneDeauthorize, fmt.Sprintf("last online %s ago", roundAge(now.Sub(last)))
+}
+
+func planDelete(m *spec.Member, after time.Duration, pending bool, now time.Time) (PruneAction, string) {
+	cutoff := now.Add(-after)
+	reason := "deauthorized"
+
+	since, ok := msTime(m.Config.LastDeauthorizedTime)
+	if !ok {
+		if !pending {
+			return "", ""
+		}
+
+		since, ok = msTime(m.Config.CreationTime)
+		reason = "created"
+	}
+
+	if !ok {
+		return PruneSkip, "no deauthorization or creation time"
+	}
+
+	if since.After(cutoff) {
+		return "", ""
+	}
+
+	// a member still trying to reach the network is not stale, even if it
+	// is not authorized.
+	if last, ok := lastActivity(m); ok && last.After(cutoff) {
+		return "", ""
+	}
+
+	return PruneDelete, fmt.Sprintf("%s %s ago", reason, roundAge(now.Sub(since)))
+}
+
+// lastActivity returns the most recent of LastOnline and LastSeen.
+func lastActivity(m *spec.Member) (time.Time, bool) {
+	online, onlineOK := msTime(m.LastOnline)
+	seen, seenOK := msTime(m.LastSeen)
+
+	switch {
+	case onlineOK && seenOK:
+		if seen.After(online) {
+			return seen, true
+		}
+
+		return online, true
+	case onlineOK:
+		return online, true
+	case seenOK:
+		return seen, true
+	}
+
+	return time.Time{}, false
+}
+
+func roundAge(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+
+	return d.Round(time.Minute).String()
+}
+
+// PruneMembers deauthorizes and deletes stale members of a network according
+// to the policy; see PlanPrune for how members are chosen. The report is
+// always returned, and records what was applied even when an error occurs.
+func (c *Client) PruneMembers(ctx context.Context, networkID string, policy PrunePolicy) (*PruneReport, error) {
+	report := &PruneReport{NetworkID: networkID, DryRun: policy.DryRun}
+
+	network, err := c.GetNetwork(ctx, networkID)
+	if err != nil {
+		return report, err
+	}
+
+	members, err := c.GetMembers(ctx, networkID)
+	if err != nil {
+		return report, err
+	}
+
+	report.Results, err = PlanPrune(network, members, policy, time.Now())
+	if err != nil {
+		return report, err
+	}
+
+	limit := policy.MaxDeletions
+	if limit == 0 {
+		limit = DefaultMaxDeletions
+	}
+
+	if deletions := report.Count(PruneDelete); limit > 0 && deletions > limit {
+		return report, fmt.Errorf("%w: %d members qualify, the limit is %d", ErrPruneLimit, deletions, limit)
+	}
+
+	if policy.DryRun {
+		return report, nil
+	}
+
+	var (
+		ops     []BulkMemberOp
+		indexes []int
+	)
+
+	for i, res := range report.Results {
+		if res.Action == PruneDeauthorize {
+			ops = append(ops, DeauthorizeOp(res.NodeID))
+			indexes = append(indexes, i)
+		}
+	}
+
+	bulk, bulkErr := c.BulkUpdateMembers(ctx, networkID, ops, BulkOptions{})
+	for j, res := range bulk {
+		report.Results[indexes[j]].Applied = res.Success()
+		report.Results[indexes[j]].Err = res.Err
+	}
+
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	var failed int
+	for i := range report.Results {
+		res := &report.Results[i]
+		if res.Action != PruneDelete {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		res.Err = c.DeleteMember(ctx, networkID, res.NodeID)
+		res.Applied = res.Err == nil
+		if res.Err != nil {
+			failed++
+		}
+	}
+
+	if bulkErr != nil {
+		return report, bulkErr
+	}
+
+	if failed > 0 {
+		return report, fmt.Errorf("%d deletions failed", failed)
+	}
+
+	return report, nil
+}
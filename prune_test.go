@@ -0,0 +1,195 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestPruneMembers(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{
+		TagsByName: &map[string]interface{}{"keep": map[string]interface{}{"id": float64(7)}},
+	})
+
+	day := 24 * time.Hour
+	ago := func(d time.Duration) *int64 { return int64p(time.Now().Add(-d).UnixNano() / int64(time.Millisecond)) }
+
+	members := map[string]*spec.Member{
+		"0000000001": {LastOnline: ago(time.Hour), Config: &spec.MemberConfig{Authorized: boolp(true)}},
+		"0000000002": {LastOnline: ago(40 * day), Config: &spec.MemberConfig{Authorized: boolp(true)}},
+		"0000000003": {LastOnline: ago(40 * day), Config: &spec.MemberConfig{Authorized: boolp(true), Tags: &[][]interface{}{{7, 1}}}},
+		"0000000004": {LastOnline: int64p(0), LastSeen: int64p(0), Config: &spec.MemberConfig{Authorized: boolp(true)}},
+		"0000000005": {Config: &spec.MemberConfig{Authorized: boolp(false)}},
+		"0000000006": {Config: &spec.MemberConfig{Authorized: boolp(false)}},
+		"0000000007": {LastSeen: ago(time.Hour), Config: &spec.MemberConfig{Authorized: boolp(false)}},
+		"0000000008": {Config: &spec.MemberConfig{Authorized: boolp(false)}},
+	}
+
+	for id, m := range members {
+		m.NodeId = stringp(id)
+		fc.AddMember(*n.Id, m)
+	}
+
+	// the fake sets these as the updates happen, so backdate them.
+	for id, m := range members {
+		fc.EditMember(*n.Id, id, func(stored *spec.Member) {
+			stored.LastOnline, stored.LastSeen = m.LastOnline, m.LastSeen
+			stored.Config.LastAuthorizedTime = ago(60 * day)
+			stored.Config.CreationTime = ago(90 * day)
+		})
+	}
+
+	fc.EditMember(*n.Id, "0000000006", func(m *spec.Member) { m.Config.LastDeauthorizedTime = ago(day) })
+	fc.EditMember(*n.Id, "0000000008", func(m *spec.Member) { m.Config.LastDeauthorizedTime = ago(70 * day) })
+
+	policy := PrunePolicy{DeauthorizeAfter: 30 * day, DeleteAfter: 60 * day, KeepTag: "keep", DryRun: true}
+
+	report, err := c.PruneMembers(context.Background(), *n.Id, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]PruneAction{
+		"0000000002": PruneDeauthorize,
+		"0000000003": PruneSkip,
+		"0000000004": PruneSkip,
+		"0000000008": PruneDelete,
+	}
+
+	if len(report.Results) != len(expected) {
+		t.Fatalf("unexpected results: %+v", report.Results)
+	}
+
+	for _, res := range report.Results {
+		if expected[res.NodeID] != res.Action || res.Applied {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := report.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "dry run") || !strings.Contains(buf.String(), "0000000002") {
+		t.Fatalf("unexpected report:\n%s", buf)
+	}
+
+	if n, err := report.WriteTo(&failingWriter{limit: 10}); !errors.Is(err, errWriteFailed) || n != 10 {
+		t.Fatalf("expected the write error after 10 bytes, got %d, %v", n, err)
+	}
+
+	if !*fc.Member(*n.Id, "0000000002").Config.Authorized {
+		t.Fatal("dry run deauthorized a member")
+	}
+
+	policy.DryRun = false
+	policy.MaxDeletions = -1
+
+	if _, err := c.PruneMembers(context.Background(), *n.Id, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if *fc.Member(*n.Id, "0000000002").Config.Authorized {
+		t.Fatal("stale member was not deauthorized")
+	}
+
+	if !*fc.Member(*n.Id, "0000000003").Config.Authorized {
+		t.Fatal("kept member was deauthorized")
+	}
+
+	if fc.Member(*n.Id, "0000000008") != nil {
+		t.Fatal("stale deauthorized member was not deleted")
+	}
+
+	if fc.Member(*n.Id, "0000000005") == nil {
+		t.Fatal("pending member was deleted without DeletePending")
+	}
+
+	policy.DeletePending = true
+
+	if _, err := c.PruneMembers(context.Background(), *n.Id, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if fc.Member(*n.Id, "0000000005") != nil {
+		t.Fatal("stale pending member was not deleted")
+	}
+
+	for _, id := range []string{"0000000006", "0000000007"} {
+		if fc.Member(*n.Id, id) == nil {
+			t.Fatalf("member %q was deleted", id)
+		}
+	}
+}
+
+func TestPruneMembersLimit(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+
+	for _, id := range []string{"0000000001", "0000000002", "0000000003"} {
+		fc.AddMember(*n.Id, &spec.Member{NodeId: stringp(id)})
+		fc.EditMember(*n.Id, id, func(m *spec.Member) { m.Config.CreationTime = int64p(1) })
+	}
+
+	report, err := c.PruneMembers(context.Background(), *n.Id, PrunePolicy{DeleteAfter: time.Hour, DeletePending: true, MaxDeletions: 2})
+	if !errors.Is(err, ErrPruneLimit) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Count(PruneDelete) != 3 || len(fc.Requests()) != 2 {
+		t.Fatalf("unexpected report or requests: %+v %v", report.Results, fc.Requests())
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// failingWriter accepts limit bytes, then fails.
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errWriteFailed
+	}
+
+	w.limit -= len(p)
+	return len(p), nil
+}
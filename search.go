@@ -0,0 +1,338 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultSearchWorkers is the number of networks Search fetches members of
+// concurrently. It is additionally capped by the remaining rate limit.
+const DefaultSearchWorkers = 4
+
+// MatchReason says which part of a member matched a search.
+type MatchReason string
+
+const (
+	MatchNodeID          MatchReason = "nodeId"
+	MatchIPAssignment    MatchReason = "ipAssignment"
+	MatchRFC4193         MatchReason = "rfc4193"
+	Match6Plane          MatchReason = "6plane"
+	MatchName            MatchReason = "name"
+	MatchDescription     MatchReason = "description"
+	MatchPhysicalAddress MatchReason = "physicalAddress"
+)
+
+// SearchResult is a member that matched a search.
+type SearchResult struct {
+	Network *spec.Network
+	Member  *spec.Member
+	Reason  MatchReason
+	// Value is what matched, such as the IP or the name.
+	Value string
+}
+
+// MemberReader is what SearchMembers reads networks and members through.
+// *Client implements it, as does the caching client in pkg/cache.
+type MemberReader interface {
+	GetNetworks(ctx context.Context) ([]*spec.Network, error)
+	GetMembers(ctx context.Context, networkID string) ([]*spec.Member, error)
+	RateLimits() RateLimitHeaders
+}
+
+// Search finds members across every network. The query is matched against:
+//
+//   - node IDs, when it is a node ID
+//   - assigned IPs, and the RFC4193 and 6PLANE addresses of networks that
+//     enable them, when it is an IP or a CIDR
+//   - the IP of the physical address, when it is an IP or a CIDR
+//   - names, descriptions and physical addresses, case-insensitively, as a
+//     substring
+//
+// A member appears once for every way it matched. Results are ordered by
+// network and member ID.
+//
+// Search does not cache: every search lists the members of every network.
+// Callers that search repeatedly must use cache.Client.Search from pkg/cache
+// instead, or pass their own caching MemberReader to SearchMembers.
+func (c *Client) Search(ctx context.Context, query string) ([]SearchResult, error) {
+	return SearchMembers(ctx, c, query)
+}
+
+// SearchMembers is Search, reading networks and members through r.
+func SearchMembers(ctx context.Context, r MemberReader, query string) ([]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	networks, err := r.GetNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newSearchMatcher(query)
+
+	workers := DefaultSearchWorkers
+	if limits := r.RateLimits(); limits.Limit != 0 && limits.Remaining > 0 && limits.Remaining < workers {
+		workers = limits.Remaining
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		results  []SearchResult
+		firstErr error
+	)
+
+	jobs := make(chan *spec.Network)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := range jobs {
+				members, err := r.GetMembers(ctx, *n.Id)
+
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+
+				for _, member := range members {
+					results = append(results, m.match(n, member)...)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, n := range networks {
+		select {
+		case jobs <- n:
+		case <-ctx.Done():
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if *results[i].Network.Id != *results[j].Network.Id {
+			return *results[i].Network.Id < *results[j].Network.Id
+		}
+
+		return stringv(results[i].Member.NodeId) < stringv(results[j].Member.NodeId)
+	})
+
+	return results, nil
+}
+
+type searchMatcher struct {
+	text   string
+	nodeID string
+	ip     net.IP
+	cidr   *net.IPNet
+}
+
+func newSearchMatcher(query string) *searchMatcher {
+	m := &searchMatcher{text: strings.ToLower(query)}
+
+	if id, err := ParseNodeID(query); err == nil {
+		m.nodeID = id.String()
+	}
+
+	if ip := net.ParseIP(query); ip != nil {
+		m.ip = ip
+	} else if _, cidr, err := net.ParseCIDR(query); err == nil {
+		m.cidr = cidr
+	}
+
+	return m
+}
+
+func (m *searchMatcher) matchIP(ip net.IP) bool {
+	switch {
+	case ip == nil:
+		return false
+	case m.ip != nil:
+		return m.ip.Equal(ip)
+	case m.cidr != nil:
+		return m.cidr.Contains(ip)
+	}
+
+	return false
+}
+
+func (m *searchMatcher) match(n *spec.Network, member *spec.Member) []SearchResult {
+	var res []SearchResult
+
+	add := func(reason MatchReason, value string) {
+		res = append(res, SearchResult{Network: n, Member: member, Reason: reason, Value: value})
+	}
+
+	nodeID := stringv(member.NodeId)
+	if m.nodeID != "" && nodeID == m.nodeID {
+		add(MatchNodeID, nodeID)
+	}
+
+	for _, ip := range memberIPs(member) {
+		if m.matchIP(ip) {
+			add(MatchIPAssignment, ip.String())
+		}
+	}
+
+	var physicalMatched bool
+
+	if m.ip != nil || m.cidr != nil {
+		m.matchDerived(n, nodeID, add)
+
+		if host := physicalHost(stringv(member.PhysicalAddress)); m.matchIP(net.ParseIP(host)) {
+			add(MatchPhysicalAddress, stringv(member.PhysicalAddress))
+			physicalMatched = true
+		}
+	}
+
+	for _, field := range []struct {
+		reason MatchReason
+		value  string
+	}{
+		{MatchName, stringv(member.Name)},
+		{MatchDescription, stringv(member.Description)},
+		{MatchPhysicalAddress, stringv(member.PhysicalAddress)},
+	} {
+		if field.value == "" || !strings.Contains(strings.ToLower(field.value), m.text) {
+			continue
+		}
+
+		if field.reason == MatchPhysicalAddress && physicalMatched {
+			continue
+		}
+
+		add(field.reason, field.value)
+	}
+
+	return res
+}
+
+func (m *searchMatcher) matchDerived(n *spec.Network, nodeID string, add func(MatchReason, string)) {
+	if n.Config == nil || n.Config.V6AssignMode == nil {
+		return
+	}
+
+	nwid, err := ParseNetworkID(stringv(n.Id))
+	if err != nil {
+		return
+	}
+
+	node, err := ParseNodeID(nodeID)
+	if err != nil {
+		return
+	}
+
+	if boolv(n.Config.V6AssignMode.Rfc4193) {
+		if ip := RFC4193Address(nwid, node); m.matchIP(ip) {
+			add(MatchRFC4193, ip.String())
+		}
+	}
+
+	if boolv(n.Config.V6AssignMode.N6plane) {
+		ip := SixPlaneAddress(nwid, node)
+		// the node owns the whole /80, so match anything inside it.
+		prefix := &net.IPNet{IP: ip.Mask(net.CIDRMask(80, 128)), Mask: net.CIDRMask(80, 128)}
+		if m.matchIP(ip) || (m.ip != nil && prefix.Contains(m.ip)) {
+			add(Match6Plane, ip.String())
+		}
+	}
+}
+
+// physicalHost strips the port from a physical address like "1.2.3.4/9993".
+func physicalHost(addr string) string {
+	if i := strings.LastIndex(addr, "/"); i >= 0 {
+		return addr[:i]
+	}
+
+	return addr
+}
+
+// RFC4193Address returns the RFC4193 address ZeroTier assigns a node on a
+// network: fd, the network ID, 9993, then the node ID.
+func RFC4193Address(networkID NetworkID, nodeID NodeID) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfd
+
+	for i := 0; i < 8; i++ {
+		ip[1+i] = byte(uint64(networkID) >> (56 - 8*uint(i)))
+	}
+
+	ip[9] = 0x99
+	ip[10] = 0x93
+
+	for i := 0; i < 5; i++ {
+		ip[11+i] = byte(uint64(nodeID) >> (32 - 8*uint(i)))
+	}
+
+	return ip
+}
+
+// SixPlaneAddress returns the 6PLANE address ZeroTier assigns a node on a
+// network: fc, the network ID's halves XORed together, then the node ID, in
+// a /80 ending in ::1.
+func SixPlaneAddress(networkID NetworkID, nodeID NodeID) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfc
+
+	folded := uint32(uint64(networkID)>>32) ^ uint32(networkID)
+	for i := 0; i < 4; i++ {
+		ip[1+i] = byte(folded >> (24 - 8*uint(i)))
+	}
+
+	for i := 0; i < 5; i++ {
+		ip[5+i] = byte(uint64(nodeID) >> (32 - 8*uint(i)))
+	}
+
+	ip[15] = 0x01
+
+	return ip
+}
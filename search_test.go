@@ -0,0 +1,119 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestDerivedAddresses(t *testing.T) {
+	nwid, err := ParseNetworkID("17d709436c2c5367")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := ParseNodeID("a1b2c3d4e5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip := RFC4193Address(nwid, node).String(); ip != "fd17:d709:436c:2c53:6799:93a1:b2c3:d4e5" {
+		t.Fatalf("unexpected rfc4193 address: %s", ip)
+	}
+
+	if ip := SixPlaneAddress(nwid, node).String(); ip != "fc7b:fb5a:24a1:b2c3:d4e5::1" {
+		t.Fatalf("unexpected 6plane address: %s", ip)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c, fc := newFakeClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	v6 := fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{
+		V6AssignMode: &spec.IPV6AssignMode{Rfc4193: boolp(true), N6plane: boolp(true)},
+	}})
+	v4 := fc.AddNetwork(&spec.Network{})
+
+	fc.AddMember(*v6.Id, &spec.Member{NodeId: stringp("a1b2c3d4e5"), Name: stringp("bastion"), PhysicalAddress: stringp("203.0.113.7/9993")})
+	fc.AddMember(*v4.Id, &spec.Member{NodeId: stringp("a1b2c3d4e5"), Name: stringp("bastion"), Config: &spec.MemberConfig{IpAssignments: &[]string{"10.147.20.33"}}})
+	fc.AddMember(*v4.Id, &spec.Member{NodeId: stringp("0000000002"), Description: stringp("Build box for the Bastion team")})
+
+	nwid, _ := ParseNetworkID(*v6.Id)
+	node, _ := ParseNodeID("a1b2c3d4e5")
+
+	table := map[string][]MatchReason{
+		"10.147.20.33":                       {MatchIPAssignment},
+		"10.147.0.0/16":                      {MatchIPAssignment},
+		"A1B2C3D4E5":                         {MatchNodeID, MatchNodeID},
+		"bastion":                            {MatchName, MatchDescription, MatchName},
+		"203.0.113.7":                        {MatchPhysicalAddress},
+		"203.0.113":                          {MatchPhysicalAddress},
+		RFC4193Address(nwid, node).String():  {MatchRFC4193},
+		SixPlaneAddress(nwid, node).String(): {Match6Plane},
+		// anything in the node's 6PLANE /80 is the node.
+		sixPlaneHost(nwid, node, 0x42): {Match6Plane},
+		"nothing":                      nil,
+	}
+
+	for query, want := range table {
+		res, err := c.Search(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []MatchReason
+		for _, r := range res {
+			got = append(got, r.Reason)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("%q: expected %v, got %v", query, want, got)
+		}
+
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%q: expected %v, got %v", query, want, got)
+			}
+		}
+	}
+
+}
+
+func sixPlaneHost(nwid NetworkID, node NodeID, host byte) string {
+	ip := SixPlaneAddress(nwid, node)
+	ip[15] = host
+	return ip.String()
+}
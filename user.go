@@ -42,6 +42,11 @@ func (c *Client) CreateAPIToken(ctx context.Context, userID, name, token string)
 		return errors.New("token must be a minimum of 32 characters")
 	}
 
+	if c.dryRun != nil {
+		c.dryRunCreateAPIToken(userID, name, token)
+		return nil
+	}
+
 	resp, err := c.specClient.AddAPIToken(ctx, userID, spec.AddAPITokenJSONRequestBody{
 		Token:     &token,
 		TokenName: &name,
@@ -62,6 +67,11 @@ func (c *Client) CreateAPIToken(ctx context.Context, userID, name, token string)
 
 // DeleteAPIToken removes an API token from the list of available tokens.
 func (c *Client) DeleteAPIToken(ctx context.Context, userID, name string) error {
+	if c.dryRun != nil {
+		c.dryRunDeleteAPIToken(userID, name)
+		return nil
+	}
+
 	resp, err := c.specClient.DeleteAPIToken(ctx, userID, name)
 	if err != nil {
 		return err
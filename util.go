@@ -7,3 +7,23 @@ func boolp(b bool) *bool {
 func stringp(s string) *string {
 	return &s
 }
+
+func boolv(b *bool) bool {
+	return b != nil && *b
+}
+
+func stringv(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func intv(i *int) int {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
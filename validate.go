@@ -0,0 +1,376 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+const (
+	// MinMTU is the smallest MTU ZeroTier will configure on a virtual adapter.
+	MinMTU = 1280
+	// MaxMTU is the largest MTU ZeroTier will configure on a virtual adapter.
+	MaxMTU = 10000
+)
+
+// ErrInvalidNetwork is returned by the network mutation calls when network
+// validation is enabled and the network has at least one error-level problem.
+var ErrInvalidNetwork = errors.New("network failed validation")
+
+// Severity is the severity of a ValidationProblem.
+type Severity int
+
+const (
+	// SeverityWarning indicates a configuration Central will accept, but that is
+	// probably not what you want.
+	SeverityWarning Severity = iota
+	// SeverityError indicates a configuration that is invalid or dangerous.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the severity by name, so it reads well in JSON reports.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, and by extension JSON.
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "warning":
+		*s = SeverityWarning
+	case "error":
+		*s = SeverityError
+	default:
+		var n int
+		if _, err := fmt.Sscanf(string(text), "severity(%d)", &n); err != nil {
+			return fmt.Errorf("unknown severity %q", text)
+		}
+
+		*s = Severity(n)
+	}
+
+	return nil
+}
+
+// ValidationProblem is a single problem found by ValidateNetwork.
+type ValidationProblem struct {
+	Severity Severity
+	// Field is the JSON path of the offending field, e.g. config.routes[1].via
+	Field   string
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Field, p.Message)
+}
+
+// ValidationProblems is the list of problems found by ValidateNetwork. When
+// used as an error, it unwraps to ErrInvalidNetwork.
+type ValidationProblems []ValidationProblem
+
+func (vp ValidationProblems) Error() string {
+	strs := make([]string, 0, len(vp))
+	for _, p := range vp {
+		strs = append(strs, p.String())
+	}
+
+	return fmt.Sprintf("%v: %s", ErrInvalidNetwork, strings.Join(strs, "; "))
+}
+
+func (vp ValidationProblems) Unwrap() error {
+	return ErrInvalidNetwork
+}
+
+// Errors returns only the error-level problems.
+func (vp ValidationProblems) Errors() ValidationProblems {
+	return vp.filter(SeverityError)
+}
+
+// Warnings returns only the warning-level problems.
+func (vp ValidationProblems) Warnings() ValidationProblems {
+	return vp.filter(SeverityWarning)
+}
+
+// Err returns the error-level problems as an error, or nil if there are none.
+// Warnings never cause an error to be returned.
+func (vp ValidationProblems) Err() error {
+	if errs := vp.Errors(); len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (vp ValidationProblems) filter(s Severity) ValidationProblems {
+	var res ValidationProblems
+	for _, p := range vp {
+		if p.Severity == s {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
+
+func (vp *ValidationProblems) add(s Severity, field, format string, args ...interface{}) {
+	*vp = append(*vp, ValidationProblem{Severity: s, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateNetwork checks a network configuration for problems before it is
+// sent to Central. Only fields that are set are checked, so partial networks
+// (such as the ones used to update a single field) can be validated too. It
+// returns every problem found; use Err() on the result to decide whether to
+// proceed.
+func ValidateNetwork(n *spec.Network) ValidationProblems {
+	var vp ValidationProblems
+
+	if n == nil {
+		return vp
+	}
+
+	var id NetworkID
+
+	if n.Id != nil {
+		var err error
+		if id, err = ParseNetworkID(*n.Id); err != nil {
+			vp.add(SeverityError, "id", "%v", err)
+		}
+	}
+
+	nc := n.Config
+	if nc == nil {
+		return vp
+	}
+
+	if nc.Id != nil {
+		if cid, err := ParseNetworkID(*nc.Id); err != nil {
+			vp.add(SeverityError, "config.id", "%v", err)
+		} else if id != 0 && cid != id {
+			vp.add(SeverityError, "config.id", "%s does not match network ID %s", cid, id)
+		}
+	}
+
+	if nc.Mtu != nil && (*nc.Mtu < MinMTU || *nc.Mtu > MaxMTU) {
+		vp.add(SeverityError, "config.mtu", "%d is outside of the allowed range %d-%d", *nc.Mtu, MinMTU, MaxMTU)
+	}
+
+	if nc.MulticastLimit != nil {
+		if *nc.MulticastLimit < 0 {
+			vp.add(SeverityError, "config.multicastLimit", "%d is negative", *nc.MulticastLimit)
+		} else if *nc.MulticastLimit == 0 {
+			vp.add(SeverityWarning, "config.multicastLimit", "0 disables multicast and broadcast, which breaks IPv4 (ARP) on the network")
+		}
+	}
+
+	routes := validateRoutes(&vp, nc.Routes)
+	validatePools(&vp, nc.IpAssignmentPools, routes, nc.Routes != nil)
+
+	if nc.Dns != nil && nc.Dns.Servers != nil {
+		for i, server := range *nc.Dns.Servers {
+			if net.ParseIP(server) == nil {
+				vp.add(SeverityError, fmt.Sprintf("config.dns.servers[%d]", i), "%q is not an IP address", server)
+			}
+		}
+	}
+
+	if sso := nc.SsoConfig; sso != nil && sso.Enabled != nil && *sso.Enabled {
+		if sso.ClientId == nil || *sso.ClientId == "" {
+			vp.add(SeverityError, "config.ssoConfig.clientId", "SSO is enabled but no client ID is set")
+		}
+
+		if nc.Private != nil && !*nc.Private {
+			vp.add(SeverityError, "config.private", "SSO is enabled on a public network; members will not need to authenticate to join")
+		}
+	}
+
+	return vp
+}
+
+// validateRoutes checks the routes and returns the parsed targets, indexed
+// the same as the routes. Targets that fail to parse are nil.
+func validateRoutes(vp *ValidationProblems, routes *[]spec.Route) []*net.IPNet {
+	if routes == nil {
+		return nil
+	}
+
+	targets := make([]*net.IPNet, len(*routes))
+
+	for i, route := range *routes {
+		field := fmt.Sprintf("config.routes[%d]", i)
+
+		if route.Target == nil {
+			vp.add(SeverityError, field+".target", "route has no target")
+			continue
+		}
+
+		_, target, err := net.ParseCIDR(*route.Target)
+		if err != nil {
+			vp.add(SeverityError, field+".target", "%q is not a CIDR", *route.Target)
+			continue
+		}
+
+		targets[i] = target
+	}
+
+	for i, target := range targets {
+		if target == nil {
+			continue
+		}
+
+		for j := i + 1; j < len(targets); j++ {
+			other := targets[j]
+			if other == nil || !target.Contains(other.IP) && !other.Contains(target.IP) {
+				continue
+			}
+
+			field := fmt.Sprintf("config.routes[%d].target", j)
+
+			if target.String() == other.String() {
+				vp.add(SeverityError, field, "%s duplicates config.routes[%d]", other, i)
+			} else if !isDefaultRoute(target) && !isDefaultRoute(other) {
+				// default routes overlap everything by design, so they are not
+				// worth a warning.
+				vp.add(SeverityWarning, field, "%s overlaps %s in config.routes[%d]", other, target, i)
+			}
+		}
+	}
+
+	for i, route := range *routes {
+		if route.Via == nil || *route.Via == "" {
+			continue
+		}
+
+		field := fmt.Sprintf("config.routes[%d].via", i)
+
+		via := net.ParseIP(*route.Via)
+		if via == nil {
+			vp.add(SeverityError, field, "%q is not an IP address", *route.Via)
+			continue
+		}
+
+		if !viaReachable(via, *routes, targets) {
+			vp.add(SeverityError, field, "gateway %s is not inside any route target without a gateway", via)
+		}
+	}
+
+	return targets
+}
+
+// viaReachable reports whether the gateway is inside a route that is directly
+// reachable, i.e. a route without a via of its own.
+func viaReachable(via net.IP, routes []spec.Route, targets []*net.IPNet) bool {
+	for i, target := range targets {
+		if target == nil || (routes[i].Via != nil && *routes[i].Via != "") {
+			continue
+		}
+
+		if target.Contains(via) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validatePools checks the pools, and if routed is set, that each is inside
+// one of the route targets. Partial updates that leave the routes out are not
+// checked against them, as the network's stored routes are unknown.
+func validatePools(vp *ValidationProblems, pools *[]spec.IPRange, targets []*net.IPNet, routed bool) {
+	if pools == nil {
+		return
+	}
+
+	for i, pool := range *pools {
+		field := fmt.Sprintf("config.ipAssignmentPools[%d]", i)
+
+		if pool.IpRangeStart == nil || pool.IpRangeEnd == nil {
+			vp.add(SeverityError, field, "pool must have both a start and an end")
+			continue
+		}
+
+		start, end := net.ParseIP(*pool.IpRangeStart), net.ParseIP(*pool.IpRangeEnd)
+		if start == nil {
+			vp.add(SeverityError, field+".ipRangeStart", "%q is not an IP address", *pool.IpRangeStart)
+		}
+
+		if end == nil {
+			vp.add(SeverityError, field+".ipRangeEnd", "%q is not an IP address", *pool.IpRangeEnd)
+		}
+
+		if start == nil || end == nil {
+			continue
+		}
+
+		if (start.To4() == nil) != (end.To4() == nil) {
+			vp.add(SeverityError, field, "start %s and end %s are not the same address family", start, end)
+			continue
+		}
+
+		if bytes.Compare(start.To16(), end.To16()) > 0 {
+			vp.add(SeverityError, field, "start %s is after end %s", start, end)
+			continue
+		}
+
+		if routed && !rangeRouted(start, end, targets) {
+			vp.add(SeverityWarning, field, "%s-%s is not inside any route target; no addresses will be assigned from it", start, end)
+		}
+	}
+}
+
+func rangeRouted(start, end net.IP, targets []*net.IPNet) bool {
+	for _, target := range targets {
+		if target != nil && target.Contains(start) && target.Contains(end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isDefaultRoute(n *net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	return ones == 0
+}
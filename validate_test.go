@@ -0,0 +1,228 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestValidateNetwork(t *testing.T) {
+	table := map[string]struct {
+		network  *spec.Network
+		errors   []string
+		warnings []string
+	}{
+		"empty": {
+			network: &spec.Network{},
+		},
+		"valid": {
+			network: &spec.Network{
+				Id: stringp("8056c2e21c000001"),
+				Config: &spec.NetworkConfig{
+					Id:             stringp("8056c2e21c000001"),
+					Mtu:            intp(2800),
+					MulticastLimit: intp(32),
+					Routes: &[]spec.Route{
+						{Target: stringp("10.9.8.0/24")},
+						{Target: stringp("0.0.0.0/0"), Via: stringp("10.9.8.1")},
+					},
+					IpAssignmentPools: &[]spec.IPRange{
+						{IpRangeStart: stringp("10.9.8.10"), IpRangeEnd: stringp("10.9.8.250")},
+					},
+					Dns: &spec.DNS{Servers: stringSlicePtr("1.1.1.1", "2606:4700:4700::1111")},
+				},
+			},
+		},
+		"mtu": {
+			network: &spec.Network{Config: &spec.NetworkConfig{Mtu: intp(1000)}},
+			errors:  []string{"config.mtu"},
+		},
+		"multicast limit": {
+			network:  &spec.Network{Config: &spec.NetworkConfig{MulticastLimit: intp(0)}},
+			warnings: []string{"config.multicastLimit"},
+		},
+		"malformed pool": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Routes: &[]spec.Route{{Target: stringp("10.0.0.0/24")}},
+				IpAssignmentPools: &[]spec.IPRange{
+					{IpRangeStart: stringp("10.0.0.300"), IpRangeEnd: stringp("10.0.0.10")},
+					{IpRangeStart: stringp("10.0.0.20"), IpRangeEnd: stringp("10.0.0.10")},
+					{IpRangeStart: stringp("10.0.0.20"), IpRangeEnd: stringp("fd00::1")},
+				},
+			}},
+			errors: []string{
+				"config.ipAssignmentPools[0].ipRangeStart",
+				"config.ipAssignmentPools[1]",
+				"config.ipAssignmentPools[2]",
+			},
+		},
+		"pool outside routes": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Routes: &[]spec.Route{{Target: stringp("10.0.0.0/24")}},
+				IpAssignmentPools: &[]spec.IPRange{
+					{IpRangeStart: stringp("10.0.0.200"), IpRangeEnd: stringp("10.0.1.10")},
+				},
+			}},
+			warnings: []string{"config.ipAssignmentPools[0]"},
+		},
+		"pool without routes": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				IpAssignmentPools: &[]spec.IPRange{
+					{IpRangeStart: stringp("10.0.0.10"), IpRangeEnd: stringp("10.0.0.20")},
+				},
+			}},
+		},
+		"pool with no routes": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Routes: &[]spec.Route{},
+				IpAssignmentPools: &[]spec.IPRange{
+					{IpRangeStart: stringp("10.0.0.10"), IpRangeEnd: stringp("10.0.0.20")},
+				},
+			}},
+			warnings: []string{"config.ipAssignmentPools[0]"},
+		},
+		"overlapping routes": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Routes: &[]spec.Route{
+					{Target: stringp("10.0.0.0/16")},
+					{Target: stringp("10.0.1.0/24")},
+					{Target: stringp("10.0.0.0/16")},
+				},
+			}},
+			errors:   []string{"config.routes[2].target"},
+			warnings: []string{"config.routes[1].target", "config.routes[2].target"},
+		},
+		"unreachable via": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Routes: &[]spec.Route{
+					{Target: stringp("10.0.1.0/24"), Via: stringp("10.0.0.1")},
+					{Target: stringp("10.0.2.0/24"), Via: stringp("bogus")},
+				},
+			}},
+			errors: []string{"config.routes[0].via", "config.routes[1].via"},
+		},
+		"dns": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Dns: &spec.DNS{Servers: stringSlicePtr("1.1.1.1", "one.one.one.one")},
+			}},
+			errors: []string{"config.dns.servers[1]"},
+		},
+		"network id": {
+			network: &spec.Network{
+				Id:     stringp("8056c2e21c000001"),
+				Config: &spec.NetworkConfig{Id: stringp("8056c2e21c000002")},
+			},
+			errors: []string{"config.id"},
+		},
+		"malformed network id": {
+			network: &spec.Network{Id: stringp("8056c2e21c")},
+			errors:  []string{"id"},
+		},
+		"sso": {
+			network: &spec.Network{Config: &spec.NetworkConfig{
+				Private:   boolp(false),
+				SsoConfig: &spec.NetworkSSOConfig{Enabled: boolp(true)},
+			}},
+			errors: []string{"config.ssoConfig.clientId", "config.private"},
+		},
+	}
+
+	for name, harness := range table {
+		problems := ValidateNetwork(harness.network)
+
+		if err := compareFields(problems.Errors(), harness.errors); err != nil {
+			t.Fatalf("%q: errors: %v", name, err)
+		}
+
+		if err := compareFields(problems.Warnings(), harness.warnings); err != nil {
+			t.Fatalf("%q: warnings: %v", name, err)
+		}
+
+		if (len(harness.errors) == 0) != (problems.Err() == nil) {
+			t.Fatalf("%q: Err() was %v", name, problems.Err())
+		}
+	}
+}
+
+func compareFields(problems ValidationProblems, fields []string) error {
+	if len(problems) != len(fields) {
+		return errors.New(problems.Error())
+	}
+
+	for i, p := range problems {
+		if p.Field != fields[i] {
+			return errors.New(problems.Error())
+		}
+	}
+
+	return nil
+}
+
+func TestNetworkValidationPreflight(t *testing.T) {
+	c, err := NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetNetworkValidation(true)
+
+	// these fail before any request is made, so no token is necessary.
+	n := &spec.Network{Config: &spec.NetworkConfig{Mtu: intp(100)}}
+
+	if _, err := c.NewNetwork(context.Background(), "invalid", n); !errors.Is(err, ErrInvalidNetwork) {
+		t.Fatalf("NewNetwork did not fail validation: %v", err)
+	}
+
+	if _, err := c.UpdateNetwork(context.Background(), "8056c2e21c000001", n); !errors.Is(err, ErrInvalidNetwork) {
+		t.Fatalf("UpdateNetwork did not fail validation: %v", err)
+	}
+}
+
+func TestSeverityText(t *testing.T) {
+	for _, s := range []Severity{SeverityWarning, SeverityError, Severity(7)} {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var read Severity
+		if err := read.UnmarshalText(text); err != nil || read != s {
+			t.Fatalf("%s read back as %s: %v", s, read, err)
+		}
+	}
+
+	var s Severity
+	if err := s.UnmarshalText([]byte("fatal")); err == nil {
+		t.Fatal("expected an unknown severity to fail")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// DefaultWaitInterval is the first delay between polls of the Wait helpers.
+// Each poll doubles it, up to DefaultWaitMaxInterval.
+const DefaultWaitInterval = time.Second
+
+// DefaultWaitMaxInterval is the longest delay between polls of the Wait
+// helpers.
+const DefaultWaitMaxInterval = 30 * time.Second
+
+// NetworkPredicate reports whether a network is in the state being waited for.
+type NetworkPredicate func(n *spec.Network) bool
+
+// WaitError is returned when a Wait helper gives up. It wraps the context's
+// error, and carries the last state observed so callers can tell what was
+// missing.
+type WaitError struct {
+	// Member or Network is the last record fetched, or nil if none was.
+	Member  *spec.Member
+	Network *spec.Network
+	// LastErr is the error of the last poll, if it failed.
+	LastErr error
+	Err     error
+}
+
+func (e *WaitError) Error() string {
+	var last interface{} = "nothing"
+
+	switch {
+	case e.Member != nil:
+		last = fmt.Sprintf("member %s (authorized %v, ips %v, last online %v)",
+			stringv(e.Member.NodeId), e.Member.Config != nil && boolv(e.Member.Config.Authorized),
+			memberIPs(e.Member), timev(e.Member.LastOnline))
+	case e.Network != nil && e.Network.Config != nil:
+		last = fmt.Sprintf("network %s (last modified %v)", stringv(e.Network.Id), timev(e.Network.Config.LastModified))
+	case e.Network != nil:
+		last = fmt.Sprintf("network %s", stringv(e.Network.Id))
+	}
+
+	if e.LastErr != nil {
+		return fmt.Sprintf("gave up waiting, last saw %v, last error %v: %v", last, e.LastErr, e.Err)
+	}
+
+	return fmt.Sprintf("gave up waiting, last saw %v: %v", last, e.Err)
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// SetWaitBackoff sets the first and longest delay between polls of the Wait
+// helpers. The defaults are DefaultWaitInterval and DefaultWaitMaxInterval,
+// which are also used in place of delays that are not positive, so the
+// helpers never poll Central in a tight loop. max is raised to interval if it
+// is shorter.
+func (c *Client) SetWaitBackoff(interval, max time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+
+	if max <= 0 {
+		max = DefaultWaitMaxInterval
+	}
+
+	if max < interval {
+		max = interval
+	}
+
+	c.waitInterval = interval
+	c.waitMaxInterval = max
+}
+
+// WaitForMember polls the member until pred passes, and returns it. A member
+// that does not exist yet is waited for, like any other state. Give ctx a
+// deadline; when it expires, the error is a *WaitError.
+func (c *Client) WaitForMember(ctx context.Context, networkID, memberID string, pred MemberFilter) (*spec.Member, error) {
+	if err := validateIDs(networkID, memberID); err != nil {
+		return nil, err
+	}
+
+	werr := &WaitError{}
+
+	err := c.wait(ctx, werr, func() (bool, error) {
+		m, err := c.GetMember(ctx, networkID, memberID)
+		if err != nil {
+			return false, err
+		}
+
+		werr.Member = m
+		return pred(m), nil
+	})
+
+	return werr.Member, err
+}
+
+// WaitForMemberOnline waits until Central has heard from the member within
+// DefaultOnlineThreshold.
+func (c *Client) WaitForMemberOnline(ctx context.Context, networkID, memberID string) (*spec.Member, error) {
+	return c.WaitForMember(ctx, networkID, memberID, func(m *spec.Member) bool {
+		// built on every poll, so the threshold moves with the clock.
+		return OnlineWithin(DefaultOnlineThreshold)(m)
+	})
+}
+
+// WaitForNetwork polls the network until pred passes, and returns it. Give
+// ctx a deadline; when it expires, the error is a *WaitError.
+func (c *Client) WaitForNetwork(ctx context.Context, networkID string, pred NetworkPredicate) (*spec.Network, error) {
+	if _, err := ParseNetworkID(networkID); err != nil {
+		return nil, err
+	}
+
+	werr := &WaitError{}
+
+	err := c.wait(ctx, werr, func() (bool, error) {
+		n, err := c.GetNetwork(ctx, networkID)
+		if err != nil {
+			return false, err
+		}
+
+		werr.Network = n
+		return pred(n), nil
+	})
+
+	return werr.Network, err
+}
+
+// wait runs poll with exponential backoff until it passes or ctx is done.
+// Poll errors are retried, except for those no amount of waiting fixes.
+func (c *Client) wait(ctx context.Context, werr *WaitError, poll func() (bool, error)) error {
+	interval := c.waitInterval
+
+	for {
+		ok, err := poll()
+		if ok {
+			return nil
+		}
+
+		if err != nil && ctx.Err() == nil {
+			var se *StatusError
+			if errors.As(err, &se) && (se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden) {
+				return err
+			}
+
+			werr.LastErr = err
+		}
+
+		delay := interval
+		if limits := c.RateLimits(); limits.Limit != 0 && limits.Remaining <= 1 {
+			// out of requests; wait as long as we are willing to.
+			delay = c.waitMaxInterval
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			werr.Err = ctx.Err()
+			return werr
+		case <-t.C:
+		}
+
+		if interval *= 2; interval > c.waitMaxInterval {
+			interval = c.waitMaxInterval
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+func TestWaitForMember(t *testing.T) {
+	c, fc := newFakeClient(t)
+	c.SetWaitBackoff(5*time.Millisecond, 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n := fc.AddNetwork(&spec.Network{})
+
+	// the member shows up, and gets its IP, while we are waiting.
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001"), Config: &spec.MemberConfig{Authorized: boolp(true)}})
+		time.Sleep(30 * time.Millisecond)
+		fc.EditMember(*n.Id, "0000000001", func(m *spec.Member) {
+			m.Config.IpAssignments = &[]string{"10.0.0.1"}
+		})
+	}()
+
+	m, err := c.WaitForMember(ctx, *n.Id, "0000000001", AllOf(IsAuthorized(true), HasIPAssignments()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*m.Config.IpAssignments)[0] != "10.0.0.1" {
+		t.Fatalf("unexpected member: %+v", m)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.WaitForMemberOnline(short, *n.Id, "0000000001")
+
+	var werr *WaitError
+	if !errors.As(err, &werr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a wait error, got %v", err)
+	}
+
+	if werr.Member == nil || *werr.Member.NodeId != "0000000001" || !strings.Contains(err.Error(), "10.0.0.1") {
+		t.Fatalf("wait error does not carry the last state: %v", err)
+	}
+
+	fc.Fail = func(r *http.Request) int { return http.StatusUnauthorized }
+	if _, err := c.WaitForMember(ctx, *n.Id, "0000000001", IsAuthorized(true)); !errors.Is(err, ErrStatus) || errors.As(err, &werr) {
+		t.Fatalf("expected an immediate status error, got %v", err)
+	}
+}
+
+func TestWaitForNetwork(t *testing.T) {
+	c, fc := newFakeClient(t)
+	c.SetWaitBackoff(5*time.Millisecond, 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n := fc.AddNetwork(&spec.Network{Config: &spec.NetworkConfig{Name: stringp("before")}})
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := c.UpdateNetwork(ctx, *n.Id, &spec.Network{Config: &spec.NetworkConfig{Name: stringp("after")}}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	res, err := c.WaitForNetwork(ctx, *n.Id, func(n *spec.Network) bool {
+		return stringv(n.Config.Name) == "after"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *res.Config.Name != "after" {
+		t.Fatalf("unexpected network: %+v", res.Config)
+	}
+
+	if _, err := c.WaitForNetwork(ctx, "nope", nil); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("expected invalid id, got %v", err)
+	}
+}
+
+func TestSetWaitBackoff(t *testing.T) {
+	c, err := NewClient("fake-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetWaitBackoff(0, -time.Second)
+	if c.waitInterval != DefaultWaitInterval || c.waitMaxInterval != DefaultWaitMaxInterval {
+		t.Fatalf("unexpected backoff %v, %v", c.waitInterval, c.waitMaxInterval)
+	}
+
+	c.SetWaitBackoff(time.Minute, 0)
+	if c.waitInterval != time.Minute || c.waitMaxInterval != time.Minute {
+		t.Fatalf("unexpected backoff %v, %v", c.waitInterval, c.waitMaxInterval)
+	}
+}
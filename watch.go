@@ -0,0 +1,411 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// EventType is the kind of change a watch Event reports.
+type EventType string
+
+const (
+	// EventNetworkCreated is sent when a network appears.
+	EventNetworkCreated EventType = "NetworkCreated"
+	// EventNetworkDeleted is sent when a network disappears.
+	EventNetworkDeleted EventType = "NetworkDeleted"
+	// EventNetworkConfigChanged is sent when a network's configuration or
+	// rules change.
+	EventNetworkConfigChanged EventType = "NetworkConfigChanged"
+	// EventMemberJoined is sent when a new, unauthorized member appears.
+	EventMemberJoined EventType = "MemberJoined"
+	// EventMemberDeleted is sent when a member disappears.
+	EventMemberDeleted EventType = "MemberDeleted"
+	// EventMemberAuthorized is sent when a member is authorized, including
+	// members that appear already authorized.
+	EventMemberAuthorized EventType = "MemberAuthorized"
+	// EventMemberDeauthorized is sent when a member is deauthorized.
+	EventMemberDeauthorized EventType = "MemberDeauthorized"
+	// EventMemberOnline is sent when a member comes online.
+	EventMemberOnline EventType = "MemberOnline"
+	// EventMemberOffline is sent when a member goes offline.
+	EventMemberOffline EventType = "MemberOffline"
+	// EventIPAssignmentChanged is sent when a member's IP assignments change.
+	EventIPAssignmentChanged EventType = "IPAssignmentChanged"
+	// EventCheckpoint is sent after every poll. Its Cursor can be persisted and
+	// passed to WatchOptions.Cursor to resume watching later.
+	EventCheckpoint EventType = "Checkpoint"
+	// EventError is sent when a poll fails. Watching continues.
+	EventError EventType = "Error"
+)
+
+// DefaultWatchInterval is the poll interval used when WatchOptions.Interval is
+// not set.
+const DefaultWatchInterval = time.Minute
+
+// DefaultOnlineThreshold is how recently a member must have been online to be
+// considered online, when WatchOptions.OnlineThreshold is not set.
+const DefaultOnlineThreshold = 5 * time.Minute
+
+// Event is a change observed by Watch.
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	NetworkID string
+	MemberID  string
+	// Network is set on network events, and is the last known state for
+	// EventNetworkDeleted.
+	Network *spec.Network
+	// Member is set on member events, and is the last known state for
+	// EventMemberDeleted.
+	Member *spec.Member
+	// Cursor is set on EventCheckpoint.
+	Cursor *WatchCursor
+	// Err is set on EventError.
+	Err error
+}
+
+// WatchOptions control Watch.
+type WatchOptions struct {
+	// Interval between polls. Every poll costs one request, plus one per
+	// watched network, against the rate limit.
+	Interval time.Duration
+	// NetworkIDs limits watching to these networks. Empty watches all of them.
+	NetworkIDs []string
+	// OnlineThreshold is how recently a member must have been online to be
+	// considered online.
+	OnlineThreshold time.Duration
+	// Cursor resumes from a checkpoint, reporting what changed since then.
+	// Without one, the first poll only establishes a baseline.
+	Cursor *WatchCursor
+}
+
+// WatchCursor is the state Watch compares each poll against. It marshals to
+// JSON so it can be persisted between runs.
+type WatchCursor struct {
+	Time     time.Time                     `json:"time"`
+	Networks map[string]*WatchNetworkState `json:"networks"`
+}
+
+// WatchNetworkState is the watched state of a network.
+type WatchNetworkState struct {
+	LastModified int64                        `json:"lastModified,omitempty"`
+	ConfigHash   string                       `json:"configHash"`
+	Members      map[string]*WatchMemberState `json:"members"`
+}
+
+// WatchMemberState is the watched state of a member.
+type WatchMemberState struct {
+	Revision      int      `json:"revision"`
+	Authorized    bool     `json:"authorized"`
+	Online        bool     `json:"online"`
+	IPAssignments []string `json:"ipAssignments,omitempty"`
+}
+
+// Watch polls Central and sends an Event for every change it sees, followed
+// by an EventCheckpoint after every poll. The channel is closed when the
+// context is canceled.
+func (c *Client) Watch(ctx context.Context, opts WatchOptions) <-chan Event {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+
+	if opts.OnlineThreshold <= 0 {
+		opts.OnlineThreshold = DefaultOnlineThreshold
+	}
+
+	ch := make(chan Event)
+
+	go func() {
+		defer close(ch)
+
+		cursor := opts.Cursor
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			next, events, err := c.pollWatch(ctx, opts, cursor, time.Now())
+			if err != nil {
+				events = []Event{{Type: EventError, Time: time.Now(), Err: err}}
+			} else {
+				cursor = next
+				events = append(events, Event{Type: EventCheckpoint, Time: cursor.Time, Cursor: cursor.copy()})
+			}
+
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// pollWatch fetches the current state and diffs it against the cursor. With
+// no cursor, no events are returned.
+func (c *Client) pollWatch(ctx context.Context, opts WatchOptions, prev *WatchCursor, now time.Time) (*WatchCursor, []Event, error) {
+	networks, err := c.GetNetworks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(opts.NetworkIDs) > 0 {
+		wanted := map[string]bool{}
+		for _, id := range opts.NetworkIDs {
+			wanted[id] = true
+		}
+
+		var filtered []*spec.Network
+		for _, n := range networks {
+			if wanted[stringv(n.Id)] {
+				filtered = append(filtered, n)
+			}
+		}
+
+		networks = filtered
+	}
+
+	members := map[string][]*spec.Member{}
+	for _, n := range networks {
+		if n.Id == nil {
+			continue
+		}
+
+		if members[*n.Id], err = c.GetMembers(ctx, *n.Id); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	next, events := diffWatch(prev, networks, members, opts.OnlineThreshold, now)
+	return next, events, nil
+}
+
+// diffWatch builds the next cursor and the events between it and prev.
+func diffWatch(prev *WatchCursor, networks []*spec.Network, members map[string][]*spec.Member, threshold time.Duration, now time.Time) (*WatchCursor, []Event) {
+	next := &WatchCursor{Time: now, Networks: map[string]*WatchNetworkState{}}
+	var events []Event
+
+	event := func(t EventType, n *spec.Network, networkID string, m *spec.Member, memberID string) {
+		events = append(events, Event{Type: t, Time: now, NetworkID: networkID, MemberID: memberID, Network: n, Member: m})
+	}
+
+	for _, n := range networks {
+		if n.Id == nil {
+			continue
+		}
+
+		id := *n.Id
+		state := &WatchNetworkState{Members: map[string]*WatchMemberState{}}
+		if n.Config != nil && n.Config.LastModified != nil {
+			state.LastModified = *n.Config.LastModified
+		}
+
+		var old *WatchNetworkState
+		if prev != nil {
+			old = prev.Networks[id]
+		}
+
+		// LastModified is cheap and reliable when Central provides it; only
+		// hash the configuration when it has changed or is missing.
+		if old != nil && state.LastModified != 0 && state.LastModified == old.LastModified {
+			state.ConfigHash = old.ConfigHash
+		} else {
+			state.ConfigHash = networkConfigHash(n)
+		}
+
+		switch {
+		case prev == nil:
+		case old == nil:
+			event(EventNetworkCreated, n, id, nil, "")
+		case old.ConfigHash != state.ConfigHash:
+			event(EventNetworkConfigChanged, n, id, nil, "")
+		}
+
+		for _, m := range members[id] {
+			// members without a node ID cannot be told apart between polls.
+			if m.NodeId == nil {
+				continue
+			}
+
+			memberID := *m.NodeId
+			ms := newWatchMemberState(m, threshold, now)
+			state.Members[memberID] = ms
+
+			if prev == nil {
+				continue
+			}
+
+			var oldm *WatchMemberState
+			if old != nil {
+				oldm = old.Members[memberID]
+			}
+
+			if oldm == nil {
+				if ms.Authorized {
+					event(EventMemberAuthorized, n, id, m, memberID)
+				} else {
+					event(EventMemberJoined, n, id, m, memberID)
+				}
+
+				if ms.Online {
+					event(EventMemberOnline, n, id, m, memberID)
+				}
+
+				continue
+			}
+
+			// the revision only changes when the member record is edited;
+			// online status is computed and checked every time.
+			if ms.Revision != oldm.Revision || ms.Revision == 0 {
+				if ms.Authorized && !oldm.Authorized {
+					event(EventMemberAuthorized, n, id, m, memberID)
+				} else if !ms.Authorized && oldm.Authorized {
+					event(EventMemberDeauthorized, n, id, m, memberID)
+				}
+
+				if !stringSliceEqual(ms.IPAssignments, oldm.IPAssignments) {
+					event(EventIPAssignmentChanged, n, id, m, memberID)
+				}
+			}
+
+			if ms.Online && !oldm.Online {
+				event(EventMemberOnline, n, id, m, memberID)
+			} else if !ms.Online && oldm.Online {
+				event(EventMemberOffline, n, id, m, memberID)
+			}
+		}
+
+		if old != nil {
+			for _, memberID := range sortedMemberIDs(old.Members) {
+				if _, ok := state.Members[memberID]; !ok {
+					event(EventMemberDeleted, n, id, nil, memberID)
+				}
+			}
+		}
+
+		next.Networks[id] = state
+	}
+
+	if prev != nil {
+		for _, id := range sortedNetworkIDs(prev.Networks) {
+			if _, ok := next.Networks[id]; !ok {
+				event(EventNetworkDeleted, nil, id, nil, "")
+			}
+		}
+	}
+
+	return next, events
+}
+
+func newWatchMemberState(m *spec.Member, threshold time.Duration, now time.Time) *WatchMemberState {
+	ms := &WatchMemberState{}
+
+	if lo, ok := msTime(m.LastOnline); ok {
+		ms.Online = now.Sub(lo) < threshold
+	}
+
+	if m.Config != nil {
+		ms.Revision = intv(m.Config.Revision)
+		ms.Authorized = boolv(m.Config.Authorized)
+		if m.Config.IpAssignments != nil {
+			ms.IPAssignments = append([]string{}, *m.Config.IpAssignments...)
+			sort.Strings(ms.IPAssignments)
+		}
+	}
+
+	return ms
+}
+
+func networkConfigHash(n *spec.Network) string {
+	content, _ := json.Marshal(struct {
+		Config *spec.NetworkConfig
+		Rules  *string
+	}{n.Config, n.RulesSource})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (wc *WatchCursor) copy() *WatchCursor {
+	res := &WatchCursor{}
+	content, _ := json.Marshal(wc)
+	json.Unmarshal(content, res)
+	return res
+}
+
+func sortedMemberIDs(m map[string]*WatchMemberState) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNetworkIDs(m map[string]*WatchNetworkState) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2021, ZeroTier, Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package ztcentral
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zerotier/go-ztcentral/pkg/spec"
+)
+
+// nextWatchEvents collects the event types up to the next checkpoint.
+func nextWatchEvents(t *testing.T, ch <-chan Event) ([]EventType, *WatchCursor) {
+	var types []EventType
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				t.Fatal("watch channel closed")
+			}
+
+			switch e.Type {
+			case EventCheckpoint:
+				return types, e.Cursor
+			case EventError:
+				t.Fatal(e.Err)
+			}
+
+			types = append(types, e.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for watch events")
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := c.Watch(ctx, WatchOptions{Interval: 10 * time.Millisecond})
+
+	if types, _ := nextWatchEvents(t, ch); len(types) != 0 {
+		t.Fatalf("baseline poll produced events: %v", types)
+	}
+
+	steps := []struct {
+		change   func()
+		expected []EventType
+	}{
+		{
+			change:   func() {},
+			expected: nil,
+		},
+		{
+			change:   func() { fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002")}) },
+			expected: []EventType{EventMemberJoined},
+		},
+		{
+			change: func() {
+				fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002"), Config: &spec.MemberConfig{
+					Authorized:    boolp(true),
+					IpAssignments: stringSlicePtr("10.0.0.2"),
+				}})
+			},
+			expected: []EventType{EventMemberAuthorized, EventIPAssignmentChanged},
+		},
+		{
+			change: func() {
+				fc.EditMember(*n.Id, "0000000001", func(m *spec.Member) {
+					m.LastOnline = int64p(time.Now().UnixNano() / int64(time.Millisecond))
+				})
+			},
+			expected: []EventType{EventMemberOnline},
+		},
+		{
+			change: func() {
+				fc.EditMember(*n.Id, "0000000001", func(m *spec.Member) { m.LastOnline = int64p(1) })
+				fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000002"), Config: &spec.MemberConfig{Authorized: boolp(false)}})
+			},
+			expected: []EventType{EventMemberOffline, EventMemberDeauthorized},
+		},
+		{
+			change: func() {
+				if _, err := c.UpdateNetworkRules(ctx, *n.Id, "drop;"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []EventType{EventNetworkConfigChanged},
+		},
+		{
+			change: func() {
+				if err := c.DeleteMember(ctx, *n.Id, "0000000002"); err != nil {
+					t.Fatal(err)
+				}
+
+				fc.AddNetwork(&spec.Network{})
+			},
+			expected: []EventType{EventMemberDeleted, EventNetworkCreated},
+		},
+		{
+			change: func() {
+				if err := c.DeleteNetwork(ctx, *n.Id); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []EventType{EventNetworkDeleted},
+		},
+	}
+
+	for i, step := range steps {
+		step.change()
+
+		// a poll may have been in flight while the change was made, so the
+		// events land in either it or the one after.
+		types, _ := nextWatchEvents(t, ch)
+		more, _ := nextWatchEvents(t, ch)
+		types = append(types, more...)
+
+		if !reflect.DeepEqual(types, step.expected) && !(len(types) == 0 && len(step.expected) == 0) {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, types)
+		}
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	c, fc := newFakeClient(t)
+	n := fc.AddNetwork(&spec.Network{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, cursor := nextWatchEvents(t, c.Watch(ctx, WatchOptions{Interval: time.Hour}))
+	cancel()
+
+	content, err := json.Marshal(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc.AddMember(*n.Id, &spec.Member{NodeId: stringp("0000000001")})
+
+	var resumed WatchCursor
+	if err := json.Unmarshal(content, &resumed); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	types, _ := nextWatchEvents(t, c.Watch(ctx, WatchOptions{Interval: time.Hour, Cursor: &resumed}))
+	if !reflect.DeepEqual(types, []EventType{EventMemberJoined}) {
+		t.Fatalf("unexpected events after resume: %v", types)
+	}
+}
+
+func TestWatchWithoutNodeID(t *testing.T) {
+	n := &spec.Network{Id: stringp("8056c2e21c000001")}
+	members := map[string][]*spec.Member{*n.Id: {
+		{NodeId: stringp("0000000001")},
+		{Config: &spec.MemberConfig{Authorized: boolp(true), Revision: intp(1)}},
+		{Config: &spec.MemberConfig{Authorized: boolp(false), Revision: intp(2)}},
+	}}
+
+	now := time.Now()
+	prev, _ := diffWatch(nil, []*spec.Network{n}, members, time.Minute, now)
+
+	if len(prev.Networks[*n.Id].Members) != 1 {
+		t.Fatalf("unexpected members: %+v", prev.Networks[*n.Id].Members)
+	}
+
+	if _, events := diffWatch(prev, []*spec.Network{n}, members, time.Minute, now); len(events) != 0 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}